@@ -0,0 +1,394 @@
+package api
+
+import (
+	"math"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/config"
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/stats"
+)
+
+// aggregator incrementally aggregates tracks and their audio features. Tracks must be pushed before their audio
+// features.
+type aggregator interface {
+	// PushTracks aggregates the given track items, returning the IDs of the tracks to fetch audio features for.
+	PushTracks(items []spotify.TrackItem) []string
+	// PushAudioFeatures aggregates the given track audio features.
+	PushAudioFeatures(audioFeatures []spotify.AudioFeatures)
+}
+
+var _ aggregator = (*trackAggregator)(nil)
+
+// trackAggregator incrementally aggregates track and audio feature data into the stats payload used to drive
+// visualisations. Tracks must be pushed before their audio features. The details and values of every track are
+// retained until Calc, so its memory usage is proportional to the number of tracks, unless it is streaming.
+type trackAggregator struct {
+	popularity          stats.Group
+	releaseDates        stats.Group
+	releaseDatesMapping stats.Mapping
+	explicitMapping     stats.Mapping
+	titleWordMapping    stats.Mapping
+	artistWordMapping   stats.Mapping
+	trackIDLookup       map[string]spotify.TrackDetails
+	itemCount           int
+	trackCount          int
+	skippedMapping      stats.Mapping
+
+	energy, danceability, valence, acousticness, speechiness, instrumentalness, liveness stats.Group
+	trackDuration, tempo, loudness                                                       stats.Group
+	pitchKeyCounts, modeCounts, keyModeCounts, timeSignatureCounts                       stats.Mapping
+	energyBins, valenceBins, danceabilityBins, tempoBins, durationBins, popularityBins   *stats.Histogram
+	featureVectors                                                                       *stats.Vectors
+	moods                                                                                *stats.MoodClassifier
+	positivityGraphData                                                                  []PositivityGraphPoint
+	trackPoints                                                                          []TrackPoint
+
+	// streaming bounds the state retained, and groupOpts configures each Group accordingly.
+	streaming bool
+	groupOpts []stats.GroupOpt
+}
+
+var (
+	// percentageBins divides percentages into bins of 10%.
+	percentageBins = stats.FixedWidthBins(0, 100, 10)
+	// durationBins are track durations in milliseconds, from under 2 minutes to over 6 minutes.
+	durationBins = stats.FixedBins(math.Inf(-1), 2*60000, 3*60000, 4*60000, 5*60000, 6*60000, math.Inf(1))
+)
+
+// correlationVariables are the track properties which are correlated with each other. Energy, danceability, valence,
+// acousticness, speechiness, instrumentalness and liveness are percentages, and duration is in seconds.
+var correlationVariables = []string{
+	"energy", "danceability", "valence", "acousticness", "speechiness", "instrumentalness", "liveness", "tempo",
+	"loudness", "duration", "popularity", "release_year",
+}
+
+// formatMinutes formats a duration in milliseconds as whole minutes, e.g. "3m".
+func formatMinutes(millis float64) string {
+	return strconv.Itoa(int(millis/60000)) + "m"
+}
+
+// newTrackAggregator initialises a trackAggregator. The mood options configure how tracks are classified into moods.
+func newTrackAggregator(capacity int, moodOpts ...stats.MoodOpt) *trackAggregator {
+	return &trackAggregator{
+		releaseDatesMapping: stats.NewMapping(10),
+		explicitMapping:     stats.NewMapping(2, "non-explicit", "explicit"),
+		titleWordMapping:    stats.NewMapping(100),
+		artistWordMapping:   stats.NewMapping(100),
+		trackIDLookup:       make(map[string]spotify.TrackDetails, capacity),
+		pitchKeyCounts:      stats.NewMapping(12, stats.PitchKeys...),
+		modeCounts:          stats.NewMapping(2, stats.ModeMajor, stats.ModeMinor),
+		keyModeCounts:       stats.NewMapping(24),
+		timeSignatureCounts: stats.NewMapping(5),
+		skippedMapping: stats.NewMapping(3, spotify.ItemLocal.String(), spotify.ItemEpisode.String(),
+			spotify.ItemUnavailable.String()),
+		energyBins:          stats.NewHistogram(percentageBins),
+		valenceBins:         stats.NewHistogram(percentageBins),
+		danceabilityBins:    stats.NewHistogram(percentageBins),
+		tempoBins:           stats.NewHistogram(stats.TempoBins),
+		durationBins:        stats.NewHistogram(durationBins, stats.WithEdgeFormat(formatMinutes)),
+		popularityBins:      stats.NewHistogram(percentageBins),
+		featureVectors:      stats.NewVectors(correlationVariables...),
+		moods:               stats.NewMoodClassifier(moodOpts...),
+		positivityGraphData: make([]PositivityGraphPoint, 0, capacity),
+		trackPoints:         make([]TrackPoint, 0, capacity),
+	}
+}
+
+// newStreamingTrackAggregator initialises a trackAggregator for streamed tracks, whose retained state is bounded
+// regardless of the number of tracks. Distribution stats and correlations are estimated from a uniform random sample
+// of sampleSize tracks, only the details of the tracks which Calc may look up are retained, and the per-track chart
+// data isn't aggregated. As the details of other tracks are discarded, each PushAudioFeatures call must include the
+// audio features of every track pushed since the previous call.
+func newStreamingTrackAggregator(sampleSize int, moodOpts ...stats.MoodOpt) *trackAggregator {
+	t := newTrackAggregator(0, moodOpts...)
+	t.streaming = true
+	t.groupOpts = []stats.GroupOpt{stats.WithSampleSize(sampleSize)}
+	for _, g := range t.groups() {
+		*g = stats.NewGroup(t.groupOpts...)
+	}
+	t.featureVectors = stats.NewSampledVectors(sampleSize, correlationVariables...)
+	return t
+}
+
+// groups returns each of the aggregated Groups.
+func (t *trackAggregator) groups() []*stats.Group {
+	return []*stats.Group{
+		&t.popularity, &t.releaseDates, &t.energy, &t.danceability, &t.valence, &t.acousticness, &t.speechiness,
+		&t.instrumentalness, &t.liveness, &t.trackDuration, &t.tempo, &t.loudness,
+	}
+}
+
+// PushTracks aggregates the track metadata for the given track items, returning the IDs of the tracks aggregated.
+// Local files, podcast episodes and unavailable items can't be analysed, so are counted and skipped.
+func (t *trackAggregator) PushTracks(items []spotify.TrackItem) []string {
+	trackIDs := make([]string, 0, len(items))
+	for _, track := range items {
+		t.itemCount++
+		if kind := track.Kind(); kind != spotify.ItemTrack {
+			t.skippedMapping.Push(kind.String())
+			continue
+		}
+
+		t.trackCount++
+		trackIDs = append(trackIDs, track.TrackDetails.ID)
+		t.trackIDLookup[track.TrackDetails.ID] = *track.TrackDetails
+		// aggregate track popularity
+		t.popularity.Push(track.TrackDetails.ID, track.TrackDetails.Popularity)
+		t.popularityBins.Push(track.TrackDetails.Popularity)
+		// aggregate by release year
+		releaseDate, err := track.TrackDetails.Album.ParseReleaseDate()
+		if err == nil {
+			// sometimes tracks don't have release date metadata - skip them from this stat
+			t.releaseDatesMapping.Push(strconv.Itoa(releaseDate.Year()))
+			t.releaseDates.Push(track.TrackDetails.ID, float64(releaseDate.Unix()))
+		}
+
+		// count explicit vs explicit tracks
+		explicit := "non-explicit"
+		if track.TrackDetails.Explicit {
+			explicit = "explicit"
+		}
+		t.explicitMapping.Push(explicit)
+
+		// count unique sentence title words
+		stats.CountWordsInSentence(track.TrackDetails.Name, t.titleWordMapping)
+		for _, artist := range track.TrackDetails.Artists {
+			t.artistWordMapping.Push(artist.Name)
+		}
+	}
+	return trackIDs
+}
+
+// PushAudioFeatures aggregates the given track audio features.
+func (t *trackAggregator) PushAudioFeatures(audioFeatures []spotify.AudioFeatures) {
+	t.pushAudioFeatures(audioFeatures)
+	if t.streaming {
+		t.prune()
+	}
+}
+
+func (t *trackAggregator) pushAudioFeatures(audioFeatures []spotify.AudioFeatures) {
+	for _, feature := range audioFeatures {
+		t.energy.Push(feature.ID, feature.Energy)
+		t.danceability.Push(feature.ID, feature.Danceability)
+		t.valence.Push(feature.ID, feature.Valence)
+		t.acousticness.Push(feature.ID, feature.Acousticness)
+		t.speechiness.Push(feature.ID, feature.Speechiness)
+		t.instrumentalness.Push(feature.ID, feature.Instrumentalness)
+		t.liveness.Push(feature.ID, feature.Liveness)
+		t.trackDuration.Push(feature.ID, float64(feature.DurationMillis))
+		t.tempo.Push(feature.ID, math.Round(feature.Tempo))
+		t.loudness.Push(feature.ID, feature.Loudness)
+		t.energyBins.Push(feature.Energy * 100)
+		t.valenceBins.Push(feature.Valence * 100)
+		t.danceabilityBins.Push(feature.Danceability * 100)
+		t.tempoBins.Push(feature.Tempo)
+		t.durationBins.Push(float64(feature.DurationMillis))
+		t.moods.Push(feature.ID, feature.Valence, feature.Energy)
+
+		// -1 is Spotify's unknown key value, which is also used for unknown modes
+		if feature.Mode > -1 {
+			t.modeCounts.Push(stats.SpotifyModeToString(feature.Mode))
+		}
+		if feature.Key > -1 {
+			t.pitchKeyCounts.Push(stats.SpotifyKeyToPitchKey(feature.Key))
+			if feature.Mode > -1 {
+				t.keyModeCounts.Push(stats.SpotifyKeyModeToString(feature.Key, feature.Mode))
+			}
+		}
+		// time signatures range from 3 to 7 - anything else is unknown
+		if feature.TimeSignature >= 3 && feature.TimeSignature <= 7 {
+			t.timeSignatureCounts.Push(stats.SpotifyTimeSignatureToString(feature.TimeSignature))
+		}
+
+		track := t.trackIDLookup[feature.ID]
+		releaseYear := math.NaN()
+		if releaseDate, err := track.Album.ParseReleaseDate(); err == nil {
+			releaseYear = float64(releaseDate.Year())
+		}
+		t.featureVectors.Push(feature.ID,
+			feature.Energy*100, feature.Danceability*100, feature.Valence*100, feature.Acousticness*100,
+			feature.Speechiness*100, feature.Instrumentalness*100, feature.Liveness*100, feature.Tempo,
+			feature.Loudness, float64(feature.DurationMillis)/1000, track.Popularity, releaseYear,
+		)
+
+		if t.streaming {
+			continue
+		}
+		t.positivityGraphData = append(t.positivityGraphData, PositivityGraphPoint{
+			Positivity: feature.Valence * 100,
+			Popularity: track.Popularity,
+			Energy:     normaliseBetweenRange(0, 1, 0, 3, feature.Energy),
+			Track:      track.GetTrackString(),
+		})
+		t.trackPoints = append(t.trackPoints, TrackPoint{
+			Track:      track.GetTrackString(),
+			Positivity: feature.Valence * 100,
+			Popularity: track.Popularity,
+			Energy:     feature.Energy * 100,
+		})
+	}
+}
+
+// prune discards the details of the tracks which Calc won't look up, i.e. which aren't a candidate for the min, max,
+// median or a percentile of any of the aggregated Groups or the given extra Groups, a correlation example or a mood
+// representative.
+func (t *trackAggregator) prune(extra ...*stats.Group) {
+	ids := make(map[string]struct{}, len(t.trackIDLookup))
+	for _, g := range append(t.groups(), extra...) {
+		g.CollectIDs(ids)
+	}
+	t.featureVectors.CollectIDs(ids)
+	t.moods.CollectIDs(ids)
+	for id := range t.trackIDLookup {
+		if _, ok := ids[id]; !ok {
+			delete(t.trackIDLookup, id)
+		}
+	}
+}
+
+// ItemCount returns the number of playlist items pushed, including those which were skipped.
+func (t *trackAggregator) ItemCount() int {
+	return t.itemCount
+}
+
+// TrackCount returns the number of tracks aggregated.
+func (t *trackAggregator) TrackCount() int {
+	return t.trackCount
+}
+
+// Skipped returns the number of items skipped, by item kind.
+func (t *trackAggregator) Skipped() stats.Mapping {
+	return t.skippedMapping
+}
+
+// Calc performs the final calculations on each stat and returns the stats payload. It must only be called once.
+func (t *trackAggregator) Calc(logger config.Logger) PlaylistStats {
+	// determine the playlist age/generation
+	t.releaseDates.Calc(t.trackIDLookup, stats.ToDateString())
+	generation, err := stats.GetGeneration(t.releaseDates.Mean.DateYear())
+	if err != nil {
+		// don't error out - we can still display all the other data
+		logger.Error("failed to determine playlist generation", zap.Error(err),
+			zap.Int("avg_year", t.releaseDates.Mean.DateYear()))
+	}
+
+	// perform final calculations on each stat and lookup track names
+	t.popularity.Calc(t.trackIDLookup)
+	// outliers skew the average tempo and duration, so also report their spread
+	outerPercentiles := stats.WithPercentiles(10, 90)
+	t.trackDuration.Calc(t.trackIDLookup, stats.ToDurationString(), outerPercentiles)
+	t.tempo.Calc(t.trackIDLookup, outerPercentiles)
+	t.loudness.Calc(t.trackIDLookup, stats.ToDecibelString())
+	// process the following stats from decimal to percentages
+	toPercentage := stats.WithMultiplier(100)
+	t.energy.Calc(t.trackIDLookup, toPercentage)
+	t.danceability.Calc(t.trackIDLookup, toPercentage)
+	t.valence.Calc(t.trackIDLookup, toPercentage)
+	t.acousticness.Calc(t.trackIDLookup, toPercentage)
+	t.speechiness.Calc(t.trackIDLookup, toPercentage)
+	t.instrumentalness.Calc(t.trackIDLookup, toPercentage)
+	t.liveness.Calc(t.trackIDLookup, toPercentage)
+
+	return PlaylistStats{
+		Raw: FeatureStats{
+			Popularity:       t.popularity,
+			Energy:           t.energy,
+			Danceability:     t.danceability,
+			Valence:          t.valence,
+			Acousticness:     t.acousticness,
+			Speechiness:      t.speechiness,
+			Instrumentalness: t.instrumentalness,
+			Liveness:         t.liveness,
+			ReleaseDates:     t.releaseDates,
+			TrackDurations:   t.trackDuration,
+			Tempo:            t.tempo,
+			Loudness:         t.loudness,
+		},
+		Explicitness: t.explicitMapping,
+		ReleaseDates: t.releaseDatesMapping.OrderedLabelsAndValues(
+			stats.WithSort(stats.SortKey, false),
+		),
+		Generation: generation,
+		TopTitleWords: t.titleWordMapping.OrderedLabelsAndValues(
+			stats.WithSort(stats.SortValue, true),
+			stats.WithTruncate(50),
+		),
+		TopArtists: t.artistWordMapping.OrderedLabelsAndValues(
+			stats.WithSort(stats.SortValue, true),
+			stats.WithTruncate(50),
+		),
+		PitchKey: t.pitchKeyCounts.OrderedLabelsAndValues(
+			stats.WithSort(stats.SortPitchKey, false),
+		),
+		Mode: t.modeCounts,
+		KeyMode: t.keyModeCounts.OrderedLabelsAndValues(
+			stats.WithSort(stats.SortPitchKey, false),
+		),
+		TimeSignature: t.timeSignatureCounts.OrderedLabelsAndValues(
+			stats.WithSort(stats.SortKey, false),
+		),
+		Histograms: FeatureHistograms{
+			Energy:       t.energyBins.Calc(),
+			Valence:      t.valenceBins.Calc(),
+			Danceability: t.danceabilityBins.Calc(),
+			Tempo:        t.tempoBins.Calc(),
+			Duration:     t.durationBins.Calc(),
+			Popularity:   t.popularityBins.Calc(),
+		},
+		Correlations:        t.featureVectors.Correlate(t.trackIDLookup),
+		Mood:                t.moods.Calc(t.trackIDLookup),
+		PositivityGraphData: t.positivityGraphData,
+	}
+}
+
+// TrackPoints returns the positivity, popularity and energy of each track aggregated with audio features. It is empty
+// when streaming.
+func (t *trackAggregator) TrackPoints() []TrackPoint {
+	return t.trackPoints
+}
+
+func normaliseBetweenRange(a0, a1, b0, b1, a float64) float64 {
+	return b0 + (b1-b0)*((a-a0)/(a1-a0))
+}
+
+// audioFeatureLookup collects tracks and their audio features by track ID.
+type audioFeatureLookup struct {
+	tracks   map[string]spotify.TrackDetails
+	features map[string]spotify.AudioFeatures
+}
+
+var _ aggregator = (*audioFeatureLookup)(nil)
+
+func newAudioFeatureLookup() *audioFeatureLookup {
+	return &audioFeatureLookup{
+		tracks:   make(map[string]spotify.TrackDetails),
+		features: make(map[string]spotify.AudioFeatures),
+	}
+}
+
+// PushTracks stores the given tracks, returning the IDs of those not already stored.
+func (l *audioFeatureLookup) PushTracks(items []spotify.TrackItem) []string {
+	trackIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.Kind() != spotify.ItemTrack {
+			continue
+		}
+		if _, ok := l.tracks[item.TrackDetails.ID]; ok {
+			continue
+		}
+		l.tracks[item.TrackDetails.ID] = *item.TrackDetails
+		trackIDs = append(trackIDs, item.TrackDetails.ID)
+	}
+	return trackIDs
+}
+
+// PushAudioFeatures stores the given audio features.
+func (l *audioFeatureLookup) PushAudioFeatures(audioFeatures []spotify.AudioFeatures) {
+	for _, feature := range audioFeatures {
+		l.features[feature.ID] = feature
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+func TestStreamingTrackAggregatorRetainsBoundedState(t *testing.T) {
+	const (
+		sampleSize = 20
+		batches    = 25
+		batchSize  = 200
+		// each Group retains a sample of tracks along with its min and max tracks, the correlations retain a sample
+		// of tracks, and each mood retains a representative track
+		maxRetained = 12*(sampleSize+2) + sampleSize + 4
+	)
+	rng := rand.New(rand.NewSource(1))
+	agg := newStreamingTrackAggregator(sampleSize)
+
+	for b := 0; b < batches; b++ {
+		items := make([]spotify.TrackItem, 0, batchSize)
+		features := make([]spotify.AudioFeatures, 0, batchSize)
+		for i := 0; i < batchSize; i++ {
+			id := strconv.Itoa(b*batchSize + i)
+			details := &spotify.TrackDetails{
+				ID:         id,
+				Type:       "track",
+				Name:       "Track " + id,
+				Popularity: float64(rng.Intn(101)),
+				Album:      spotify.Album{ReleaseDate: strconv.Itoa(1960 + rng.Intn(60)), ReleaseDatePrecision: "year"},
+			}
+			items = append(items, spotify.TrackItem{TrackDetails: details})
+			features = append(features, spotify.AudioFeatures{
+				ID:             id,
+				Energy:         rng.Float64(),
+				Valence:        rng.Float64(),
+				Tempo:          60 + rng.Float64()*120,
+				DurationMillis: 120000 + rng.Intn(240000),
+				Key:            rng.Intn(12),
+				Mode:           rng.Intn(2),
+				TimeSignature:  4,
+			})
+		}
+		agg.PushTracks(items)
+		agg.PushAudioFeatures(features)
+
+		if got := len(agg.trackIDLookup); got > maxRetained {
+			t.Fatalf("retained the details of %d tracks after batch %d, want at most %d", got, b+1, maxRetained)
+		}
+		if len(agg.positivityGraphData) > 0 || len(agg.trackPoints) > 0 {
+			t.Fatalf("retained per-track chart data after batch %d, want none", b+1)
+		}
+	}
+
+	// the stats are still calculated from every track, and the tracks they refer to can still be looked up
+	playlistStats := agg.Calc(zap.NewNop())
+	if got := agg.TrackCount(); got != batches*batchSize {
+		t.Errorf("got %d tracks aggregated, want %d", got, batches*batchSize)
+	}
+	classified := 0
+	for _, quadrant := range playlistStats.Mood.Quadrants {
+		classified += quadrant.Count
+		if quadrant.Representative == nil || quadrant.Representative.Name == "" {
+			t.Errorf("got no %s representative track, want its details to be retained", quadrant.Mood)
+		}
+	}
+	if classified != batches*batchSize {
+		t.Errorf("got %d tracks classified into moods, want %d", classified, batches*batchSize)
+	}
+	energy := playlistStats.Raw.Energy
+	names := map[string]string{"min": energy.Min.Name, "max": energy.Max.Name, "median": energy.Median.Name}
+	for name, trackName := range names {
+		if trackName == "" {
+			t.Errorf("got no %s energy track, want its details to be retained", name)
+		}
+	}
+	if got := energy.Median.ValueOut.(float64); got < 40 || got > 60 {
+		t.Errorf("got median energy %v estimated from the sample, want around 50", got)
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/playlistio"
+)
+
+// maxPlaylistUploadBytes limits the size of playlist file uploads.
+const maxPlaylistUploadBytes = 32 << 20
+
+// AnalyseHandler analyses an uploaded playlist file, e.g. a CSV file exported by Exportify or an M3U or XSPF playlist,
+// returning the same stats payload as PlaylistsHandler. The file is uploaded either as a multipart form or in the
+// request body. Its format is determined by the format query parameter if set, otherwise by the file name or media
+// type, falling back to its contents. Only the audio features included in the file are analysed, so the Spotify API is
+// not required.
+func (a API) AnalyseHandler(w http.ResponseWriter, r *http.Request) {
+	logger := a.logger.With(zap.String("addr", r.RemoteAddr))
+
+	var format playlistio.Format
+	if rawFormat := r.URL.Query().Get("format"); rawFormat != "" {
+		var err error
+		if format, err = playlistio.ParseFormat(rawFormat); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPlaylistUploadBytes)
+	imported, err := readPlaylistUpload(r, format)
+	if err != nil {
+		logger.Info("failed to read playlist upload", zap.Error(err))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	playlistData := imported.Playlist
+	logger.Info("playlist analysis API request", zap.String("playlist", playlistData.Name),
+		zap.Int("tracks", len(playlistData.Tracks.TrackItems)))
+
+	aggregator := newTrackAggregator(len(playlistData.Tracks.TrackItems), a.moodOpts()...)
+	if err := aggregateTracks(r.Context(), logger, imported, aggregator, playlistData.Tracks.TrackItems); err != nil {
+		writeSourceError(w, logger, "failed to aggregate playlist file", err)
+		return
+	}
+	writeJSON(w, logger, newPlaylistResponse(logger, playlistData, aggregator))
+}
+
+// readPlaylistUpload reads the first file of a multipart form upload, or otherwise the request body. If format is
+// empty, it is determined from the file name or media type, falling back to the file contents.
+func readPlaylistUpload(r *http.Request, format playlistio.Format) (playlistio.Import, error) {
+	name, mediaType := "request body", r.Header.Get("Content-Type")
+	var body io.Reader = r.Body
+
+	reader, err := r.MultipartReader()
+	switch {
+	case errors.Is(err, http.ErrNotMultipart):
+	case err != nil:
+		return playlistio.Import{}, err
+	default:
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				return playlistio.Import{}, errors.New("no playlist file uploaded")
+			}
+			if err != nil {
+				return playlistio.Import{}, err
+			}
+			if part.FileName() != "" {
+				name, mediaType, body = part.FileName(), part.Header.Get("Content-Type"), part
+				break
+			}
+		}
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return playlistio.Import{}, err
+	}
+	if format == "" {
+		if format, err = playlistio.ParseFormat(mediaType); err != nil {
+			return playlistio.ReadFile(name, data)
+		}
+	}
+	return playlistio.Read(name, data, format)
+}
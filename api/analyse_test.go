@@ -0,0 +1,51 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/api"
+	"github.com/jemgunay/spotify-unwrapped/config"
+)
+
+func TestAnalyseHandlerSkipsUnknownModes(t *testing.T) {
+	const data = `Track URI,Track Name,Energy,Valence,Tempo,Key,Mode
+spotify:track:a,A,0.5,0.5,120,9,0
+spotify:track:b,B,0.5,0.5,120,9,1
+spotify:track:c,C,0.5,0.5,120,9,
+`
+	handlers := api.New(zap.NewNop(), config.API{}, nil)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/analyse?format=csv", strings.NewReader(data))
+	handlers.AnalyseHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", w.Code)
+	}
+
+	var resp api.PlaylistResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	if got := resp.Stats.Mode; got["major"] != 1 || got["minor"] != 1 {
+		t.Errorf("got mode counts %v, want the track without a mode left out", got)
+	}
+	if got := sum(resp.Stats.KeyMode.Values); got != 2 {
+		t.Errorf("got %d key signatures, want the track without a mode left out", got)
+	}
+	if got := sum(resp.Stats.PitchKey.Values); got != 3 {
+		t.Errorf("got %d pitch keys, want all 3 tracks counted", got)
+	}
+}
+
+func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
@@ -1,11 +1,11 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"math"
+	"fmt"
 	"net/http"
-	"strconv"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
@@ -15,205 +15,263 @@ import (
 	"github.com/jemgunay/spotify-unwrapped/stats"
 )
 
+// AudioFeaturesSource provides track audio feature data.
+type AudioFeaturesSource interface {
+	// GetAudioFeatures gets the audio features for the given track IDs. Partial results may be returned alongside a
+	// *spotify.AudioFeaturesError.
+	GetAudioFeatures(ctx context.Context, trackIDs []string) ([]spotify.AudioFeatures, error)
+}
+
+// PlaylistSource provides playlist and track audio feature data. It is satisfied by spotify.Requester.
+type PlaylistSource interface {
+	AudioFeaturesSource
+	// GetPlaylist gets the playlist, including all of its tracks, for the given playlist ID. spotify.ErrNotFound is
+	// returned if the playlist does not exist.
+	GetPlaylist(ctx context.Context, id string) (spotify.Playlist, error)
+	// StreamPlaylist gets the playlist for the given playlist ID, passing each page of its tracks to fn in order
+	// rather than accumulating them in the returned playlist.
+	StreamPlaylist(ctx context.Context, id string, fn func(spotify.Tracks) error) (spotify.Playlist, error)
+}
+
+var _ PlaylistSource = (*spotify.Requester)(nil)
+
+// streamAudioFeaturesBatchSize is the number of streamed tracks to accumulate before fetching their audio features.
+const streamAudioFeaturesBatchSize = 500
+
+// streamSampleSize is the number of streamed tracks sampled to estimate distribution stats and correlations from.
+const streamSampleSize = 1000
+
 // API is an API which also performs track data collection and aggregation.
 type API struct {
-	logger     config.Logger
-	spotifyReq spotify.Requester
+	conf   config.API
+	logger config.Logger
+	source PlaylistSource
+	users  UserSources
+}
+
+// Opt defines an API option.
+type Opt func(*API)
+
+// WithAuth enables the user-scoped handlers, which analyse the listening data of the logged in user.
+func WithAuth(auth *Auth) Opt {
+	return WithUserSources(auth)
+}
+
+// WithUserSources enables the user-scoped handlers, using the given UserSources to determine the logged in user's
+// source, e.g. to analyse fake listening data in tests.
+func WithUserSources(users UserSources) Opt {
+	return func(a *API) {
+		a.users = users
+	}
 }
 
 // New returns a Spotify API.
-func New(logger config.Logger, spotifyReq spotify.Requester) API {
-	return API{
-		logger:     logger,
-		spotifyReq: spotifyReq,
+func New(logger config.Logger, conf config.API, source PlaylistSource, opts ...Opt) API {
+	a := API{
+		conf:   conf,
+		logger: logger,
+		source: source,
+	}
+	for _, opt := range opts {
+		opt(&a)
+	}
+	return a
+}
+
+// moodOpts configures the mood classification of aggregated tracks. Unset or out of range thresholds are left at
+// their defaults.
+func (a API) moodOpts() []stats.MoodOpt {
+	valence, energy := a.conf.MoodValenceThreshold, a.conf.MoodEnergyThreshold
+	if valence <= 0 || valence > 1 || energy <= 0 || energy > 1 {
+		return nil
 	}
+	return []stats.MoodOpt{stats.WithMoodThresholds(valence, energy)}
 }
 
 // PlaylistsHandler processes the given Spotify playlist data used to drive visualisations.
 func (a API) PlaylistsHandler(w http.ResponseWriter, r *http.Request) {
+	playlistData, aggregator, logger, ok := a.aggregatePlaylist(w, r, "playlist API request")
+	if !ok {
+		return
+	}
+	writeJSON(w, logger, newPlaylistResponse(logger, playlistData, aggregator))
+}
+
+// PlaylistsV2Handler processes the given Spotify playlist data into the v2 stats payload.
+func (a API) PlaylistsV2Handler(w http.ResponseWriter, r *http.Request) {
+	playlistData, aggregator, logger, ok := a.aggregatePlaylist(w, r, "playlist v2 API request")
+	if !ok {
+		return
+	}
+	writeJSON(w, logger, PlaylistResponseV2{
+		Metadata: newPlaylistMetadata(playlistData, aggregator),
+		Stats:    newPlaylistStatsV2(aggregator.Calc(logger), aggregator.TrackPoints()),
+	})
+}
+
+// aggregatePlaylist fetches and aggregates the playlist data for the requested playlist ID. If it fails, the error
+// response is written and false is returned.
+func (a API) aggregatePlaylist(w http.ResponseWriter, r *http.Request, msg string) (
+	spotify.Playlist, *trackAggregator, config.Logger, bool) {
 	vars := mux.Vars(r)
 	playlistID := vars["playlistID"]
 
 	logger := a.logger.With(zap.String("playlist", playlistID), zap.String("addr", r.RemoteAddr))
-	logger.Info("playlist API request")
-
-	// fetch playlist data for given playlist ID
-	playlistData, err := a.spotifyReq.GetPlaylist(playlistID)
-	if err != nil {
-		logger.Error("failed to fetch playlist data", zap.Error(err))
-		if errors.Is(err, spotify.ErrNotFound) {
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	logger.Info(msg, zap.Bool("streaming", a.conf.StreamPlaylists))
 
+	// fetch and aggregate playlist data for given playlist ID
 	var (
-		popularity          stats.Group
-		releaseDates        stats.Group
-		releaseDatesMapping = stats.NewMapping(10)
-		explicitMapping     = stats.NewMapping(2, "non-explicit", "explicit")
-		titleWordMapping    = stats.NewMapping(100)
-		artistWordMapping   = stats.NewMapping(100)
-		trackIDsList        = make([]string, 0, len(playlistData.Tracks.TrackItems))
-		trackIDLookup       = make(map[string]spotify.TrackDetails, len(playlistData.Tracks.TrackItems))
+		playlistData spotify.Playlist
+		aggregator   *trackAggregator
+		err          error
 	)
-
-	for _, track := range playlistData.Tracks.TrackItems {
-		trackIDsList = append(trackIDsList, track.TrackDetails.ID)
-		trackIDLookup[track.TrackDetails.ID] = track.TrackDetails
-		// aggregate track popularity
-		popularity.Push(track.TrackDetails.ID, track.TrackDetails.Popularity)
-		// aggregate by release year
-		releaseDate, err := track.TrackDetails.Album.ParseReleaseDate()
-		if err == nil {
-			// sometimes tracks don't have release date metadata - skip them from this stat
-			releaseDatesMapping.Push(strconv.Itoa(releaseDate.Year()))
-			releaseDates.Push(track.TrackDetails.ID, float64(releaseDate.Unix()))
-		}
-
-		// count explicit vs explicit tracks
-		explicit := "non-explicit"
-		if track.TrackDetails.Explicit {
-			explicit = "explicit"
-		}
-		explicitMapping.Push(explicit)
-
-		// count unique sentence title words
-		stats.CountWordsInSentence(track.TrackDetails.Name, titleWordMapping)
-		for _, artist := range track.TrackDetails.Artists {
-			artistWordMapping.Push(artist.Name)
-		}
-	}
-
-	// determine the playlist age/generation
-	releaseDates.Calc(trackIDLookup, stats.ToDateString())
-	generation, err := stats.GetGeneration(releaseDates.Mean.DateYear())
+	if a.conf.StreamPlaylists {
+		playlistData, aggregator, err = a.streamPlaylist(r.Context(), logger, playlistID)
+	} else {
+		playlistData, aggregator, err = a.fetchPlaylist(r.Context(), logger, playlistID)
+	}
 	if err != nil {
-		// don't error out - we can still display all the other data
-		logger.Error("failed to determine playlist generation", zap.Error(err),
-			zap.Int("avg_year", releaseDates.Mean.DateYear()))
+		writeSourceError(w, logger, "failed to fetch playlist data", err)
+		return playlistData, nil, logger, false
 	}
+	return playlistData, aggregator, logger, true
+}
 
-	// bulk fetch audio feature data for each track in playlist
-	audioFeatures, err := a.spotifyReq.GetAudioFeatures(trackIDsList)
-	if err != nil {
+// newPlaylistResponse generates the v1 stats payload for an aggregated playlist.
+func newPlaylistResponse(logger config.Logger, playlistData spotify.Playlist,
+	aggregator *trackAggregator) PlaylistResponse {
+	return PlaylistResponse{
+		Metadata: newPlaylistMetadata(playlistData, aggregator),
+		Stats:    aggregator.Calc(logger),
+	}
+}
+
+// writeSourceError logs an error returned by a data source and writes the equivalent response status.
+func writeSourceError(w http.ResponseWriter, logger config.Logger, msg string, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		logger.Info("API request cancelled by client")
+	case errors.Is(err, spotify.ErrNotFound):
+		logger.Error(msg, zap.Error(err))
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, spotify.ErrUnauthorised):
+		// e.g. the user has revoked access to the application
+		logger.Info(msg, zap.Error(err))
+		w.WriteHeader(http.StatusUnauthorized)
+	default:
+		logger.Error(msg, zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
-		logger.Error("failed to fetch audio feature data", zap.Error(err))
-		return
 	}
+}
 
-	// aggregate track audio feature metadata for each stat
-	var energy, danceability, valence, acousticness, speechiness, instrumentalness, liveness stats.Group
-	var trackDuration, tempo stats.Group
-	pitchKeyCounts := stats.NewMapping(12, stats.PitchKeys...)
-	positivityGraphData := make([]positivityGraphPoint, 0, len(audioFeatures))
-
-	for _, feature := range audioFeatures {
-		energy.Push(feature.ID, feature.Energy)
-		danceability.Push(feature.ID, feature.Danceability)
-		valence.Push(feature.ID, feature.Valence)
-		acousticness.Push(feature.ID, feature.Acousticness)
-		speechiness.Push(feature.ID, feature.Speechiness)
-		instrumentalness.Push(feature.ID, feature.Instrumentalness)
-		liveness.Push(feature.ID, feature.Liveness)
-		trackDuration.Push(feature.ID, float64(feature.DurationMillis))
-		tempo.Push(feature.ID, math.Round(feature.Tempo))
-
-		// -1 is Spotify's unknown key value
-		if feature.Key > -1 {
-			pitchKeyCounts.Push(stats.SpotifyKeyToPitchKey(feature.Key))
-		}
-
-		track := trackIDLookup[feature.ID]
-		positivityGraphData = append(positivityGraphData, positivityGraphPoint{
-			Positivity: feature.Valence * 100,
-			Popularity: trackIDLookup[feature.ID].Popularity,
-			Energy:     normaliseBetweenRange(0, 1, 0, 3, feature.Energy),
-			Track:      track.GetTrackString(),
-		})
-	}
-
-	// perform final calculations on each stat and lookup track names
-	popularity.Calc(trackIDLookup)
-	trackDuration.Calc(trackIDLookup, stats.ToDurationString())
-	tempo.Calc(trackIDLookup)
-	// process the following stats from decimal to percentages
-	toPercentage := stats.WithMultiplier(100)
-	energy.Calc(trackIDLookup, toPercentage)
-	danceability.Calc(trackIDLookup, toPercentage)
-	valence.Calc(trackIDLookup, toPercentage)
-	acousticness.Calc(trackIDLookup, toPercentage)
-	speechiness.Calc(trackIDLookup, toPercentage)
-	instrumentalness.Calc(trackIDLookup, toPercentage)
-	liveness.Calc(trackIDLookup, toPercentage)
-
-	// generate final response payload
-	statsPayload := map[string]any{
-		"metadata": map[string]any{
-			"name": playlistData.Name,
-			"owner": map[string]any{
-				"name":        playlistData.Owner.DisplayName,
-				"spotify_url": playlistData.Owner.ExternalURLs.Spotify,
-			},
-			"image":       playlistData.Images.First(),
-			"spotify_url": playlistData.ExternalURLs.Spotify,
-			"track_count": playlistData.Tracks.Total,
-		},
-		"stats": map[string]any{
-			"raw": map[string]any{
-				"popularity":       popularity,
-				"energy":           energy,
-				"danceability":     danceability,
-				"valence":          valence,
-				"acousticness":     acousticness,
-				"speechiness":      speechiness,
-				"instrumentalness": instrumentalness,
-				"liveness":         liveness,
-				"release_dates":    releaseDates,
-				"track_durations":  trackDuration,
-				"tempo":            tempo,
-			},
-			"explicitness": explicitMapping,
-			"release_dates": releaseDatesMapping.OrderedLabelsAndValues(
-				stats.WithSort(stats.SortKey, false),
-			),
-			"generation": generation,
-			"top_title_words": titleWordMapping.OrderedLabelsAndValues(
-				stats.WithSort(stats.SortValue, true),
-				stats.WithTruncate(50),
-			),
-			"top_artists": artistWordMapping.OrderedLabelsAndValues(
-				stats.WithSort(stats.SortValue, true),
-				stats.WithTruncate(50),
-			),
-			"pitch_key": pitchKeyCounts.OrderedLabelsAndValues(
-				stats.WithSort(stats.SortPitchKey, false),
-			),
-			"positivity_graph_data": positivityGraphData,
-		},
-	}
-
-	respBody, err := json.Marshal(statsPayload)
+// writeJSON writes the JSON encoded payload as the response body.
+func writeJSON(w http.ResponseWriter, logger config.Logger, payload any) {
+	respBody, err := json.Marshal(payload)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		logger.Error("failed to JSON marshal playlist API data", zap.Error(err))
+		logger.Error("failed to JSON marshal API data", zap.Error(err))
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(respBody)
 }
 
-// positivityGraphPoint is the format expected by the positivity/popularity/energy bubble graph. Energy levels are
-// represented by the point radius. Track metadata is also provided for tooltip hover,
-type positivityGraphPoint struct {
-	Positivity float64 `json:"x"`
-	Popularity float64 `json:"y"`
-	Energy     float64 `json:"r"`
-	Track      string  `json:"track"`
+// fetchPlaylist fetches the entire playlist before aggregating its tracks and their audio features.
+func (a API) fetchPlaylist(ctx context.Context, logger config.Logger, playlistID string) (
+	spotify.Playlist, *trackAggregator, error) {
+	playlistData, err := a.source.GetPlaylist(ctx, playlistID)
+	if err != nil {
+		return playlistData, nil, err
+	}
+
+	aggregator := newTrackAggregator(len(playlistData.Tracks.TrackItems), a.moodOpts()...)
+	err = aggregateTracks(ctx, logger, a.source, aggregator, playlistData.Tracks.TrackItems)
+	return playlistData, aggregator, err
+}
+
+// streamPlaylist aggregates the playlist page by page as its tracks are fetched, fetching audio features in batches
+// of streamed tracks.
+func (a API) streamPlaylist(ctx context.Context, logger config.Logger, playlistID string) (
+	spotify.Playlist, *trackAggregator, error) {
+	aggregator := newStreamingTrackAggregator(streamSampleSize, a.moodOpts()...)
+	stream := newTrackStream(ctx, logger, a.source, aggregator)
+
+	playlistData, err := a.source.StreamPlaylist(ctx, playlistID, stream.Push)
+	if err != nil {
+		return playlistData, nil, err
+	}
+	if err := stream.Flush(); err != nil {
+		return playlistData, nil, err
+	}
+	return playlistData, aggregator, nil
+}
+
+// aggregateTracks aggregates the given track items and their audio features.
+func aggregateTracks(ctx context.Context, logger config.Logger, source AudioFeaturesSource, agg aggregator,
+	items []spotify.TrackItem) error {
+	trackIDs := agg.PushTracks(items)
+	return pushAudioFeatures(ctx, logger, source, agg, trackIDs)
 }
 
-func normaliseBetweenRange(a0, a1, b0, b1, a float64) float64 {
-	return b0 + (b1-b0)*((a-a0)/(a1-a0))
+// trackStream aggregates pages of streamed tracks, fetching audio features in batches of streamed tracks.
+type trackStream struct {
+	ctx        context.Context
+	logger     config.Logger
+	source     AudioFeaturesSource
+	agg        aggregator
+	pendingIDs []string
+}
+
+func newTrackStream(ctx context.Context, logger config.Logger, source AudioFeaturesSource,
+	agg aggregator) *trackStream {
+	return &trackStream{
+		ctx:        ctx,
+		logger:     logger,
+		source:     source,
+		agg:        agg,
+		pendingIDs: make([]string, 0, streamAudioFeaturesBatchSize),
+	}
+}
+
+// Push aggregates a page of tracks, fetching the audio features of the pending tracks once a batch has accumulated.
+func (s *trackStream) Push(page spotify.Tracks) error {
+	s.pendingIDs = append(s.pendingIDs, s.agg.PushTracks(page.TrackItems)...)
+	if len(s.pendingIDs) < streamAudioFeaturesBatchSize {
+		return nil
+	}
+	return s.Flush()
+}
+
+// Flush fetches and aggregates the audio features of the pending tracks. It must be called once streaming has
+// finished.
+func (s *trackStream) Flush() error {
+	err := pushAudioFeatures(s.ctx, s.logger, s.source, s.agg, s.pendingIDs)
+	s.pendingIDs = s.pendingIDs[:0]
+	return err
+}
+
+// pushAudioFeatures bulk fetches audio feature data for the given tracks and pushes it into the aggregator. Partial
+// failures are logged rather than returned, so that the audio features which were fetched can still be aggregated.
+func pushAudioFeatures(ctx context.Context, logger config.Logger, source AudioFeaturesSource, agg aggregator,
+	trackIDs []string) error {
+	if len(trackIDs) == 0 {
+		return nil
+	}
+
+	audioFeatures, err := source.GetAudioFeatures(ctx, trackIDs)
+	var audioFeaturesErr *spotify.AudioFeaturesError
+	switch {
+	case err == nil:
+	case errors.As(err, &audioFeaturesErr) && len(audioFeatures) > 0:
+		// don't error out - aggregate the audio features which were successfully fetched
+		logger.Warn("failed to fetch some audio feature data", zap.Error(err),
+			zap.Int("failed_batches", len(audioFeaturesErr.Batches)),
+			zap.Int("total_batches", audioFeaturesErr.TotalBatches))
+	default:
+		return fmt.Errorf("failed to fetch audio feature data: %w", err)
+	}
+
+	agg.PushAudioFeatures(audioFeatures)
+	return nil
 }
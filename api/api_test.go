@@ -0,0 +1,295 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/api"
+	"github.com/jemgunay/spotify-unwrapped/config"
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/spotify/spotifytest"
+	"github.com/jemgunay/spotify-unwrapped/stats"
+)
+
+// testRetryPolicy retries quickly so that injected faults don't slow the tests down.
+var testRetryPolicy = spotify.RetryPolicy{
+	MaxAttempts:     3,
+	InitialInterval: time.Millisecond,
+	MaxInterval:     time.Millisecond * 10,
+	Multiplier:      2,
+}
+
+// newTestServer returns a fake Spotify server serving a playlist with the given number of tracks, each with audio
+// features. Every fifth track is more energetic than the rest.
+func newTestServer(t *testing.T, id string, trackCount int, opts ...spotifytest.ServerOpt) *spotifytest.Server {
+	t.Helper()
+	srv := spotifytest.NewServer(opts...)
+	t.Cleanup(srv.Close)
+
+	playlist := spotify.Playlist{ID: id, Name: "Playlist " + id}
+	for i := 0; i < trackCount; i++ {
+		details := &spotify.TrackDetails{
+			ID:         id + "-" + strconv.Itoa(i),
+			Type:       "track",
+			Name:       "Track " + strconv.Itoa(i),
+			Popularity: float64(i % 100),
+			Artists:    []spotify.Artist{{Name: "Artist " + strconv.Itoa(i%7)}},
+			Album:      spotify.Album{ReleaseDate: strconv.Itoa(1980 + i%40), ReleaseDatePrecision: "year"},
+		}
+		playlist.Tracks.TrackItems = append(playlist.Tracks.TrackItems, spotify.TrackItem{TrackDetails: details})
+
+		energy := 0.2
+		if i%5 == 0 {
+			energy = 0.9
+		}
+		srv.AddAudioFeatures(spotify.AudioFeatures{
+			ID:             details.ID,
+			Energy:         energy,
+			Valence:        float64(i%10) / 10,
+			Danceability:   0.5,
+			Tempo:          float64(90 + i%60),
+			Key:            i % 12,
+			Mode:           i % 2,
+			TimeSignature:  4,
+			DurationMillis: 180000 + i*1000,
+			Loudness:       -8,
+		})
+	}
+	srv.AddPlaylist(playlist)
+	return srv
+}
+
+// newTestRouter routes the playlist handlers of an API backed by a Requester targeting the fake server.
+func newTestRouter(t *testing.T, srv *spotifytest.Server, conf config.API, opts ...spotify.RequesterOpt) http.Handler {
+	t.Helper()
+	spotifyConf := srv.Config()
+	spotifyConf.Concurrency = 4
+	requester := spotify.New(zap.NewNop(), spotifyConf,
+		append([]spotify.RequesterOpt{spotify.WithRetryPolicy(testRetryPolicy)}, opts...)...)
+	t.Cleanup(requester.Close)
+
+	handlers := api.New(zap.NewNop(), conf, requester)
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/playlists/{playlistID}", handlers.PlaylistsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/playlists/{playlistID}/tracks", handlers.TracksHandler).Methods(http.MethodGet)
+	return r
+}
+
+// getPlaylist requests the playlist stats, decoding the response body if the request succeeded.
+func getPlaylist(t *testing.T, router http.Handler, id string) (int, api.PlaylistResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/playlists/"+id, nil))
+
+	var resp api.PlaylistResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %s", err)
+		}
+	}
+	return w.Code, resp
+}
+
+func TestPlaylistsHandler(t *testing.T) {
+	srv := newTestServer(t, "p", 237, spotifytest.WithPageSize(50))
+
+	for _, stream := range []bool{false, true} {
+		t.Run("stream="+strconv.FormatBool(stream), func(t *testing.T) {
+			router := newTestRouter(t, srv, config.API{StreamPlaylists: stream})
+			status, resp := getPlaylist(t, router, "p")
+			if status != http.StatusOK {
+				t.Fatalf("got status %d, want 200", status)
+			}
+
+			metadata := resp.Metadata
+			if metadata.Name != "Playlist p" || metadata.TrackCount != 237 || metadata.AnalysedTracks != 237 ||
+				metadata.Truncated {
+				t.Errorf("got metadata %+v, want all 237 tracks of Playlist p analysed", metadata)
+			}
+			// the per-track chart data isn't retained when streaming
+			wantPoints := 237
+			if stream {
+				wantPoints = 0
+			}
+			if got := len(resp.Stats.PositivityGraphData); got != wantPoints {
+				t.Errorf("got %d positivity graph points, want %d", got, wantPoints)
+			}
+			if got := resp.Stats.Explicitness["non-explicit"]; got != 237 {
+				t.Errorf("got %d non-explicit tracks, want 237", got)
+			}
+			// 48 of the 237 tracks have an energy of 90%, and the rest 20%
+			if got := resp.Stats.Raw.Energy.Max.ValueOut; got != 90.0 {
+				t.Errorf("got max energy %v, want 90", got)
+			}
+			if got := resp.Stats.Mood.Quadrants; len(got) != 4 {
+				t.Errorf("got %d mood quadrants, want 4", len(got))
+			}
+		})
+	}
+}
+
+func TestPlaylistsHandlerStreamingMatchesFetching(t *testing.T) {
+	srv := newTestServer(t, "p", 237, spotifytest.WithPageSize(50))
+
+	_, fetched := getPlaylist(t, newTestRouter(t, srv, config.API{}), "p")
+	_, streamed := getPlaylist(t, newTestRouter(t, srv, config.API{StreamPlaylists: true}), "p")
+	// the playlist is smaller than the streaming sample size, so only the omitted per-track chart data differs
+	fetched.Stats.PositivityGraphData = streamed.Stats.PositivityGraphData
+	if !reflect.DeepEqual(fetched, streamed) {
+		t.Error("streamed playlist stats differ from the fetched playlist stats")
+	}
+}
+
+func TestPlaylistsHandlerFaults(t *testing.T) {
+	tests := []struct {
+		name       string
+		playlistID string
+		fault      *spotifytest.Fault
+		opts       []spotify.RequesterOpt
+		want       int
+	}{
+		{
+			name:       "not found",
+			playlistID: "missing",
+			want:       http.StatusNotFound,
+		},
+		{
+			name:       "rate limited then recovered",
+			playlistID: "p",
+			fault: &spotifytest.Fault{
+				PathPrefix: "/v1/playlists/p/tracks",
+				Times:      2,
+				Status:     http.StatusTooManyRequests,
+			},
+			want: http.StatusOK,
+		},
+		{
+			name:       "rate limited persistently",
+			playlistID: "p",
+			fault: &spotifytest.Fault{
+				PathPrefix: "/v1/playlists/p",
+				Status:     http.StatusTooManyRequests,
+			},
+			want: http.StatusInternalServerError,
+		},
+		{
+			name:       "slow response retried",
+			playlistID: "p",
+			fault: &spotifytest.Fault{
+				PathPrefix: "/v1/audio-features",
+				Times:      1,
+				Delay:      time.Second,
+			},
+			opts: []spotify.RequesterOpt{spotify.WithHTTPClient(&http.Client{Timeout: time.Millisecond * 200})},
+			want: http.StatusOK,
+		},
+		{
+			name:       "malformed playlist",
+			playlistID: "p",
+			fault: &spotifytest.Fault{
+				PathPrefix: "/v1/playlists/p",
+				Times:      1,
+				Malformed:  true,
+			},
+			want: http.StatusInternalServerError,
+		},
+		{
+			name:       "malformed audio features",
+			playlistID: "p",
+			fault: &spotifytest.Fault{
+				PathPrefix: "/v1/audio-features",
+				Malformed:  true,
+			},
+			want: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, "p", 120, spotifytest.WithPageSize(50))
+			if tt.fault != nil {
+				srv.InjectFault(*tt.fault)
+			}
+			router := newTestRouter(t, srv, config.API{}, tt.opts...)
+
+			status, resp := getPlaylist(t, router, tt.playlistID)
+			if status != tt.want {
+				t.Fatalf("got status %d, want %d", status, tt.want)
+			}
+			if status == http.StatusOK && resp.Metadata.AnalysedTracks != 120 {
+				t.Errorf("got %d analysed tracks, want 120", resp.Metadata.AnalysedTracks)
+			}
+		})
+	}
+}
+
+func TestPlaylistsHandlerMoodThresholds(t *testing.T) {
+	srv := newTestServer(t, "p", 100)
+
+	tests := []struct {
+		name               string
+		conf               config.API
+		wantValence        float64
+		wantEnergy         float64
+		wantMood           stats.Mood
+		wantSadOrCalmCount int
+	}{
+		{
+			name:        "defaults",
+			wantValence: 50,
+			wantEnergy:  50,
+			// 80 tracks have an energy of 20%, of which half have a valence of at least 50%, so calm ties with sad
+			wantMood:           stats.MoodCalm,
+			wantSadOrCalmCount: 80,
+		},
+		{
+			name:               "configured",
+			conf:               config.API{MoodValenceThreshold: 0.95, MoodEnergyThreshold: 0.95},
+			wantValence:        95,
+			wantEnergy:         95,
+			wantMood:           stats.MoodSad,
+			wantSadOrCalmCount: 100,
+		},
+		{
+			name:               "out of range",
+			conf:               config.API{MoodValenceThreshold: 1.5, MoodEnergyThreshold: 0.95},
+			wantValence:        50,
+			wantEnergy:         50,
+			wantMood:           stats.MoodCalm,
+			wantSadOrCalmCount: 80,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := getPlaylist(t, newTestRouter(t, srv, tt.conf), "p")
+			if status != http.StatusOK {
+				t.Fatalf("got status %d, want 200", status)
+			}
+
+			mood := resp.Stats.Mood
+			if mood.ValenceThreshold != tt.wantValence || mood.EnergyThreshold != tt.wantEnergy {
+				t.Errorf("got thresholds %v/%v, want %v/%v", mood.ValenceThreshold, mood.EnergyThreshold,
+					tt.wantValence, tt.wantEnergy)
+			}
+			if mood.Mood != tt.wantMood {
+				t.Errorf("got mood %q, want %q", mood.Mood, tt.wantMood)
+			}
+			lowEnergy := 0
+			for _, quadrant := range mood.Quadrants {
+				if quadrant.Mood == stats.MoodSad || quadrant.Mood == stats.MoodCalm {
+					lowEnergy += quadrant.Count
+				}
+			}
+			if lowEnergy != tt.wantSadOrCalmCount {
+				t.Errorf("got %d low energy tracks, want %d", lowEnergy, tt.wantSadOrCalmCount)
+			}
+		})
+	}
+}
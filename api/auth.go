@@ -0,0 +1,234 @@
+package api
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/config"
+	"github.com/jemgunay/spotify-unwrapped/session"
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/spotify/auth"
+)
+
+const (
+	sessionCookieName = "unwrapped_session"
+	loginCookieName   = "unwrapped_login"
+	// loginTTL is how long a user has to complete the Spotify authorisation step of the login flow.
+	loginTTL = time.Minute * 10
+)
+
+// Auth implements the Authorization Code with PKCE login flow. Each logged in user's token is stored server-side,
+// keyed by a session ID which is stored in a signed cookie.
+type Auth struct {
+	conf      config.Auth
+	logger    config.Logger
+	flow      *auth.AuthorizationCode
+	requester *spotify.Requester
+	signer    session.Signer
+	// sessions maps session IDs to a Requester which performs requests on behalf of the session's user
+	sessions *session.Store[*spotify.Requester]
+	// logins maps the state parameter of in progress logins to their PKCE code verifier
+	logins *session.Store[string]
+}
+
+// NewAuth initialises an Auth. User requesters are derived from the given requester.
+func NewAuth(logger config.Logger, conf config.Auth, flow *auth.AuthorizationCode,
+	requester *spotify.Requester) (*Auth, error) {
+	secret := []byte(conf.SessionSecret)
+	if len(secret) == 0 {
+		logger.Warn("no session secret configured, generating one - sessions will not survive restarts")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate session secret: %w", err)
+		}
+	}
+
+	return &Auth{
+		conf:      conf,
+		logger:    logger,
+		flow:      flow,
+		requester: requester,
+		signer:    session.NewSigner(secret),
+		sessions:  session.NewStore(conf.SessionTTL, (*spotify.Requester).Close),
+		logins:    session.NewStore[string](loginTTL, nil),
+	}, nil
+}
+
+// LoginHandler starts the login flow by redirecting the user to Spotify to authorise the application.
+func (a *Auth) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	verifier, err := auth.NewRandomString()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		a.logger.Error("failed to generate PKCE code verifier", zap.Error(err))
+		return
+	}
+	state, err := a.logins.Create(verifier)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		a.logger.Error("failed to generate login state", zap.Error(err))
+		return
+	}
+
+	// bind the login to this browser to prevent login CSRF
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookieName,
+		Value:    a.signer.Sign(state),
+		Path:     "/auth/",
+		MaxAge:   int(loginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   a.conf.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, a.flow.AuthCodeURL(state, verifier), http.StatusFound)
+}
+
+// CallbackHandler completes the login flow once Spotify redirects the user back with an authorisation code. The code
+// is exchanged for a user token, a session is created and the user is redirected to the UI.
+func (a *Auth) CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	logger := a.logger.With(zap.String("addr", r.RemoteAddr))
+
+	// the login cookie is single use
+	http.SetCookie(w, &http.Cookie{
+		Name:   loginCookieName,
+		Path:   "/auth/",
+		MaxAge: -1,
+	})
+
+	if errParam := query.Get("error"); errParam != "" {
+		logger.Info("user did not authorise login", zap.String("error", errParam))
+		a.redirectToUI(w, r, errParam)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(loginCookieName)
+	if err != nil {
+		logger.Info("login callback missing login cookie")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	cookieState, ok := a.signer.Verify(cookie.Value)
+	if !ok || cookieState != state {
+		logger.Info("login callback state mismatch")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	verifier, ok := a.logins.Delete(state)
+	if !ok {
+		logger.Info("login callback state expired")
+		a.redirectToUI(w, r, "login_expired")
+		return
+	}
+
+	token, err := a.flow.Exchange(r.Context(), query.Get("code"), verifier)
+	if err != nil {
+		logger.Error("failed to exchange authorisation code", zap.Error(err))
+		a.redirectToUI(w, r, "exchange_failed")
+		return
+	}
+
+	userRequester := a.requester.ForUser(auth.NewUserTokenSource(a.flow, token))
+	sessionID, err := a.sessions.Create(userRequester)
+	if err != nil {
+		userRequester.Close()
+		w.WriteHeader(http.StatusInternalServerError)
+		logger.Error("failed to create session", zap.Error(err))
+		return
+	}
+
+	sameSite := http.SameSiteLaxMode
+	if a.conf.SecureCookies {
+		// allow the UI to be served from a different site to the API
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    a.signer.Sign(sessionID),
+		Path:     "/",
+		MaxAge:   int(a.sessions.TTL().Seconds()),
+		HttpOnly: true,
+		Secure:   a.conf.SecureCookies,
+		SameSite: sameSite,
+	})
+	logger.Info("user logged in")
+	a.redirectToUI(w, r, "")
+}
+
+// LogoutHandler deletes the user's session. The session cookie is sent with cross-site requests when SecureCookies is
+// enabled, so logouts from origins other than the UI or the API itself are rejected.
+func (a *Auth) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.allowedOrigin(r) {
+		w.WriteHeader(http.StatusForbidden)
+		a.logger.Warn("rejected cross-origin logout", zap.String("addr", r.RemoteAddr),
+			zap.String("origin", r.Header.Get("Origin")))
+		return
+	}
+	if sessionID, ok := a.sessionID(r); ok {
+		a.sessions.Delete(sessionID)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   sessionCookieName,
+		Path:   "/",
+		MaxAge: -1,
+	})
+	a.redirectToUI(w, r, "")
+}
+
+// UserSource returns the Requester for the logged in user making the request, if any.
+func (a *Auth) UserSource(r *http.Request) (UserSource, bool) {
+	sessionID, ok := a.sessionID(r)
+	if !ok {
+		return nil, false
+	}
+	requester, ok := a.sessions.Get(sessionID)
+	if !ok {
+		return nil, false
+	}
+	return requester, true
+}
+
+// allowedOrigin reports whether the request's Origin is the UI or the API itself. Requests without an Origin header,
+// i.e. from non-browser clients, are allowed.
+func (a *Auth) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if u.Host == r.Host {
+		return true
+	}
+	ui, err := url.Parse(a.conf.UIURL)
+	return err == nil && u.Scheme == ui.Scheme && u.Host == ui.Host
+}
+
+func (a *Auth) sessionID(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return "", false
+	}
+	return a.signer.Verify(cookie.Value)
+}
+
+// redirectToUI redirects the user to the UI, optionally reporting a login error.
+func (a *Auth) redirectToUI(w http.ResponseWriter, r *http.Request, loginErr string) {
+	target := a.conf.UIURL
+	if loginErr != "" {
+		if u, err := url.Parse(target); err == nil {
+			query := u.Query()
+			query.Set("login_error", loginErr)
+			u.RawQuery = query.Encode()
+			target = u.String()
+		}
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
@@ -0,0 +1,213 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/api"
+	"github.com/jemgunay/spotify-unwrapped/config"
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/spotify/auth"
+	"github.com/jemgunay/spotify-unwrapped/spotify/spotifytest"
+)
+
+// newTestApp serves the login flow and the top tracks endpoint, backed by the fake Spotify server for both the
+// accounts service and the API. The UI is stubbed out at /ui.
+func newTestApp(t *testing.T, srv *spotifytest.Server) *httptest.Server {
+	t.Helper()
+	r := mux.NewRouter()
+	app := httptest.NewServer(r)
+	t.Cleanup(app.Close)
+
+	spotifyConf := srv.Config()
+	requester := spotify.New(zap.NewNop(), spotifyConf, spotify.WithRetryPolicy(testRetryPolicy))
+	t.Cleanup(requester.Close)
+
+	authConf := config.Auth{
+		RedirectURL: app.URL + "/auth/callback",
+		SessionTTL:  time.Hour,
+		UIURL:       app.URL + "/ui",
+	}
+	flow := auth.NewAuthorizationCode(srv.Client(), spotifyConf.AccountsURL, spotifyConf.ClientID,
+		authConf.RedirectURL, []string{"user-top-read"})
+	authHandlers, err := api.NewAuth(zap.NewNop(), authConf, flow, requester)
+	if err != nil {
+		t.Fatalf("failed to initialise auth handlers: %s", err)
+	}
+	handlers := api.New(zap.NewNop(), config.API{}, requester, api.WithAuth(authHandlers))
+
+	r.HandleFunc("/auth/login", authHandlers.LoginHandler).Methods(http.MethodGet)
+	r.HandleFunc("/auth/callback", authHandlers.CallbackHandler).Methods(http.MethodGet)
+	r.HandleFunc("/auth/logout", authHandlers.LogoutHandler).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/me/top", handlers.TopHandler).Methods(http.MethodGet)
+	r.HandleFunc("/ui", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return app
+}
+
+// newTestBrowser returns a client which keeps cookies and follows redirects, like a browser.
+func newTestBrowser(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("failed to create cookie jar: %s", err)
+	}
+	return &http.Client{Jar: jar}
+}
+
+// do performs a request, returning the response status and the URL of the final response after redirects.
+func do(t *testing.T, client *http.Client, method, target string) (int, *url.URL) {
+	t.Helper()
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %s", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("failed to %s %s: %s", method, target, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, resp.Request.URL
+}
+
+func TestLoginFlow(t *testing.T) {
+	srv := spotifytest.NewServer()
+	t.Cleanup(srv.Close)
+	tracks := make([]*spotify.TrackDetails, 0, 10)
+	for i := 0; i < 10; i++ {
+		id := "top-" + strconv.Itoa(i)
+		tracks = append(tracks, &spotify.TrackDetails{ID: id, Type: "track", Name: "Track " + strconv.Itoa(i)})
+		srv.AddAudioFeatures(spotify.AudioFeatures{ID: id, Energy: 0.5, Valence: 0.5, TimeSignature: 4})
+	}
+	srv.SetTopItems(spotify.MediumTerm, tracks, []spotify.Artist{{Name: "Artist"}})
+
+	app := newTestApp(t, srv)
+	browser := newTestBrowser(t)
+	topURL := app.URL + "/api/v1/me/top?range=medium_term"
+
+	if status, _ := do(t, browser, http.MethodGet, topURL); status != http.StatusUnauthorized {
+		t.Fatalf("got status %d before logging in, want 401", status)
+	}
+
+	// login redirects to the fake accounts service, which approves it and redirects back to the callback, then the UI
+	status, final := do(t, browser, http.MethodGet, app.URL+"/auth/login")
+	if status != http.StatusOK || final.Path != "/ui" || final.Query().Get("login_error") != "" {
+		t.Fatalf("got status %d at %s after logging in, want the UI without a login error", status, final)
+	}
+	if status, _ := do(t, browser, http.MethodGet, topURL); status != http.StatusOK {
+		t.Fatalf("got status %d after logging in, want 200", status)
+	}
+
+	// revoked access tokens are refreshed, each time with the latest rotated refresh token
+	for i := 0; i < 2; i++ {
+		srv.RevokeTokens()
+		if status, _ := do(t, browser, http.MethodGet, topURL); status != http.StatusOK {
+			t.Fatalf("got status %d after revoking tokens %d times, want 200", status, i+1)
+		}
+	}
+
+	// logging out requires a POST, so can't be triggered by cross-site links or images
+	if status, _ := do(t, browser, http.MethodGet, app.URL+"/auth/logout"); status != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d logging out with GET, want 405", status)
+	}
+	if status, _ := do(t, browser, http.MethodGet, topURL); status != http.StatusOK {
+		t.Fatalf("got status %d after GET logout, want the session to remain", status)
+	}
+	if status, final := do(t, browser, http.MethodPost, app.URL+"/auth/logout"); status != http.StatusOK ||
+		final.Path != "/ui" {
+		t.Errorf("got status %d at %s after logging out, want the UI", status, final)
+	}
+	if status, _ := do(t, browser, http.MethodGet, topURL); status != http.StatusUnauthorized {
+		t.Errorf("got status %d after logging out, want 401", status)
+	}
+}
+
+func TestLogoutRejectsCrossOrigin(t *testing.T) {
+	srv := spotifytest.NewServer()
+	t.Cleanup(srv.Close)
+	app := newTestApp(t, srv)
+	browser := newTestBrowser(t)
+	topURL := app.URL + "/api/v1/me/top?range=medium_term"
+
+	if status, _ := do(t, browser, http.MethodGet, app.URL+"/auth/login"); status != http.StatusOK {
+		t.Fatalf("got status %d logging in, want 200", status)
+	}
+
+	logout := func(origin string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, app.URL+"/auth/logout", nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %s", err)
+		}
+		req.Header.Set("Origin", origin)
+		resp, err := browser.Do(req)
+		if err != nil {
+			t.Fatalf("failed to log out: %s", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// a form on another site posting to the logout endpoint, i.e. a logout CSRF attempt
+	for _, origin := range []string{"https://attacker.example", "null"} {
+		if status := logout(origin); status != http.StatusForbidden {
+			t.Errorf("got status %d logging out from origin %q, want 403", status, origin)
+		}
+	}
+	if status, _ := do(t, browser, http.MethodGet, topURL); status != http.StatusOK {
+		t.Fatalf("got status %d after cross-origin logouts, want the session to remain", status)
+	}
+
+	// the UI's origin
+	if status := logout(app.URL); status != http.StatusOK {
+		t.Errorf("got status %d logging out from the UI, want 200", status)
+	}
+	if status, _ := do(t, browser, http.MethodGet, topURL); status != http.StatusUnauthorized {
+		t.Errorf("got status %d after logging out, want 401", status)
+	}
+}
+
+func TestLoginCallbackRejectsStateMismatch(t *testing.T) {
+	srv := spotifytest.NewServer()
+	t.Cleanup(srv.Close)
+	app := newTestApp(t, srv)
+	browser := newTestBrowser(t)
+	// stop at the accounts service's redirect back to the callback
+	browser.CheckRedirect = func(req *http.Request, _ []*http.Request) error {
+		if req.URL.Path == "/auth/callback" {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, app.URL+"/auth/login", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %s", err)
+	}
+	resp, err := browser.Do(req)
+	if err != nil {
+		t.Fatalf("failed to log in: %s", err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse callback URL: %s", err)
+	}
+
+	// a callback for a login started by a different browser, i.e. a login CSRF attempt
+	query := callback.Query()
+	query.Set("state", "attacker-state")
+	callback.RawQuery = query.Encode()
+	if status, _ := do(t, browser, http.MethodGet, callback.String()); status != http.StatusBadRequest {
+		t.Errorf("got status %d for a mismatched state, want 400", status)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/stats"
+)
+
+// maxRequestedClusters limits the number of clusters which can be requested with the k query parameter.
+const maxRequestedClusters = 20
+
+// clusterVariables are the audio features which tracks are clustered by. Energy, danceability, valence, acousticness,
+// speechiness, instrumentalness and liveness are percentages.
+var clusterVariables = []string{
+	"energy", "danceability", "valence", "acousticness", "speechiness", "instrumentalness", "liveness", "tempo",
+	"loudness",
+}
+
+// ClustersHandler groups the tracks of the given Spotify playlist into clusters of tracks with similar audio features,
+// i.e. the distinct "sub-playlists" within it. The number of clusters is chosen automatically unless set by the k query
+// parameter. The seed query parameter sets the seed used to initialise the clustering, so the same playlist and seed
+// always produce the same clusters.
+func (a API) ClustersHandler(w http.ResponseWriter, r *http.Request) {
+	playlistID := mux.Vars(r)["playlistID"]
+	logger := a.logger.With(zap.String("playlist", playlistID), zap.String("addr", r.RemoteAddr))
+
+	query := r.URL.Query()
+	var opts []stats.ClusterOpt
+	if rawSeed := query.Get("seed"); rawSeed != "" {
+		seed, err := strconv.ParseInt(rawSeed, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, stats.WithSeed(seed))
+	}
+	if rawK := query.Get("k"); rawK != "" {
+		k, err := strconv.Atoi(rawK)
+		if err != nil || k < 1 || k > maxRequestedClusters {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, stats.WithClusterCount(k))
+	}
+	logger.Info("playlist clusters API request")
+
+	playlistData, err := a.source.GetPlaylist(r.Context(), playlistID)
+	if err != nil {
+		writeSourceError(w, logger, "failed to fetch playlist data", err)
+		return
+	}
+	lookup := newAudioFeatureLookup()
+	if err := aggregateTracks(r.Context(), logger, a.source, lookup, playlistData.Tracks.TrackItems); err != nil {
+		writeSourceError(w, logger, "failed to fetch playlist audio features", err)
+		return
+	}
+
+	// cluster each track once, in playlist order
+	vectors := stats.NewVectors(clusterVariables...)
+	seen := make(map[string]struct{}, len(lookup.tracks))
+	for _, item := range playlistData.Tracks.TrackItems {
+		if item.Kind() != spotify.ItemTrack {
+			continue
+		}
+		if _, ok := seen[item.TrackDetails.ID]; ok {
+			continue
+		}
+		seen[item.TrackDetails.ID] = struct{}{}
+
+		feature, ok := lookup.features[item.TrackDetails.ID]
+		if !ok {
+			vectors.Push(item.TrackDetails.ID, math.NaN())
+			continue
+		}
+		vectors.Push(feature.ID,
+			feature.Energy*100, feature.Danceability*100, feature.Valence*100, feature.Acousticness*100,
+			feature.Speechiness*100, feature.Instrumentalness*100, feature.Liveness*100, feature.Tempo,
+			feature.Loudness,
+		)
+	}
+
+	writeJSON(w, logger, PlaylistClustersResponse{
+		Metadata: ClustersMetadata{
+			Name:       playlistData.Name,
+			SpotifyURL: playlistData.ExternalURLs.Spotify,
+			TrackCount: playlistData.Tracks.Total,
+		},
+		Clusters: vectors.Cluster(lookup.tracks, opts...),
+	})
+}
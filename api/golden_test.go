@@ -0,0 +1,92 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/api"
+	"github.com/jemgunay/spotify-unwrapped/config"
+	"github.com/jemgunay/spotify-unwrapped/source"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// fixturePlaylistID is the ID of the playlist in testdata/fixtures. It is the first 24 tracks of the sample_data
+// playlist, with audio features for each as those in sample_data are for other tracks.
+const fixturePlaylistID = "2VLA8FqcO5Oto2mACkKBOt"
+
+// TestPlaylistsGolden compares the v1 and v2 payloads of the fixture playlist with the golden files in testdata,
+// guarding against unintended changes to the response formats. Run with -update to regenerate the golden files after
+// an intended change.
+func TestPlaylistsGolden(t *testing.T) {
+	fixtures, err := source.NewFixture(filepath.Join("testdata", "fixtures"))
+	if err != nil {
+		t.Fatalf("failed to read fixtures: %s", err)
+	}
+	handlers := api.New(zap.NewNop(), config.API{}, fixtures)
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/playlists/{playlistID}", handlers.PlaylistsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/v2/playlists/{playlistID}", handlers.PlaylistsV2Handler).Methods(http.MethodGet)
+
+	tests := []struct {
+		version string
+		golden  string
+	}{
+		{version: "v1", golden: "playlist_v1.golden.json"},
+		{version: "v2", golden: "playlist_v2.golden.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/"+tt.version+"/playlists/"+fixturePlaylistID, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want 200", w.Code)
+			}
+			got := normaliseGolden(t, w.Body.Bytes())
+
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatalf("failed to update golden file: %s", err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read golden file: %s", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("response differs from %s, run with -update if the change is intended:\n%s", path, got)
+			}
+		})
+	}
+}
+
+// normaliseGolden indents a response body for readable diffs. The generation's age depends on the current year, so is
+// removed.
+func normaliseGolden(t *testing.T, body []byte) []byte {
+	t.Helper()
+	var resp map[string]any
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	if s, ok := resp["stats"].(map[string]any); ok {
+		if generation, ok := s["generation"].(map[string]any); ok {
+			delete(generation, "age")
+		}
+	}
+
+	normalised, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to encode response: %s", err)
+	}
+	return append(normalised, '\n')
+}
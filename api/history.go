@@ -0,0 +1,104 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/history"
+)
+
+// maxHistoryUploadBytes limits the size of streaming history uploads. Extended streaming history exports spanning many
+// years can reach tens of megabytes.
+const maxHistoryUploadBytes = 256 << 20
+
+// HistoryHandler analyses uploaded streaming history files from Spotify's "Download your data" privacy export. Files
+// are uploaded either as a multipart form, or as a single JSON or export ZIP file in the request body. The tz query
+// parameter sets the time zone used for hour of day and day of week stats, e.g. "Europe/London", and enrich=true
+// enriches the analysis with audio features.
+func (a API) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	logger := a.logger.With(zap.String("addr", r.RemoteAddr))
+
+	query := r.URL.Query()
+	opts := []history.Opt{}
+	if tz := query.Get("tz"); tz != "" {
+		location, err := time.LoadLocation(tz)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, history.WithLocation(location))
+	}
+	enrich, _ := strconv.ParseBool(query.Get("enrich"))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxHistoryUploadBytes)
+	plays, err := readHistoryUpload(r)
+	if err != nil {
+		logger.Info("failed to read streaming history upload", zap.Error(err))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) || errors.Is(err, history.ErrFileTooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	logger.Info("streaming history API request", zap.Int("plays", len(plays)), zap.Bool("enrich", enrich))
+
+	report := history.Analyse(plays, opts...)
+	if enrich {
+		report.Enrichment, err = history.Enrich(r.Context(), a.source, plays, opts...)
+		if err != nil && report.Enrichment == nil {
+			writeSourceError(w, logger, "failed to enrich streaming history", err)
+			return
+		}
+		if err != nil {
+			// don't error out - the audio features which were fetched can still be analysed
+			logger.Warn("failed to fetch some streaming history audio features", zap.Error(err))
+		}
+	}
+	writeJSON(w, logger, report)
+}
+
+// readHistoryUpload reads the plays from each uploaded streaming history file.
+func readHistoryUpload(r *http.Request) ([]history.Play, error) {
+	reader, err := r.MultipartReader()
+	if errors.Is(err, http.ErrNotMultipart) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return history.ParseFile("request body", data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var plays []history.Play
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		filePlays, err := history.ParseFile(part.FileName(), data)
+		if err != nil {
+			return nil, err
+		}
+		plays = append(plays, filePlays...)
+	}
+	return plays, nil
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/stats"
+)
+
+// LibraryHandler processes the tracks saved to the logged in user's library. As well as the same stats as playlists,
+// it determines how the library has grown and changed over time from when each track was saved.
+func (a API) LibraryHandler(w http.ResponseWriter, r *http.Request) {
+	source, ok := a.userSource(w, r)
+	if !ok {
+		return
+	}
+
+	logger := a.logger.With(zap.String("addr", r.RemoteAddr))
+	logger.Info("library API request", zap.Bool("streaming", a.conf.StreamPlaylists))
+
+	var (
+		tracks     spotify.Tracks
+		aggregator *libraryAggregator
+		err        error
+	)
+	if a.conf.StreamPlaylists {
+		aggregator = newLibraryAggregator(newStreamingTrackAggregator(streamSampleSize, a.moodOpts()...))
+		stream := newTrackStream(r.Context(), logger, source, aggregator)
+		tracks, err = source.StreamSavedTracks(r.Context(), stream.Push)
+		if err == nil {
+			err = stream.Flush()
+		}
+	} else {
+		aggregator = newLibraryAggregator(newTrackAggregator(0, a.moodOpts()...))
+		tracks, err = source.GetSavedTracks(r.Context())
+		if err == nil {
+			err = aggregateTracks(r.Context(), logger, source, aggregator, tracks.TrackItems)
+		}
+	}
+	if err != nil {
+		writeSourceError(w, logger, "failed to fetch library data", err)
+		return
+	}
+
+	// generate final response payload
+	writeJSON(w, logger, LibraryResponse{
+		Metadata: LibraryMetadata{
+			TrackCount:     tracks.Total,
+			AnalysedTracks: aggregator.TrackCount(),
+			SkippedItems:   aggregator.Skipped(),
+			Truncated:      aggregator.ItemCount() < tracks.Total,
+		},
+		Stats: LibraryStats{
+			PlaylistStats:   aggregator.Calc(logger),
+			LibraryTimeline: aggregator.CalcTimeline(),
+		},
+	})
+}
+
+// libraryAggregator aggregates saved tracks, additionally tracking when each track was saved.
+type libraryAggregator struct {
+	*trackAggregator
+	// addedPerMonth counts the tracks saved per month, keyed by "YYYY-MM"
+	addedPerMonth stats.Mapping
+	// addedDates determines the oldest and newest saves
+	addedDates               stats.Group
+	oldestAdded, newestAdded time.Time
+	// addedYears maps track IDs to the year they were saved in
+	addedYears map[string]int
+	yearDrift  map[int]*libraryYear
+}
+
+// libraryYear aggregates the tracks saved in a single year.
+type libraryYear struct {
+	tracks, releases              int
+	energy, valence, releaseDates stats.Group
+}
+
+// newLibraryAggregator initialises a libraryAggregator which aggregates the tracks themselves with the given
+// trackAggregator, which determines whether the library is streamed.
+func newLibraryAggregator(t *trackAggregator) *libraryAggregator {
+	return &libraryAggregator{
+		trackAggregator: t,
+		addedPerMonth:   stats.NewMapping(120),
+		addedDates:      stats.NewGroup(t.groupOpts...),
+		addedYears:      make(map[string]int),
+		yearDrift:       make(map[int]*libraryYear),
+	}
+}
+
+// PushTracks aggregates the given saved track items.
+func (l *libraryAggregator) PushTracks(items []spotify.TrackItem) []string {
+	trackIDs := l.trackAggregator.PushTracks(items)
+	for _, item := range items {
+		if item.Kind() != spotify.ItemTrack || item.AddedAt.IsZero() {
+			continue
+		}
+		track := item.TrackDetails
+		l.addedPerMonth.Push(item.AddedAt.Format(monthLayout))
+		l.addedDates.Push(track.ID, float64(item.AddedAt.Unix()))
+		if l.oldestAdded.IsZero() || item.AddedAt.Before(l.oldestAdded) {
+			l.oldestAdded = item.AddedAt
+		}
+		if item.AddedAt.After(l.newestAdded) {
+			l.newestAdded = item.AddedAt
+		}
+
+		year := l.year(item.AddedAt.Year())
+		year.tracks++
+		l.addedYears[track.ID] = item.AddedAt.Year()
+		if releaseDate, err := track.Album.ParseReleaseDate(); err == nil {
+			year.releases++
+			year.releaseDates.Push(track.ID, float64(releaseDate.Unix()))
+		}
+	}
+	return trackIDs
+}
+
+// PushAudioFeatures aggregates the given saved track audio features.
+func (l *libraryAggregator) PushAudioFeatures(audioFeatures []spotify.AudioFeatures) {
+	l.trackAggregator.pushAudioFeatures(audioFeatures)
+	for _, feature := range audioFeatures {
+		addedYear, ok := l.addedYears[feature.ID]
+		if !ok {
+			continue
+		}
+		year := l.year(addedYear)
+		year.energy.Push(feature.ID, feature.Energy)
+		year.valence.Push(feature.ID, feature.Valence)
+	}
+	if !l.streaming {
+		return
+	}
+
+	// the audio features of every track pushed have now been pushed, so the saved years are no longer needed
+	for id := range l.addedYears {
+		delete(l.addedYears, id)
+	}
+	groups := []*stats.Group{&l.addedDates}
+	for _, y := range l.yearDrift {
+		groups = append(groups, &y.energy, &y.valence, &y.releaseDates)
+	}
+	l.prune(groups...)
+}
+
+func (l *libraryAggregator) year(year int) *libraryYear {
+	y, ok := l.yearDrift[year]
+	if !ok {
+		y = &libraryYear{
+			energy:       stats.NewGroup(l.groupOpts...),
+			valence:      stats.NewGroup(l.groupOpts...),
+			releaseDates: stats.NewGroup(l.groupOpts...),
+		}
+		l.yearDrift[year] = y
+	}
+	return y
+}
+
+// monthLayout formats dates as months which sort chronologically.
+const monthLayout = "2006-01"
+
+// CalcTimeline performs the final calculations on the library timeline stats and returns them. Calc must be called
+// first.
+func (l *libraryAggregator) CalcTimeline() LibraryTimeline {
+	l.addedDates.Calc(l.trackIDLookup, stats.ToDateString())
+
+	// fill in months without any saves so that the timeline is continuous
+	if !l.oldestAdded.IsZero() {
+		month := time.Date(l.oldestAdded.Year(), l.oldestAdded.Month(), 1, 0, 0, 0, 0, time.UTC)
+		for !month.After(l.newestAdded) {
+			l.addedPerMonth[month.Format(monthLayout)] += 0
+			month = month.AddDate(0, 1, 0)
+		}
+	}
+
+	years := make([]int, 0, len(l.yearDrift))
+	for year := range l.yearDrift {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+
+	toPercentage := stats.WithMultiplier(100)
+	drift := make([]LibraryYearPoint, 0, len(years))
+	for _, year := range years {
+		y := l.yearDrift[year]
+		y.energy.Calc(l.trackIDLookup, toPercentage)
+		y.valence.Calc(l.trackIDLookup, toPercentage)
+		y.releaseDates.Calc(l.trackIDLookup)
+		point := LibraryYearPoint{
+			Year:    year,
+			Tracks:  y.tracks,
+			Energy:  y.energy.Mean.ValueOut,
+			Valence: y.valence.Mean.ValueOut,
+		}
+		if y.releases > 0 {
+			point.ReleaseYear = y.releaseDates.Mean.DateYear()
+		}
+		drift = append(drift, point)
+	}
+
+	return LibraryTimeline{
+		AddedDates: l.addedDates,
+		AddedPerMonth: l.addedPerMonth.OrderedLabelsAndValues(
+			stats.WithSort(stats.SortKey, false),
+		),
+		AddedDrift: drift,
+	}
+}
+
+var _ aggregator = (*libraryAggregator)(nil)
@@ -0,0 +1,173 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/api"
+	"github.com/jemgunay/spotify-unwrapped/config"
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// fakeUserSource is a UserSource of a library of saved tracks, each with the same audio features.
+type fakeUserSource struct {
+	api.UserSource
+	saved []spotify.TrackItem
+}
+
+func (f fakeUserSource) GetAudioFeatures(_ context.Context, trackIDs []string) ([]spotify.AudioFeatures, error) {
+	features := make([]spotify.AudioFeatures, 0, len(trackIDs))
+	for _, id := range trackIDs {
+		features = append(features, spotify.AudioFeatures{ID: id, Energy: 0.6, Valence: 0.4, TimeSignature: 4})
+	}
+	return features, nil
+}
+
+func (f fakeUserSource) GetSavedTracks(_ context.Context) (spotify.Tracks, error) {
+	return spotify.Tracks{TrackItems: f.saved, Total: len(f.saved)}, nil
+}
+
+// StreamSavedTracks passes the saved tracks in pages of 2.
+func (f fakeUserSource) StreamSavedTracks(_ context.Context, fn func(spotify.Tracks) error) (spotify.Tracks, error) {
+	for offset := 0; offset < len(f.saved); offset += 2 {
+		end := offset + 2
+		if end > len(f.saved) {
+			end = len(f.saved)
+		}
+		if err := fn(spotify.Tracks{TrackItems: f.saved[offset:end], Total: len(f.saved), Offset: offset}); err != nil {
+			return spotify.Tracks{}, err
+		}
+	}
+	return spotify.Tracks{Total: len(f.saved)}, nil
+}
+
+// fakeUserSources treats requests with a session cookie as logged in to the source.
+type fakeUserSources struct {
+	source api.UserSource
+}
+
+func (f fakeUserSources) UserSource(r *http.Request) (api.UserSource, bool) {
+	if _, err := r.Cookie("session"); err != nil {
+		return nil, false
+	}
+	return f.source, true
+}
+
+// getLibrary requests the library stats, with a session cookie if logged in, decoding the response body if the
+// request succeeded.
+func getLibrary(t *testing.T, conf config.API, source api.UserSource, loggedIn bool) (int, api.LibraryResponse) {
+	t.Helper()
+	handlers := api.New(zap.NewNop(), conf, nil, api.WithUserSources(fakeUserSources{source: source}))
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/me/library", handlers.LibraryHandler).Methods(http.MethodGet)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/me/library", nil)
+	if loggedIn {
+		req.AddCookie(&http.Cookie{Name: "session", Value: "user"})
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp api.LibraryResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %s", err)
+		}
+	}
+	return w.Code, resp
+}
+
+// newSavedTrack returns a track item saved at the given time.
+func newSavedTrack(id string, addedAt time.Time) spotify.TrackItem {
+	return spotify.TrackItem{
+		AddedAt: addedAt,
+		TrackDetails: &spotify.TrackDetails{
+			ID: id, Type: "track", Name: "Track " + id,
+			Album: spotify.Album{ReleaseDate: "2000", ReleaseDatePrecision: "year"},
+		},
+	}
+}
+
+func TestLibraryHandlerRequiresLogin(t *testing.T) {
+	if status, _ := getLibrary(t, config.API{}, fakeUserSource{}, false); status != http.StatusUnauthorized {
+		t.Errorf("got status %d without a session, want 401", status)
+	}
+}
+
+func TestLibraryHandlerTimeline(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+	}
+	// most recently saved first, with a gap in saves from April 2022 to December 2022
+	saved := []spotify.TrackItem{
+		newSavedTrack("e", date(2023, time.January, 3)),
+		newSavedTrack("d", date(2022, time.March, 31)),
+		newSavedTrack("c", date(2022, time.January, 31)),
+		newSavedTrack("b", date(2022, time.January, 1)),
+		newSavedTrack("a", date(2021, time.December, 31)),
+	}
+	wantMonths := []string{
+		"2021-12", "2022-01", "2022-02", "2022-03", "2022-04", "2022-05", "2022-06", "2022-07", "2022-08", "2022-09",
+		"2022-10", "2022-11", "2022-12", "2023-01",
+	}
+	wantCounts := []int{1, 2, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	wantDrift := []api.LibraryYearPoint{
+		{Year: 2021, Tracks: 1, Energy: 60.0, Valence: 40.0, ReleaseYear: 2000},
+		{Year: 2022, Tracks: 3, Energy: 60.0, Valence: 40.0, ReleaseYear: 2000},
+		{Year: 2023, Tracks: 1, Energy: 60.0, Valence: 40.0, ReleaseYear: 2000},
+	}
+
+	for _, stream := range []bool{false, true} {
+		t.Run("stream="+strconv.FormatBool(stream), func(t *testing.T) {
+			status, resp := getLibrary(t, config.API{StreamPlaylists: stream}, fakeUserSource{saved: saved}, true)
+			if status != http.StatusOK {
+				t.Fatalf("got status %d, want 200", status)
+			}
+			if resp.Metadata.TrackCount != 5 || resp.Metadata.AnalysedTracks != 5 || resp.Metadata.Truncated {
+				t.Errorf("got metadata %+v, want all 5 tracks analysed", resp.Metadata)
+			}
+
+			timeline := resp.Stats.LibraryTimeline
+			if !reflect.DeepEqual(timeline.AddedPerMonth.Keys, wantMonths) ||
+				!reflect.DeepEqual(timeline.AddedPerMonth.Values, wantCounts) {
+				t.Errorf("got months %q with counts %v, want %q with %v", timeline.AddedPerMonth.Keys,
+					timeline.AddedPerMonth.Values, wantMonths, wantCounts)
+			}
+			if !reflect.DeepEqual(timeline.AddedDrift, wantDrift) {
+				t.Errorf("got drift %+v, want %+v", timeline.AddedDrift, wantDrift)
+			}
+			oldest, newest := timeline.AddedDates.Min.ValueOut, timeline.AddedDates.Max.ValueOut
+			if oldest != "31/12/2021" || newest != "03/01/2023" {
+				t.Errorf("got saves from %v to %v, want 31/12/2021 to 03/01/2023", oldest, newest)
+			}
+		})
+	}
+}
+
+func TestLibraryHandlerEmptyLibrary(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run("stream="+strconv.FormatBool(stream), func(t *testing.T) {
+			status, resp := getLibrary(t, config.API{StreamPlaylists: stream}, fakeUserSource{}, true)
+			if status != http.StatusOK {
+				t.Fatalf("got status %d, want 200", status)
+			}
+			timeline := resp.Stats.LibraryTimeline
+			if len(timeline.AddedPerMonth.Keys) != 0 || len(timeline.AddedDrift) != 0 {
+				t.Errorf("got months %q and drift %+v, want an empty timeline", timeline.AddedPerMonth.Keys,
+					timeline.AddedDrift)
+			}
+			if resp.Metadata.TrackCount != 0 || resp.Metadata.AnalysedTracks != 0 {
+				t.Errorf("got metadata %+v, want no tracks", resp.Metadata)
+			}
+		})
+	}
+}
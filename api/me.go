@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/stats"
+)
+
+// UserSource provides the listening data of a logged in user. It is satisfied by spotify.Requester.
+type UserSource interface {
+	AudioFeaturesSource
+	// GetTopTracks gets the user's top tracks for the given time range, most listened to first.
+	GetTopTracks(ctx context.Context, timeRange spotify.TimeRange) ([]spotify.TrackItem, error)
+	// GetTopArtists gets the user's top artists for the given time range, most listened to first.
+	GetTopArtists(ctx context.Context, timeRange spotify.TimeRange) ([]spotify.Artist, error)
+	// GetSavedTracks gets all of the tracks saved to the user's library, most recently saved first.
+	GetSavedTracks(ctx context.Context) (spotify.Tracks, error)
+	// StreamSavedTracks gets the tracks saved to the user's library, passing each page to fn in order rather than
+	// accumulating them in the returned tracks.
+	StreamSavedTracks(ctx context.Context, fn func(spotify.Tracks) error) (spotify.Tracks, error)
+	// GetRecentlyPlayed gets the tracks the user has recently played, most recent first.
+	GetRecentlyPlayed(ctx context.Context) ([]spotify.PlayHistory, error)
+}
+
+var _ UserSource = (*spotify.Requester)(nil)
+
+// UserSources provides the source for the logged in user making a request. It is satisfied by Auth.
+type UserSources interface {
+	// UserSource returns the source for the logged in user making the request, or false if the user is not logged
+	// in.
+	UserSource(r *http.Request) (UserSource, bool)
+}
+
+var _ UserSources = (*Auth)(nil)
+
+// userSource returns the source for the logged in user making the request. If the user is not logged in, a 401 is
+// written and false is returned.
+func (a API) userSource(w http.ResponseWriter, r *http.Request) (UserSource, bool) {
+	if a.users == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+	source, ok := a.users.UserSource(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil, false
+	}
+	return source, true
+}
+
+// TopHandler processes the logged in user's top tracks and artists over the requested time range, aggregating the
+// tracks into the same stats as playlists.
+func (a API) TopHandler(w http.ResponseWriter, r *http.Request) {
+	source, ok := a.userSource(w, r)
+	if !ok {
+		return
+	}
+
+	timeRange, err := spotify.ParseTimeRange(r.URL.Query().Get("range"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	logger := a.logger.With(zap.String("time_range", string(timeRange)), zap.String("addr", r.RemoteAddr))
+	logger.Info("top tracks API request")
+
+	trackItems, err := source.GetTopTracks(r.Context(), timeRange)
+	if err != nil {
+		writeSourceError(w, logger, "failed to fetch top tracks", err)
+		return
+	}
+	artists, err := source.GetTopArtists(r.Context(), timeRange)
+	if err != nil {
+		writeSourceError(w, logger, "failed to fetch top artists", err)
+		return
+	}
+
+	aggregator := newTrackAggregator(len(trackItems), a.moodOpts()...)
+	if err := aggregateTracks(r.Context(), logger, source, aggregator, trackItems); err != nil {
+		writeSourceError(w, logger, "failed to aggregate top tracks", err)
+		return
+	}
+
+	// generate final response payload
+	writeJSON(w, logger, TopResponse{
+		Metadata: TopMetadata{
+			TimeRange:      timeRange,
+			TrackCount:     len(trackItems),
+			AnalysedTracks: aggregator.TrackCount(),
+			SkippedItems:   aggregator.Skipped(),
+			TopArtists:     newTopArtists(artists),
+		},
+		Stats: TopStats{
+			PlaylistStats: aggregator.Calc(logger),
+			TopGenres:     topGenres(artists),
+		},
+	})
+}
+
+func newTopArtists(artists []spotify.Artist) []TopArtist {
+	top := make([]TopArtist, 0, len(artists))
+	for _, artist := range artists {
+		top = append(top, TopArtist{
+			Name:       artist.Name,
+			Image:      artist.Images.First(),
+			SpotifyURL: artist.ExternalURLs.Spotify,
+			Genres:     artist.Genres,
+			Popularity: artist.Popularity,
+		})
+	}
+	return top
+}
+
+// topGenres counts the genres of the given artists.
+func topGenres(artists []spotify.Artist) *stats.OrderedKVPair {
+	genres := stats.NewMapping(50)
+	for _, artist := range artists {
+		for _, genre := range artist.Genres {
+			genres.Push(genre)
+		}
+	}
+	return genres.OrderedLabelsAndValues(
+		stats.WithSort(stats.SortValue, true),
+		stats.WithTruncate(20),
+	)
+}
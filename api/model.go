@@ -0,0 +1,339 @@
+package api
+
+import (
+	"time"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/stats"
+)
+
+// PlaylistResponse is the v1 playlist stats payload used to drive visualisations.
+type PlaylistResponse struct {
+	Metadata PlaylistMetadata `json:"metadata"`
+	Stats    PlaylistStats    `json:"stats"`
+}
+
+// PlaylistResponseV2 is the v2 playlist stats payload. Unlike v1, its stats are not tied to the format of any
+// particular chart.
+type PlaylistResponseV2 struct {
+	Metadata PlaylistMetadata `json:"metadata"`
+	Stats    PlaylistStatsV2  `json:"stats"`
+}
+
+// PlaylistMetadata describes a playlist and how much of it was analysed.
+type PlaylistMetadata struct {
+	Name       string        `json:"name"`
+	Owner      PlaylistOwner `json:"owner"`
+	Image      string        `json:"image"`
+	SpotifyURL string        `json:"spotify_url"`
+	// TrackCount is the number of items in the playlist, including those which weren't analysed.
+	TrackCount     int `json:"track_count"`
+	AnalysedTracks int `json:"analysed_tracks"`
+	// SkippedItems counts the items which couldn't be analysed by item kind, e.g. local files.
+	SkippedItems stats.Mapping `json:"skipped_items"`
+	// Truncated indicates that only the first SPOTIFY_MAX_PLAYLIST_TRACKS items of the playlist were analysed.
+	Truncated bool `json:"truncated"`
+}
+
+// PlaylistOwner is the user who owns a playlist.
+type PlaylistOwner struct {
+	Name       string `json:"name"`
+	SpotifyURL string `json:"spotify_url"`
+}
+
+// newPlaylistMetadata describes the given aggregated playlist.
+func newPlaylistMetadata(playlistData spotify.Playlist, aggregator *trackAggregator) PlaylistMetadata {
+	return PlaylistMetadata{
+		Name: playlistData.Name,
+		Owner: PlaylistOwner{
+			Name:       playlistData.Owner.DisplayName,
+			SpotifyURL: playlistData.Owner.ExternalURLs.Spotify,
+		},
+		Image:          playlistData.Images.First(),
+		SpotifyURL:     playlistData.ExternalURLs.Spotify,
+		TrackCount:     playlistData.Tracks.Total,
+		AnalysedTracks: aggregator.TrackCount(),
+		SkippedItems:   aggregator.Skipped(),
+		Truncated:      aggregator.ItemCount() < playlistData.Tracks.Total,
+	}
+}
+
+// FeatureStats are the min, max and average of each track property. Energy, danceability, valence, acousticness,
+// speechiness, instrumentalness and liveness are percentages.
+type FeatureStats struct {
+	Popularity       stats.Group `json:"popularity"`
+	Energy           stats.Group `json:"energy"`
+	Danceability     stats.Group `json:"danceability"`
+	Valence          stats.Group `json:"valence"`
+	Acousticness     stats.Group `json:"acousticness"`
+	Speechiness      stats.Group `json:"speechiness"`
+	Instrumentalness stats.Group `json:"instrumentalness"`
+	Liveness         stats.Group `json:"liveness"`
+	ReleaseDates     stats.Group `json:"release_dates"`
+	TrackDurations   stats.Group `json:"track_durations"`
+	Tempo            stats.Group `json:"tempo"`
+	Loudness         stats.Group `json:"loudness"`
+}
+
+// PlaylistStats are the v1 stats of a set of tracks.
+type PlaylistStats struct {
+	Raw          FeatureStats         `json:"raw"`
+	Explicitness stats.Mapping        `json:"explicitness"`
+	ReleaseDates *stats.OrderedKVPair `json:"release_dates"`
+	// Generation is the generation of the average release year. It is empty if it couldn't be determined.
+	Generation    stats.Generation     `json:"generation"`
+	TopTitleWords *stats.OrderedKVPair `json:"top_title_words"`
+	TopArtists    *stats.OrderedKVPair `json:"top_artists"`
+	PitchKey      *stats.OrderedKVPair `json:"pitch_key"`
+	Mode          stats.Mapping        `json:"mode"`
+	KeyMode       *stats.OrderedKVPair `json:"key_mode"`
+	TimeSignature *stats.OrderedKVPair `json:"time_signature"`
+	Histograms    FeatureHistograms    `json:"histograms"`
+	// Correlations are the correlations between each pair of audio features, popularity and release year.
+	Correlations stats.Correlations `json:"correlations"`
+	// Mood classifies each track into a mood quadrant by its valence and energy.
+	Mood stats.MoodStats `json:"mood"`
+	// PositivityGraphData is in the format expected by the positivity/popularity/energy bubble graph. It is empty if
+	// the playlist was streamed.
+	PositivityGraphData []PositivityGraphPoint `json:"positivity_graph_data"`
+}
+
+// FeatureHistograms are the number of tracks in each range of each track property, showing how the values are
+// distributed rather than just their average. Energy, valence and danceability are percentages, tempo is in BPM and
+// durations are in minutes.
+type FeatureHistograms struct {
+	Energy       *stats.OrderedKVPair `json:"energy"`
+	Valence      *stats.OrderedKVPair `json:"valence"`
+	Danceability *stats.OrderedKVPair `json:"danceability"`
+	Tempo        *stats.OrderedKVPair `json:"tempo"`
+	Duration     *stats.OrderedKVPair `json:"duration"`
+	Popularity   *stats.OrderedKVPair `json:"popularity"`
+}
+
+// PositivityGraphPoint is the format expected by the positivity/popularity/energy bubble graph. Energy levels are
+// represented by the point radius. Track metadata is also provided for tooltip hover.
+type PositivityGraphPoint struct {
+	Positivity float64 `json:"x"`
+	Popularity float64 `json:"y"`
+	Energy     float64 `json:"r"`
+	Track      string  `json:"track"`
+}
+
+// PlaylistStatsV2 are the v2 stats of a set of tracks.
+type PlaylistStatsV2 struct {
+	Features     FeatureStats         `json:"features"`
+	Explicitness stats.Mapping        `json:"explicitness"`
+	ReleaseDates *stats.OrderedKVPair `json:"release_dates"`
+	// Generation is the generation of the average release year, or null if it couldn't be determined.
+	Generation    *stats.Generation    `json:"generation"`
+	TopTitleWords *stats.OrderedKVPair `json:"top_title_words"`
+	TopArtists    *stats.OrderedKVPair `json:"top_artists"`
+	PitchKey      *stats.OrderedKVPair `json:"pitch_key"`
+	Mode          stats.Mapping        `json:"mode"`
+	KeyMode       *stats.OrderedKVPair `json:"key_mode"`
+	TimeSignature *stats.OrderedKVPair `json:"time_signature"`
+	Histograms    FeatureHistograms    `json:"histograms"`
+	// Correlations are the correlations between each pair of audio features, popularity and release year.
+	Correlations stats.Correlations `json:"correlations"`
+	// Mood classifies each track into a mood quadrant by its valence and energy.
+	Mood stats.MoodStats `json:"mood"`
+	// Tracks are the positivity, popularity and energy of each track with audio features. It is empty if the playlist
+	// was streamed.
+	Tracks []TrackPoint `json:"tracks"`
+}
+
+// TrackPoint is the positivity, popularity and energy of a track, each from 0 to 100.
+type TrackPoint struct {
+	Track      string  `json:"track"`
+	Positivity float64 `json:"positivity"`
+	Popularity float64 `json:"popularity"`
+	Energy     float64 `json:"energy"`
+}
+
+// newPlaylistStatsV2 converts calculated v1 stats into v2 stats.
+func newPlaylistStatsV2(s PlaylistStats, tracks []TrackPoint) PlaylistStatsV2 {
+	v2 := PlaylistStatsV2{
+		Features:      s.Raw,
+		Explicitness:  s.Explicitness,
+		ReleaseDates:  s.ReleaseDates,
+		TopTitleWords: s.TopTitleWords,
+		TopArtists:    s.TopArtists,
+		PitchKey:      s.PitchKey,
+		Mode:          s.Mode,
+		KeyMode:       s.KeyMode,
+		TimeSignature: s.TimeSignature,
+		Histograms:    s.Histograms,
+		Correlations:  s.Correlations,
+		Mood:          s.Mood,
+		Tracks:        tracks,
+	}
+	if s.Generation.Name != "" {
+		generation := s.Generation
+		v2.Generation = &generation
+	}
+	return v2
+}
+
+// PlaylistClustersResponse is the payload of a playlist's track clusters.
+type PlaylistClustersResponse struct {
+	Metadata ClustersMetadata `json:"metadata"`
+	Clusters stats.Clusters   `json:"clusters"`
+}
+
+// ClustersMetadata describes a clustered playlist.
+type ClustersMetadata struct {
+	Name       string `json:"name"`
+	SpotifyURL string `json:"spotify_url"`
+	// TrackCount is the number of items in the playlist, including those which weren't clustered.
+	TrackCount int `json:"track_count"`
+}
+
+// TopResponse is the payload of the logged in user's top tracks and artists.
+type TopResponse struct {
+	Metadata TopMetadata `json:"metadata"`
+	Stats    TopStats    `json:"stats"`
+}
+
+// TopMetadata describes the time range of a user's top tracks and how many of them were analysed.
+type TopMetadata struct {
+	TimeRange      spotify.TimeRange `json:"time_range"`
+	TrackCount     int               `json:"track_count"`
+	AnalysedTracks int               `json:"analysed_tracks"`
+	// SkippedItems counts the items which couldn't be analysed by item kind.
+	SkippedItems stats.Mapping `json:"skipped_items"`
+	TopArtists   []TopArtist   `json:"top_artists"`
+}
+
+// TopArtist is the format of each of a user's top artists, in order of rank.
+type TopArtist struct {
+	Name       string   `json:"name"`
+	Image      string   `json:"image"`
+	SpotifyURL string   `json:"spotify_url"`
+	Genres     []string `json:"genres"`
+	Popularity float64  `json:"popularity"`
+}
+
+// TopStats extends the track stats with the genres of the top artists.
+type TopStats struct {
+	PlaylistStats
+	TopGenres *stats.OrderedKVPair `json:"top_genres"`
+}
+
+// LibraryResponse is the payload of the tracks saved to the logged in user's library.
+type LibraryResponse struct {
+	Metadata LibraryMetadata `json:"metadata"`
+	Stats    LibraryStats    `json:"stats"`
+}
+
+// LibraryMetadata describes how much of a user's library was analysed.
+type LibraryMetadata struct {
+	// TrackCount is the number of tracks in the library, including those which weren't analysed.
+	TrackCount     int `json:"track_count"`
+	AnalysedTracks int `json:"analysed_tracks"`
+	// SkippedItems counts the items which couldn't be analysed by item kind.
+	SkippedItems stats.Mapping `json:"skipped_items"`
+	// Truncated indicates that only the first SPOTIFY_MAX_PLAYLIST_TRACKS tracks of the library were analysed.
+	Truncated bool `json:"truncated"`
+}
+
+// LibraryStats extends the track stats with the library timeline.
+type LibraryStats struct {
+	PlaylistStats
+	LibraryTimeline
+}
+
+// LibraryTimeline is how the library has grown and changed over time.
+type LibraryTimeline struct {
+	AddedDates    stats.Group          `json:"added_dates"`
+	AddedPerMonth *stats.OrderedKVPair `json:"added_per_month"`
+	AddedDrift    []LibraryYearPoint   `json:"added_drift"`
+}
+
+// LibraryYearPoint is the average audio features and release date of the tracks saved in a single year. Energy and
+// valence are percentages.
+type LibraryYearPoint struct {
+	Year        int `json:"year"`
+	Tracks      int `json:"tracks"`
+	Energy      any `json:"energy"`
+	Valence     any `json:"valence"`
+	ReleaseYear int `json:"release_year,omitempty"`
+}
+
+// SessionsResponse is the payload of the logged in user's recently played tracks, grouped into listening sessions.
+type SessionsResponse struct {
+	Metadata SessionsMetadata `json:"metadata"`
+	// Sessions are the listening sessions, most recent first.
+	Sessions []ListeningSession `json:"sessions"`
+}
+
+// SessionsMetadata describes how recently played tracks were grouped into listening sessions.
+type SessionsMetadata struct {
+	PlayCount    int `json:"play_count"`
+	SessionCount int `json:"session_count"`
+	// SessionGap is the longest gap in listening within a session.
+	SessionGap string `json:"session_gap"`
+}
+
+// ListeningSession is the format of the stats for each listening session.
+type ListeningSession struct {
+	Start       time.Time     `json:"start"`
+	End         time.Time     `json:"end"`
+	Duration    string        `json:"duration"`
+	TrackCount  int           `json:"track_count"`
+	Tempo       *stats.Series `json:"tempo"`
+	Energy      *stats.Series `json:"energy"`
+	Positivity  *stats.Series `json:"positivity"`
+	DominantKey string        `json:"dominant_key"`
+	// Mood is whether the session became "more positive" or "less positive" over time, or stayed "steady".
+	Mood string `json:"mood"`
+}
+
+// TracksResponse is the payload of a playlist's exported tracks.
+type TracksResponse struct {
+	Metadata TracksMetadata `json:"metadata"`
+	// Tracks are the exported tracks, in playlist order.
+	Tracks []ExportedTrack `json:"tracks"`
+}
+
+// TracksMetadata describes an exported playlist.
+type TracksMetadata struct {
+	Name       string `json:"name"`
+	SpotifyURL string `json:"spotify_url"`
+	// TrackCount is the number of items in the playlist, including those which weren't exported, e.g. local files.
+	TrackCount     int `json:"track_count"`
+	ExportedTracks int `json:"exported_tracks"`
+}
+
+// ExportedTrack is the format of each exported track.
+type ExportedTrack struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Artists     []string `json:"artists"`
+	ReleaseDate string   `json:"release_date"`
+	// DurationMillis is the track duration in milliseconds.
+	DurationMillis int     `json:"duration_ms"`
+	Popularity     float64 `json:"popularity"`
+	Explicit       bool    `json:"explicit"`
+	// AddedAt is when the track was added to the playlist, if known.
+	AddedAt    *time.Time `json:"added_at"`
+	SpotifyURL string     `json:"spotify_url"`
+	// AudioFeatures is nil if Spotify has no audio features for the track.
+	AudioFeatures *ExportedAudioFeatures `json:"audio_features"`
+}
+
+// ExportedAudioFeatures is the format of each exported track's audio features. Key and mode are names rather than
+// Spotify's numeric values, which are empty if unknown.
+type ExportedAudioFeatures struct {
+	Danceability     float64 `json:"danceability"`
+	Energy           float64 `json:"energy"`
+	Speechiness      float64 `json:"speechiness"`
+	Acousticness     float64 `json:"acousticness"`
+	Instrumentalness float64 `json:"instrumentalness"`
+	Liveness         float64 `json:"liveness"`
+	Valence          float64 `json:"valence"`
+	Tempo            float64 `json:"tempo"`
+	Loudness         float64 `json:"loudness"`
+	Key              string  `json:"key"`
+	Mode             string  `json:"mode"`
+	TimeSignature    int     `json:"time_signature"`
+}
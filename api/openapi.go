@@ -0,0 +1,312 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/stats"
+)
+
+// OpenAPIHandler serves the OpenAPI 3 document describing the API endpoints. The response schemas are generated from
+// the response types, so they can't drift from the responses.
+func (a API) OpenAPIHandler(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, a.logger, openAPIDocument)
+}
+
+// openAPIDocument is generated once as the response types can't change at runtime.
+var openAPIDocument = newOpenAPIDocument()
+
+func newOpenAPIDocument() map[string]any {
+	gen := newSchemaGenerator()
+	playlistIDParam := map[string]any{
+		"name":        "playlistID",
+		"in":          "path",
+		"required":    true,
+		"description": "The Spotify playlist ID.",
+		"schema":      map[string]any{"type": "string"},
+	}
+	playlistResponses := func(response any) map[string]any {
+		return map[string]any{
+			"200": jsonResponse("The playlist stats.", gen.schema(reflect.TypeOf(response))),
+			"404": map[string]any{"description": "The playlist does not exist."},
+			"500": map[string]any{"description": "The playlist could not be fetched from Spotify."},
+		}
+	}
+
+	// the /api/v1/me endpoints act on behalf of the logged in user
+	userResponses := func(description string, response any) map[string]any {
+		return map[string]any{
+			"200": jsonResponse(description, gen.schema(reflect.TypeOf(response))),
+			"401": map[string]any{"description": "The user is not logged in."},
+			"500": map[string]any{"description": "The user's data could not be fetched from Spotify."},
+		}
+	}
+	withStatus := func(responses map[string]any, status, description string) map[string]any {
+		responses[status] = map[string]any{"description": description}
+		return responses
+	}
+
+	binaryFile := map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+	paths := map[string]any{
+		"/api/v1/playlists/{playlistID}": map[string]any{
+			"get": map[string]any{
+				"summary":    "Analyse a Spotify playlist.",
+				"parameters": []any{playlistIDParam},
+				"responses":  playlistResponses(PlaylistResponse{}),
+			},
+		},
+		"/api/v2/playlists/{playlistID}": map[string]any{
+			"get": map[string]any{
+				"summary":    "Analyse a Spotify playlist, returning the v2 stats payload.",
+				"parameters": []any{playlistIDParam},
+				"responses":  playlistResponses(PlaylistResponseV2{}),
+			},
+		},
+		"/api/v1/playlists/{playlistID}/tracks": map[string]any{
+			"get": map[string]any{
+				"summary": "Export every track of a Spotify playlist with its audio features.",
+				"parameters": []any{
+					playlistIDParam,
+					map[string]any{
+						"name":        "format",
+						"in":          "query",
+						"description": "The export format. Takes precedence over the Accept header.",
+						"schema":      map[string]any{"type": "string", "enum": []string{"json", "csv"}},
+					},
+				},
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "The playlist's tracks.",
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": gen.schema(reflect.TypeOf(TracksResponse{})),
+							},
+							"text/csv": map[string]any{"schema": map[string]any{"type": "string"}},
+						},
+					},
+					"404": map[string]any{"description": "The playlist does not exist."},
+					"500": map[string]any{"description": "The playlist could not be fetched from Spotify."},
+				},
+			},
+		},
+		"/api/v1/playlists/{playlistID}/clusters": map[string]any{
+			"get": map[string]any{
+				"summary": "Group a Spotify playlist's tracks into clusters of tracks with similar audio features.",
+				"parameters": []any{
+					playlistIDParam,
+					map[string]any{
+						"name":        "k",
+						"in":          "query",
+						"description": "The number of clusters. Chosen automatically if not set.",
+						"schema":      map[string]any{"type": "integer", "minimum": 1, "maximum": maxRequestedClusters},
+					},
+					map[string]any{
+						"name":        "seed",
+						"in":          "query",
+						"description": "The seed used to initialise the clustering.",
+						"schema":      map[string]any{"type": "integer", "format": "int64", "default": 1},
+					},
+				},
+				"responses": map[string]any{
+					"200": jsonResponse("The playlist's track clusters.",
+						gen.schema(reflect.TypeOf(PlaylistClustersResponse{}))),
+					"400": map[string]any{"description": "The k or seed query parameter is invalid."},
+					"404": map[string]any{"description": "The playlist does not exist."},
+					"500": map[string]any{"description": "The playlist could not be fetched from Spotify."},
+				},
+			},
+		},
+		"/api/v1/me/top": map[string]any{
+			"get": map[string]any{
+				"summary": "Analyse the logged in user's top tracks and artists.",
+				"parameters": []any{map[string]any{
+					"name":        "range",
+					"in":          "query",
+					"description": "The time range: approximately the last 4 weeks, 6 months or year respectively.",
+					"schema": map[string]any{
+						"type":    "string",
+						"enum":    []spotify.TimeRange{spotify.ShortTerm, spotify.MediumTerm, spotify.LongTerm},
+						"default": spotify.MediumTerm,
+					},
+				}},
+				"responses": withStatus(userResponses("The user's top tracks stats.", TopResponse{}),
+					"400", "The range query parameter is invalid."),
+			},
+		},
+		"/api/v1/me/library": map[string]any{
+			"get": map[string]any{
+				"summary":   "Analyse the tracks saved to the logged in user's library, and how it has changed over time.",
+				"responses": userResponses("The user's library stats.", LibraryResponse{}),
+			},
+		},
+		"/api/v1/me/sessions": map[string]any{
+			"get": map[string]any{
+				"summary": "Group the logged in user's recently played tracks into listening sessions.",
+				"parameters": []any{map[string]any{
+					"name":        "gap",
+					"in":          "query",
+					"description": "The longest gap in listening within a session, e.g. 30m. Defaults to LISTENING_SESSION_GAP.",
+					"schema":      map[string]any{"type": "string"},
+				}},
+				"responses": withStatus(userResponses("The user's listening sessions.", SessionsResponse{}),
+					"400", "The gap query parameter is invalid."),
+			},
+		},
+		"/api/v1/analyse": map[string]any{
+			"post": map[string]any{
+				"summary": "Analyse an uploaded CSV, M3U or XSPF playlist file.",
+				"parameters": []any{map[string]any{
+					"name":        "format",
+					"in":          "query",
+					"description": "The file format. Detected from the file name, media type or contents if not set.",
+					"schema":      map[string]any{"type": "string", "enum": []string{"csv", "m3u", "xspf"}},
+				}},
+				"requestBody": map[string]any{
+					"required": true,
+					"content": map[string]any{
+						"text/csv":             binaryFile,
+						"audio/x-mpegurl":      binaryFile,
+						"application/xspf+xml": binaryFile,
+						"multipart/form-data": map[string]any{"schema": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"file": map[string]any{"type": "string", "format": "binary"},
+							},
+						}},
+					},
+				},
+				"responses": map[string]any{
+					"200": jsonResponse("The playlist stats.", gen.schema(reflect.TypeOf(PlaylistResponse{}))),
+					"400": map[string]any{"description": "The file is not a supported playlist format."},
+					"413": map[string]any{"description": "The file is too large."},
+				},
+			},
+		},
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Spotify Unwrapped API",
+			"version": "2",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": gen.schemas,
+		},
+	}
+}
+
+func jsonResponse(description string, schema map[string]any) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": schema},
+		},
+	}
+}
+
+// schemaGenerator generates OpenAPI schemas from Go types by reflection, following the encoding/json rules. Named
+// struct types are added to schemas and referenced by name.
+type schemaGenerator struct {
+	schemas map[string]any
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{schemas: make(map[string]any)}
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	coefficientType = reflect.TypeOf(stats.Coefficient(0))
+)
+
+// schema generates the schema of the given type.
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == coefficientType:
+		// undefined coefficients are encoded as null
+		return map[string]any{"type": "number", "nullable": true}
+	case t.Kind() == reflect.Pointer:
+		schema := g.schema(t.Elem())
+		if ref, ok := schema["$ref"]; ok {
+			// sibling properties of a $ref are ignored, so it must be wrapped to be nullable
+			return map[string]any{"allOf": []any{map[string]any{"$ref": ref}}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// reserve the name before generating the schema in case the type is recursive
+			g.schemas[t.Name()] = nil
+			g.schemas[t.Name()] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	// interfaces, i.e. any value
+	return map[string]any{}
+}
+
+// structSchema generates the schema of a struct's JSON encoded fields. Fields of embedded structs are promoted, and
+// fields without omitempty are required.
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := make([]string, 0, t.NumField())
+	g.addFields(t, properties, &required)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (g *schemaGenerator) addFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			g.addFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = g.schema(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/stats"
+)
+
+// moodChangeThreshold is the minimum change in positivity, in percentage points, over a listening session for its mood
+// to be considered to have changed.
+const moodChangeThreshold = 10
+
+// SessionsHandler groups the logged in user's recently played tracks into listening sessions, separated by gaps in
+// listening longer than the configured session gap, which may be overridden with the gap query parameter, e.g. "45m".
+func (a API) SessionsHandler(w http.ResponseWriter, r *http.Request) {
+	source, ok := a.userSource(w, r)
+	if !ok {
+		return
+	}
+
+	gap := a.conf.ListeningSessionGap
+	if rawGap := r.URL.Query().Get("gap"); rawGap != "" {
+		var err error
+		if gap, err = time.ParseDuration(rawGap); err != nil || gap <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	logger := a.logger.With(zap.Duration("gap", gap), zap.String("addr", r.RemoteAddr))
+	logger.Info("listening sessions API request")
+
+	plays, err := source.GetRecentlyPlayed(r.Context())
+	if err != nil {
+		writeSourceError(w, logger, "failed to fetch recently played tracks", err)
+		return
+	}
+
+	// fetch the audio features of every track played
+	lookup := newAudioFeatureLookup()
+	items := make([]spotify.TrackItem, 0, len(plays))
+	for _, play := range plays {
+		items = append(items, spotify.TrackItem{TrackDetails: play.Track})
+	}
+	if err := aggregateTracks(r.Context(), logger, source, lookup, items); err != nil {
+		writeSourceError(w, logger, "failed to aggregate recently played tracks", err)
+		return
+	}
+
+	sessions := splitSessions(plays, gap)
+	sessionStats := make([]ListeningSession, 0, len(sessions))
+	// most recent session first
+	for i := len(sessions) - 1; i >= 0; i-- {
+		sessionStats = append(sessionStats, lookup.calcSession(sessions[i]))
+	}
+
+	// generate final response payload
+	writeJSON(w, logger, SessionsResponse{
+		Metadata: SessionsMetadata{
+			PlayCount:    len(plays),
+			SessionCount: len(sessions),
+			SessionGap:   stats.FormatDuration(gap),
+		},
+		Sessions: sessionStats,
+	})
+}
+
+// playStart determines when a play started. Spotify records plays once they have finished, so PlayedAt is the end of
+// the play.
+func playStart(play spotify.PlayHistory) time.Time {
+	return play.PlayedAt.Add(-time.Duration(play.Track.DurationMillis) * time.Millisecond)
+}
+
+// splitSessions orders plays by time and splits them wherever the gap between the end of a play and the start of the
+// next exceeds the given gap. Plays of content other than tracks are ignored.
+func splitSessions(plays []spotify.PlayHistory, gap time.Duration) [][]spotify.PlayHistory {
+	ordered := make([]spotify.PlayHistory, 0, len(plays))
+	for _, play := range plays {
+		if (spotify.TrackItem{TrackDetails: play.Track}).Kind() == spotify.ItemTrack {
+			ordered = append(ordered, play)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].PlayedAt.Before(ordered[j].PlayedAt)
+	})
+
+	var sessions [][]spotify.PlayHistory
+	for i, play := range ordered {
+		if i == 0 || playStart(play).Sub(ordered[i-1].PlayedAt) > gap {
+			sessions = append(sessions, nil)
+		}
+		sessions[len(sessions)-1] = append(sessions[len(sessions)-1], play)
+	}
+	return sessions
+}
+
+// calcSession calculates the stats for a single listening session. Plays must be in time order.
+func (l *audioFeatureLookup) calcSession(plays []spotify.PlayHistory) ListeningSession {
+	start, end := playStart(plays[0]), plays[len(plays)-1].PlayedAt
+	session := ListeningSession{
+		Start:      start,
+		End:        end,
+		Duration:   stats.FormatDuration(end.Sub(start)),
+		TrackCount: len(plays),
+		Tempo:      &stats.Series{},
+		Energy:     &stats.Series{},
+		Positivity: &stats.Series{},
+	}
+
+	keyModes := stats.NewMapping(24)
+	for _, play := range plays {
+		feature, ok := l.features[play.Track.ID]
+		if !ok {
+			continue
+		}
+		session.Tempo.Push(feature.ID, play.PlayedAt, math.Round(feature.Tempo))
+		session.Energy.Push(feature.ID, play.PlayedAt, feature.Energy*100)
+		session.Positivity.Push(feature.ID, play.PlayedAt, feature.Valence*100)
+		// the key signature is only known if both the key and mode are, i.e. not -1
+		if feature.Key > -1 && feature.Mode > -1 {
+			keyModes.Push(stats.SpotifyKeyModeToString(feature.Key, feature.Mode))
+		}
+	}
+	session.Tempo.Calc(l.tracks)
+	session.Energy.Calc(l.tracks)
+	session.Positivity.Calc(l.tracks)
+	session.DominantKey, _ = keyModes.Top()
+
+	switch change := session.Positivity.Change; {
+	case change >= moodChangeThreshold:
+		session.Mood = "more positive"
+	case change <= -moodChangeThreshold:
+		session.Mood = "less positive"
+	default:
+		session.Mood = "steady"
+	}
+	return session
+}
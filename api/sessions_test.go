@@ -0,0 +1,126 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// sessionStart is when the first test play starts.
+var sessionStart = time.Date(2023, 3, 1, 20, 0, 0, 0, time.UTC)
+
+// newPlay returns a play of a 3 minute track with the given ID which started the given duration after sessionStart.
+func newPlay(id string, startOffset time.Duration) spotify.PlayHistory {
+	return spotify.PlayHistory{
+		Track:    &spotify.TrackDetails{ID: id, Type: "track", Name: "Track " + id, DurationMillis: 180000},
+		PlayedAt: sessionStart.Add(startOffset + time.Minute*3),
+	}
+}
+
+// sessionIDs returns the track IDs of each session's plays.
+func sessionIDs(sessions [][]spotify.PlayHistory) [][]string {
+	ids := make([][]string, 0, len(sessions))
+	for _, session := range sessions {
+		sessionIDs := make([]string, 0, len(session))
+		for _, play := range session {
+			sessionIDs = append(sessionIDs, play.Track.ID)
+		}
+		ids = append(ids, sessionIDs)
+	}
+	return ids
+}
+
+func TestSplitSessions(t *testing.T) {
+	const gap = time.Minute * 30
+	episode := newPlay("episode", time.Minute*3)
+	episode.Track.Type = "episode"
+
+	tests := []struct {
+		name  string
+		plays []spotify.PlayHistory
+		want  [][]string
+	}{
+		{
+			name: "empty history",
+			want: [][]string{},
+		},
+		{
+			// each play starts exactly the gap after the end of the previous play
+			name:  "gap equal to the session gap",
+			plays: []spotify.PlayHistory{newPlay("a", 0), newPlay("b", time.Minute*33), newPlay("c", time.Minute*66)},
+			want:  [][]string{{"a", "b", "c"}},
+		},
+		{
+			name: "gap exceeding the session gap",
+			plays: []spotify.PlayHistory{
+				newPlay("a", 0), newPlay("b", time.Minute*33+time.Second), newPlay("c", time.Minute*37),
+			},
+			want: [][]string{{"a"}, {"b", "c"}},
+		},
+		{
+			// recently played tracks are most recent first
+			name: "unsorted plays",
+			plays: []spotify.PlayHistory{
+				newPlay("d", time.Hour*3), newPlay("b", time.Minute*3), newPlay("c", time.Hour), newPlay("a", 0),
+			},
+			want: [][]string{{"a", "b"}, {"c"}, {"d"}},
+		},
+		{
+			name:  "other content is ignored",
+			plays: []spotify.PlayHistory{newPlay("a", 0), episode, {PlayedAt: sessionStart}},
+			want:  [][]string{{"a"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sessionIDs(splitSessions(test.plays, gap)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got sessions %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCalcSession(t *testing.T) {
+	plays := []spotify.PlayHistory{
+		newPlay("a", 0), newPlay("b", time.Minute*3), newPlay("c", time.Minute*6), newPlay("d", time.Minute*9),
+	}
+	lookup := newAudioFeatureLookup()
+	items := make([]spotify.TrackItem, 0, len(plays))
+	for _, play := range plays {
+		items = append(items, spotify.TrackItem{TrackDetails: play.Track})
+	}
+	lookup.PushTracks(items)
+	// d has no audio features, and c has an unknown mode
+	lookup.PushAudioFeatures([]spotify.AudioFeatures{
+		{ID: "a", Valence: 0.2, Energy: 0.5, Tempo: 100.4, Key: 9, Mode: 0},
+		{ID: "b", Valence: 0.4, Energy: 0.5, Tempo: 110, Key: 9, Mode: 0},
+		{ID: "c", Valence: 0.6, Energy: 0.5, Tempo: 120, Key: 0, Mode: -1},
+	})
+
+	session := lookup.calcSession(plays)
+	if !session.Start.Equal(sessionStart) || !session.End.Equal(sessionStart.Add(time.Minute*12)) ||
+		session.Duration != "12m 0s" || session.TrackCount != 4 {
+		t.Errorf("got session from %s to %s lasting %s with %d tracks, want the 4 tracks from %s lasting 12m 0s",
+			session.Start, session.End, session.Duration, session.TrackCount, sessionStart)
+	}
+	if got := session.Positivity.Len(); got != 3 {
+		t.Errorf("got %d positivity points, want 3 for the tracks with audio features", got)
+	}
+	if session.Tempo.Points[0].ValueOut != 100.0 || session.Tempo.Mean != 110 {
+		t.Errorf("got first tempo %v and mean %v, want 100 and 110", session.Tempo.Points[0].ValueOut,
+			session.Tempo.Mean)
+	}
+	// positivity rises by 20 points every 3 minutes
+	if session.Positivity.Change != 40 || session.Mood != "more positive" {
+		t.Errorf("got positivity change %v and mood %q, want 40 and more positive", session.Positivity.Change,
+			session.Mood)
+	}
+	if session.Energy.Change != 0 {
+		t.Errorf("got energy change %v, want 0", session.Energy.Change)
+	}
+	if session.DominantKey != "A minor" {
+		t.Errorf("got dominant key %q, want A minor", session.DominantKey)
+	}
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/csv"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/config"
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/stats"
+)
+
+// TracksHandler exports every track of the given Spotify playlist joined with its audio features, in playlist order.
+// Tracks are returned as JSON, or as CSV if requested with format=csv or an Accept header of text/csv. Items which
+// can't be analysed, e.g. local files, are omitted.
+func (a API) TracksHandler(w http.ResponseWriter, r *http.Request) {
+	playlistID := mux.Vars(r)["playlistID"]
+	asCSV := wantsCSV(r)
+
+	logger := a.logger.With(zap.String("playlist", playlistID), zap.String("addr", r.RemoteAddr))
+	logger.Info("playlist tracks API request", zap.Bool("csv", asCSV))
+
+	playlistData, err := a.source.GetPlaylist(r.Context(), playlistID)
+	if err != nil {
+		writeSourceError(w, logger, "failed to fetch playlist data", err)
+		return
+	}
+	lookup := newAudioFeatureLookup()
+	if err := aggregateTracks(r.Context(), logger, a.source, lookup, playlistData.Tracks.TrackItems); err != nil {
+		writeSourceError(w, logger, "failed to fetch playlist audio features", err)
+		return
+	}
+
+	tracks := make([]ExportedTrack, 0, len(playlistData.Tracks.TrackItems))
+	for _, item := range playlistData.Tracks.TrackItems {
+		if item.Kind() == spotify.ItemTrack {
+			tracks = append(tracks, lookup.exportTrack(item))
+		}
+	}
+
+	// the response depends on the Accept header as well as the URL
+	w.Header().Add("Vary", "Accept")
+	if asCSV {
+		writeTracksCSV(w, logger, playlistID, tracks)
+		return
+	}
+	writeJSON(w, logger, TracksResponse{
+		Metadata: TracksMetadata{
+			Name:           playlistData.Name,
+			SpotifyURL:     playlistData.ExternalURLs.Spotify,
+			TrackCount:     playlistData.Tracks.Total,
+			ExportedTracks: len(tracks),
+		},
+		Tracks: tracks,
+	})
+}
+
+// wantsCSV determines whether CSV has been requested, either by the format query parameter, which takes precedence,
+// or by the Accept header.
+func wantsCSV(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return strings.EqualFold(format, "csv")
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == "text/csv" {
+			return true
+		}
+	}
+	return false
+}
+
+// exportTrack joins a track item with its audio features.
+func (l *audioFeatureLookup) exportTrack(item spotify.TrackItem) ExportedTrack {
+	details := item.TrackDetails
+	track := ExportedTrack{
+		ID:             details.ID,
+		Name:           details.Name,
+		Artists:        make([]string, 0, len(details.Artists)),
+		ReleaseDate:    details.Album.ReleaseDate,
+		DurationMillis: details.DurationMillis,
+		Popularity:     details.Popularity,
+		Explicit:       details.Explicit,
+		SpotifyURL:     details.ExternalURLs.Spotify,
+	}
+	for _, artist := range details.Artists {
+		track.Artists = append(track.Artists, artist.Name)
+	}
+	if !item.AddedAt.IsZero() {
+		addedAt := item.AddedAt
+		track.AddedAt = &addedAt
+	}
+
+	feature, ok := l.features[details.ID]
+	if !ok {
+		return track
+	}
+	track.AudioFeatures = &ExportedAudioFeatures{
+		Danceability:     feature.Danceability,
+		Energy:           feature.Energy,
+		Speechiness:      feature.Speechiness,
+		Acousticness:     feature.Acousticness,
+		Instrumentalness: feature.Instrumentalness,
+		Liveness:         feature.Liveness,
+		Valence:          feature.Valence,
+		Tempo:            feature.Tempo,
+		Loudness:         feature.Loudness,
+		TimeSignature:    feature.TimeSignature,
+	}
+	// -1 is Spotify's unknown key value, and the unknown mode value of imported tracks
+	if feature.Key > -1 {
+		track.AudioFeatures.Key = stats.SpotifyKeyToPitchKey(feature.Key)
+	}
+	if feature.Mode > -1 {
+		track.AudioFeatures.Mode = stats.SpotifyModeToString(feature.Mode)
+	}
+	return track
+}
+
+// tracksCSVHeader is the header row of exported track CSV files.
+var tracksCSVHeader = []string{
+	"id", "name", "artists", "release_date", "duration_ms", "popularity", "explicit", "added_at", "spotify_url",
+	"danceability", "energy", "speechiness", "acousticness", "instrumentalness", "liveness", "valence", "tempo",
+	"loudness", "key", "mode", "time_signature",
+}
+
+// writeTracksCSV writes the exported tracks as a CSV file attachment. Audio feature columns are empty for tracks
+// without audio features.
+func writeTracksCSV(w http.ResponseWriter, logger config.Logger, playlistID string, tracks []ExportedTrack) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": playlistID + ".csv"}))
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(tracksCSVHeader); err != nil {
+		logger.Error("failed to write tracks CSV header", zap.Error(err))
+		return
+	}
+	for _, track := range tracks {
+		if err := writer.Write(track.csvRecord()); err != nil {
+			logger.Error("failed to write tracks CSV record", zap.Error(err), zap.String("track", track.ID))
+			return
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		logger.Error("failed to write tracks CSV", zap.Error(err))
+	}
+}
+
+// escapeCSVFormula prevents spreadsheet applications from interpreting a cell as a formula, by prefixing cells which
+// begin with a formula character with a single quote. It is applied to cells of track metadata, which playlist
+// owners control, but not to numeric cells, as negative numbers would otherwise be escaped.
+func escapeCSVFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// csvRecord converts the track into a CSV record in the order of tracksCSVHeader.
+func (t ExportedTrack) csvRecord() []string {
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	addedAt := ""
+	if t.AddedAt != nil {
+		addedAt = t.AddedAt.Format(time.RFC3339)
+	}
+
+	record := []string{
+		escapeCSVFormula(t.ID), escapeCSVFormula(t.Name), escapeCSVFormula(strings.Join(t.Artists, ", ")),
+		escapeCSVFormula(t.ReleaseDate), strconv.Itoa(t.DurationMillis), formatFloat(t.Popularity),
+		strconv.FormatBool(t.Explicit), addedAt, escapeCSVFormula(t.SpotifyURL),
+	}
+	if t.AudioFeatures == nil {
+		return append(record, make([]string, len(tracksCSVHeader)-len(record))...)
+	}
+	f := t.AudioFeatures
+	return append(record,
+		formatFloat(f.Danceability), formatFloat(f.Energy), formatFloat(f.Speechiness), formatFloat(f.Acousticness),
+		formatFloat(f.Instrumentalness), formatFloat(f.Liveness), formatFloat(f.Valence), formatFloat(f.Tempo),
+		formatFloat(f.Loudness), f.Key, f.Mode, strconv.Itoa(f.TimeSignature),
+	)
+}
@@ -0,0 +1,148 @@
+package api_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jemgunay/spotify-unwrapped/api"
+	"github.com/jemgunay/spotify-unwrapped/config"
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/spotify/spotifytest"
+)
+
+// newTracksTestRouter routes an API backed by a fake server serving a playlist of an ordinary track, a track whose
+// metadata looks like spreadsheet formulas, and a track without audio features.
+func newTracksTestRouter(t *testing.T) http.Handler {
+	t.Helper()
+	srv := spotifytest.NewServer()
+	t.Cleanup(srv.Close)
+
+	srv.AddPlaylist(spotify.Playlist{ID: "p", Name: "Playlist p", Tracks: spotify.Tracks{
+		TrackItems: []spotify.TrackItem{
+			{TrackDetails: &spotify.TrackDetails{
+				ID: "a", Type: "track", Name: "Track A", Popularity: 50, DurationMillis: 180000,
+				Artists: []spotify.Artist{{Name: "Artist"}},
+				Album:   spotify.Album{ReleaseDate: "2001", ReleaseDatePrecision: "year"},
+			}},
+			{TrackDetails: &spotify.TrackDetails{
+				ID: "b", Type: "track", Name: `=HYPERLINK("http://evil","x")`,
+				Artists: []spotify.Artist{{Name: "@Artist"}, {Name: "-Other"}},
+			}},
+			{TrackDetails: &spotify.TrackDetails{ID: "c", Type: "track", Name: "Track C"}},
+		},
+	}})
+	srv.AddAudioFeatures(
+		spotify.AudioFeatures{ID: "a", Energy: 0.8, Valence: 0.25, Tempo: 120, Loudness: -6.5, Key: 9, Mode: 0,
+			TimeSignature: 4},
+		spotify.AudioFeatures{ID: "b", Energy: 0.5, Valence: 0.5, Key: -1, Mode: 1, TimeSignature: 3},
+	)
+	return newTestRouter(t, srv, config.API{})
+}
+
+// getTracks requests the playlist tracks with the given query string and Accept header.
+func getTracks(t *testing.T, router http.Handler, query, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/playlists/p/tracks"+query, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", w.Code)
+	}
+	return w
+}
+
+func TestTracksHandlerNegotiatesFormat(t *testing.T) {
+	router := newTracksTestRouter(t)
+
+	tests := []struct {
+		name, query, accept string
+		wantCSV             bool
+	}{
+		{name: "default"},
+		{name: "accept JSON", accept: "application/json"},
+		{name: "accept CSV", accept: "text/csv", wantCSV: true},
+		{name: "accept CSV among others", accept: "application/json;q=0.9, text/csv", wantCSV: true},
+		{name: "format query", query: "?format=csv", wantCSV: true},
+		{name: "format query takes precedence", query: "?format=json", accept: "text/csv"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := getTracks(t, router, test.query, test.accept)
+			contentType := w.Header().Get("Content-Type")
+			if gotCSV := strings.HasPrefix(contentType, "text/csv"); gotCSV != test.wantCSV {
+				t.Errorf("got content type %q, want CSV %t", contentType, test.wantCSV)
+			}
+			if vary := w.Header().Get("Vary"); vary != "Accept" {
+				t.Errorf("got Vary header %q, want Accept", vary)
+			}
+		})
+	}
+}
+
+func TestTracksHandlerJSON(t *testing.T) {
+	w := getTracks(t, newTracksTestRouter(t), "", "")
+	var resp api.TracksResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+
+	if resp.Metadata.Name != "Playlist p" || resp.Metadata.ExportedTracks != 3 || len(resp.Tracks) != 3 {
+		t.Fatalf("got metadata %+v and %d tracks, want the 3 tracks of Playlist p", resp.Metadata, len(resp.Tracks))
+	}
+	features := resp.Tracks[0].AudioFeatures
+	if features == nil || features.Energy != 0.8 || features.Key != "A" || features.Mode != "minor" {
+		t.Errorf("got audio features %+v for the first track, want its energy, key and mode", features)
+	}
+	// JSON isn't interpreted by spreadsheets, so isn't escaped
+	if name := resp.Tracks[1].Name; name != `=HYPERLINK("http://evil","x")` {
+		t.Errorf("got name %q for the second track, want it unescaped", name)
+	}
+	if resp.Tracks[2].AudioFeatures != nil {
+		t.Errorf("got audio features %+v for the track without any, want none", resp.Tracks[2].AudioFeatures)
+	}
+}
+
+func TestTracksHandlerCSV(t *testing.T) {
+	w := getTracks(t, newTracksTestRouter(t), "?format=csv", "")
+	if disposition := w.Header().Get("Content-Disposition"); disposition != `attachment; filename=p.csv` {
+		t.Errorf("got content disposition %q, want an attachment named p.csv", disposition)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse CSV: %s", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want a header and 3 tracks", len(records))
+	}
+
+	wantHeader := []string{
+		"id", "name", "artists", "release_date", "duration_ms", "popularity", "explicit", "added_at", "spotify_url",
+		"danceability", "energy", "speechiness", "acousticness", "instrumentalness", "liveness", "valence", "tempo",
+		"loudness", "key", "mode", "time_signature",
+	}
+	if !reflect.DeepEqual(records[0], wantHeader) {
+		t.Errorf("got header %q, want %q", records[0], wantHeader)
+	}
+	wantRecords := [][]string{
+		{"a", "Track A", "Artist", "2001", "180000", "50", "false", "", "", "0", "0.8", "0", "0", "0", "0", "0.25",
+			"120", "-6.5", "A", "minor", "4"},
+		// formulas are escaped, and unknown keys are empty
+		{"b", `'=HYPERLINK("http://evil","x")`, "'@Artist, -Other", "", "0", "0", "false", "", "", "0", "0.5", "0",
+			"0", "0", "0", "0.5", "0", "0", "", "major", "3"},
+		// audio feature columns are empty for tracks without audio features
+		{"c", "Track C", "", "", "0", "0", "false", "", "", "", "", "", "", "", "", "", "", "", "", "", ""},
+	}
+	for i, want := range wantRecords {
+		if got := records[i+1]; !reflect.DeepEqual(got, want) {
+			t.Errorf("got record %d %q, want %q", i+1, got, want)
+		}
+	}
+}
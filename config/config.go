@@ -5,6 +5,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -13,7 +15,10 @@ import (
 // Config defines the service config.
 type Config struct {
 	Port    int
+	API     API
+	Auth    Auth
 	Spotify Spotify
+	Source  Source
 	Logger
 }
 
@@ -21,11 +26,71 @@ type Config struct {
 type Spotify struct {
 	ClientID     string
 	ClientSecret string
+	// APIURL is the base URL of the Spotify Web API, e.g. https://api.spotify.com/v1/
+	APIURL string
+	// AccountsURL is the base URL of the Spotify accounts service, e.g. https://accounts.spotify.com/
+	AccountsURL string
+	// Concurrency is the maximum number of playlist track pages or audio features batches fetched concurrently.
+	Concurrency int
+	// RequestsPerSecond limits the rate of requests made to the Spotify API. Zero disables limiting.
+	RequestsPerSecond int
+	// MaxPlaylistTracks is the maximum number of tracks fetched per playlist. Zero disables the limit.
+	MaxPlaylistTracks int
+	// TokenRefreshMargin is how long before expiry the access token is renewed in the background. Zero disables
+	// background renewal, in which case the token is renewed on the first request after it expires.
+	TokenRefreshMargin time.Duration
+	// TokenCachePath is the file which access tokens are persisted to, so that they survive restarts. Empty disables
+	// persistence.
+	TokenCachePath string
+}
+
+// API defines the HTTP API config.
+type API struct {
+	// StreamPlaylists enables aggregating playlist stats page by page as tracks are fetched, rather than fetching the
+	// entire playlist before aggregating it, so that memory usage is bounded regardless of the size of the playlist.
+	// Distribution stats and correlations are then estimated from a sample of the tracks, and the per-track chart
+	// data is omitted.
+	StreamPlaylists bool
+	// ListeningSessionGap is the minimum gap between plays which separates two listening sessions.
+	ListeningSessionGap time.Duration
+	// MoodValenceThreshold and MoodEnergyThreshold are the valence and energy values, from 0 to 1, which divide tracks
+	// into mood quadrants. If either is outside of (0, 1], e.g. zero, both default to 0.5.
+	MoodValenceThreshold float64
+	MoodEnergyThreshold  float64
+}
+
+// Auth defines the config for the user login flow.
+type Auth struct {
+	// RedirectURL is the URL of the /auth/callback endpoint, which must be registered with the Spotify application.
+	RedirectURL string
+	// Scopes are the Spotify authorisation scopes requested from users.
+	Scopes []string
+	// SessionSecret is the key used to sign session cookies. If empty, a random key is generated on startup, which
+	// invalidates existing sessions on restart.
+	SessionSecret string
+	// SessionTTL is how long a user session lasts.
+	SessionTTL time.Duration
+	// SecureCookies restricts session cookies to HTTPS.
+	SecureCookies bool
+	// UIURL is where users are redirected to after logging in or out.
+	UIURL string
+}
+
+// Source defines where playlist data is sourced from.
+type Source struct {
+	// Kind is either "spotify" for the live Spotify API, or "fixture" for the JSON fixture files in FixtureDir.
+	Kind       string
+	FixtureDir string
+	// CacheTTL is how long fetched playlists and audio features are cached for. Zero disables caching.
+	CacheTTL time.Duration
 }
 
 // New initialises a Config from environment variables.
 func New() Config {
 	debug := flag.Bool("debug", false, "log level")
+	apiURL := flag.String("spotify-api-url", "", "Spotify Web API base URL (overrides SPOTIFY_API_URL)")
+	accountsURL := flag.String("spotify-accounts-url", "",
+		"Spotify accounts service base URL (overrides SPOTIFY_ACCOUNTS_URL)")
 	flag.Parse()
 
 	logLevel := zapcore.InfoLevel
@@ -37,9 +102,36 @@ func New() Config {
 	// attempt to get config environment vars, or default them
 	return Config{
 		Port: getEnvVarInt(logger, "PORT", 8080),
+		API: API{
+			StreamPlaylists:      getEnvVarBool(logger, "STREAM_PLAYLISTS", false),
+			ListeningSessionGap:  getEnvVarDuration(logger, "LISTENING_SESSION_GAP", time.Minute*30),
+			MoodValenceThreshold: getEnvVarFloat(logger, "MOOD_VALENCE_THRESHOLD", 0.5),
+			MoodEnergyThreshold:  getEnvVarFloat(logger, "MOOD_ENERGY_THRESHOLD", 0.5),
+		},
+		Auth: Auth{
+			RedirectURL: getEnvVar(logger, "AUTH_REDIRECT_URL", "http://localhost:8080/auth/callback"),
+			Scopes: strings.Fields(getEnvVar(logger, "AUTH_SCOPES",
+				"user-top-read user-library-read user-read-recently-played playlist-read-private")),
+			SessionSecret: getEnvVar(logger, "SESSION_SECRET", ""),
+			SessionTTL:    getEnvVarDuration(logger, "SESSION_TTL", time.Hour*24*7),
+			SecureCookies: getEnvVarBool(logger, "SECURE_COOKIES", false),
+			UIURL:         getEnvVar(logger, "UI_URL", "http://localhost:8081/"),
+		},
 		Spotify: Spotify{
-			ClientID:     getEnvVar(logger, "SPOTIFY_CLIENT_ID", ""),
-			ClientSecret: getEnvVar(logger, "SPOTIFY_CLIENT_SECRET", ""),
+			ClientID:           getEnvVar(logger, "SPOTIFY_CLIENT_ID", ""),
+			ClientSecret:       getEnvVar(logger, "SPOTIFY_CLIENT_SECRET", ""),
+			APIURL:             getBaseURL(logger, *apiURL, "SPOTIFY_API_URL", "https://api.spotify.com/v1/"),
+			AccountsURL:        getBaseURL(logger, *accountsURL, "SPOTIFY_ACCOUNTS_URL", "https://accounts.spotify.com/"),
+			Concurrency:        getEnvVarInt(logger, "SPOTIFY_CONCURRENCY", 5),
+			RequestsPerSecond:  getEnvVarInt(logger, "SPOTIFY_REQUESTS_PER_SECOND", 20),
+			MaxPlaylistTracks:  getEnvVarInt(logger, "SPOTIFY_MAX_PLAYLIST_TRACKS", 10000),
+			TokenRefreshMargin: getEnvVarDuration(logger, "SPOTIFY_TOKEN_REFRESH_MARGIN", time.Minute*5),
+			TokenCachePath:     getEnvVar(logger, "SPOTIFY_TOKEN_CACHE_PATH", ""),
+		},
+		Source: Source{
+			Kind:       getEnvVar(logger, "PLAYLIST_SOURCE", "spotify"),
+			FixtureDir: getEnvVar(logger, "FIXTURE_DIR", "sample_data"),
+			CacheTTL:   getEnvVarDuration(logger, "SOURCE_CACHE_TTL", 0),
 		},
 		Logger: logger,
 	}
@@ -67,6 +159,40 @@ func getEnvVarInt(logger Logger, key string, defaultValue int) int {
 	return varInt
 }
 
+// getEnvVarFloat gets a floating point environment variable or defaults it if unset.
+func getEnvVarFloat(logger Logger, key string, defaultValue float64) float64 {
+	varStr := getEnvVar(logger, key, strconv.FormatFloat(defaultValue, 'f', -1, 64))
+	varFloat, _ := strconv.ParseFloat(varStr, 64)
+	return varFloat
+}
+
+// getBaseURL gets a base URL from the given flag value, falling back to an environment variable or its default. The
+// URL is normalised to end in a trailing slash so that paths can be appended to it.
+func getBaseURL(logger Logger, flagValue, key, defaultValue string) string {
+	val := flagValue
+	if val == "" {
+		val = getEnvVar(logger, key, defaultValue)
+	}
+	if !strings.HasSuffix(val, "/") {
+		val += "/"
+	}
+	return val
+}
+
+// getEnvVarBool gets a boolean environment variable, e.g. "true", or defaults it if unset.
+func getEnvVarBool(logger Logger, key string, defaultValue bool) bool {
+	varStr := getEnvVar(logger, key, strconv.FormatBool(defaultValue))
+	varBool, _ := strconv.ParseBool(varStr)
+	return varBool
+}
+
+// getEnvVarDuration gets a duration environment variable, e.g. "10m", or defaults it if unset.
+func getEnvVarDuration(logger Logger, key string, defaultValue time.Duration) time.Duration {
+	varStr := getEnvVar(logger, key, defaultValue.String())
+	varDuration, _ := time.ParseDuration(varStr)
+	return varDuration
+}
+
 // Logger defines the required logger methods.
 type Logger interface {
 	Debug(msg string, fields ...zapcore.Field)
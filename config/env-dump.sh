@@ -2,4 +2,23 @@
 
 echo "PORT: ${PORT}"
 echo "SPOTIFY_CLIENT_ID: ${CLIENT_ID}"
-echo "SPOTIFY_CLIENT_SECRET: ${CLIENT_SECRET}"
\ No newline at end of file
+echo "SPOTIFY_CLIENT_SECRET: ${CLIENT_SECRET}"
+echo "SPOTIFY_API_URL: ${SPOTIFY_API_URL}"
+echo "SPOTIFY_ACCOUNTS_URL: ${SPOTIFY_ACCOUNTS_URL}"
+echo "PLAYLIST_SOURCE: ${PLAYLIST_SOURCE}"
+echo "FIXTURE_DIR: ${FIXTURE_DIR}"
+echo "SOURCE_CACHE_TTL: ${SOURCE_CACHE_TTL}"
+echo "SPOTIFY_CONCURRENCY: ${SPOTIFY_CONCURRENCY}"
+echo "SPOTIFY_REQUESTS_PER_SECOND: ${SPOTIFY_REQUESTS_PER_SECOND}"
+echo "SPOTIFY_MAX_PLAYLIST_TRACKS: ${SPOTIFY_MAX_PLAYLIST_TRACKS}"
+echo "STREAM_PLAYLISTS: ${STREAM_PLAYLISTS}"
+echo "LISTENING_SESSION_GAP: ${LISTENING_SESSION_GAP}"
+echo "MOOD_VALENCE_THRESHOLD: ${MOOD_VALENCE_THRESHOLD}"
+echo "MOOD_ENERGY_THRESHOLD: ${MOOD_ENERGY_THRESHOLD}"
+echo "SPOTIFY_TOKEN_REFRESH_MARGIN: ${SPOTIFY_TOKEN_REFRESH_MARGIN}"
+echo "SPOTIFY_TOKEN_CACHE_PATH: ${SPOTIFY_TOKEN_CACHE_PATH}"
+echo "AUTH_REDIRECT_URL: ${AUTH_REDIRECT_URL}"
+echo "AUTH_SCOPES: ${AUTH_SCOPES}"
+echo "SESSION_TTL: ${SESSION_TTL}"
+echo "SECURE_COOKIES: ${SECURE_COOKIES}"
+echo "UI_URL: ${UI_URL}"
@@ -0,0 +1,291 @@
+// Package history parses and analyses the streaming history files from Spotify's "Download your data" privacy export,
+// which cover far more listening than the Spotify API exposes. Both the account data export (StreamingHistory*.json)
+// and the extended streaming history export (endsong_*.json or Streaming_History_Audio_*.json) are supported.
+package history
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Play is a single play of a track or podcast episode.
+type Play struct {
+	// EndTime is when playback ended.
+	EndTime time.Time
+	Track   string
+	Artist  string
+	Album   string
+	// TrackID is the Spotify track ID. It is only provided by extended streaming history.
+	TrackID string
+	Played  time.Duration
+	// Episode indicates that a podcast episode was played, in which case Track is the episode name and Artist is the
+	// show name.
+	Episode bool
+	// Skipped indicates that the play was skipped. Extended streaming history records skips explicitly; otherwise
+	// plays shorter than the minimum stream duration are considered skipped.
+	Skipped bool
+}
+
+// IsStream reports whether the play counts as a stream, i.e. it is of a track, was not skipped and was played for at
+// least MinStreamDuration.
+func (p Play) IsStream() bool {
+	return !p.Episode && !p.Skipped && p.Played >= MinStreamDuration
+}
+
+// MinStreamDuration is the minimum duration that a track must be played for to count as a stream, as per Spotify.
+const MinStreamDuration = time.Second * 30
+
+// ErrUnrecognisedFormat indicates that a file is not a recognised streaming history file.
+var ErrUnrecognisedFormat = errors.New("unrecognised streaming history format")
+
+// ErrFileTooLarge indicates that an export ZIP file exceeds the limits on its decompression: MaxZipFileBytes,
+// MaxZipBytes or MaxZipEntries.
+var ErrFileTooLarge = errors.New("streaming history file too large")
+
+// The decompression of export ZIP files is limited, protecting against ZIP bombs. Spotify splits streaming history
+// into files of at most a few tens of megabytes, and exports contain at most a few dozen files.
+const (
+	// MaxZipFileBytes limits the decompressed size of each streaming history file within an export ZIP file.
+	MaxZipFileBytes = 128 << 20
+	// MaxZipBytes limits the total decompressed size of the streaming history files within an export ZIP file.
+	MaxZipBytes = 512 << 20
+	// MaxZipEntries limits the number of files and directories within an export ZIP file.
+	MaxZipEntries = 1000
+)
+
+// zipLimits are the limits on the decompression of an export ZIP file.
+type zipLimits struct {
+	fileBytes, totalBytes int64
+	entries               int
+}
+
+var defaultZipLimits = zipLimits{fileBytes: MaxZipFileBytes, totalBytes: MaxZipBytes, entries: MaxZipEntries}
+
+// rawPlay is the union of the fields of both streaming history formats.
+type rawPlay struct {
+	// account data streaming history
+	EndTime     string `json:"endTime"`
+	ArtistName  string `json:"artistName"`
+	TrackName   string `json:"trackName"`
+	PodcastName string `json:"podcastName"`
+	EpisodeName string `json:"episodeName"`
+	MSPlayed    int64  `json:"msPlayed"`
+
+	// extended streaming history, where track fields are null for podcast episodes and vice versa
+	Timestamp          string  `json:"ts"`
+	ExtMSPlayed        int64   `json:"ms_played"`
+	ExtTrackName       *string `json:"master_metadata_track_name"`
+	ExtArtistName      *string `json:"master_metadata_album_artist_name"`
+	ExtAlbumName       *string `json:"master_metadata_album_album_name"`
+	ExtTrackURI        *string `json:"spotify_track_uri"`
+	ExtEpisodeName     *string `json:"episode_name"`
+	ExtEpisodeShowName *string `json:"episode_show_name"`
+	ExtReasonEnd       string  `json:"reason_end"`
+	ExtSkipped         *bool   `json:"skipped"`
+}
+
+// Parse parses a streaming history JSON file in either format. Plays which have no track or episode name, e.g. of
+// content which has since been removed from Spotify, are skipped.
+func Parse(r io.Reader) ([]Play, error) {
+	var raw []rawPlay
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnrecognisedFormat, err)
+	}
+
+	plays := make([]Play, 0, len(raw))
+	for i, rp := range raw {
+		var (
+			play Play
+			err  error
+		)
+		switch {
+		case rp.Timestamp != "":
+			play, err = rp.extendedPlay()
+		case rp.EndTime != "":
+			play, err = rp.accountDataPlay()
+		default:
+			err = ErrUnrecognisedFormat
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse play %d: %w", i, err)
+		}
+		if play.Track != "" {
+			plays = append(plays, play)
+		}
+	}
+	return plays, nil
+}
+
+func (rp rawPlay) accountDataPlay() (Play, error) {
+	// account data end times are in UTC, to the minute
+	endTime, err := time.Parse("2006-01-02 15:04", rp.EndTime)
+	if err != nil {
+		return Play{}, fmt.Errorf("failed to parse end time: %w", err)
+	}
+
+	play := Play{
+		EndTime: endTime,
+		Track:   rp.TrackName,
+		Artist:  rp.ArtistName,
+		Played:  time.Duration(rp.MSPlayed) * time.Millisecond,
+	}
+	if rp.EpisodeName != "" {
+		play.Episode = true
+		play.Track, play.Artist = rp.EpisodeName, rp.PodcastName
+	}
+	play.Skipped = play.Played < MinStreamDuration
+	return play, nil
+}
+
+func (rp rawPlay) extendedPlay() (Play, error) {
+	endTime, err := time.Parse(time.RFC3339, rp.Timestamp)
+	if err != nil {
+		return Play{}, fmt.Errorf("failed to parse timestamp: %w", err)
+	}
+
+	play := Play{
+		EndTime: endTime,
+		Track:   deref(rp.ExtTrackName),
+		Artist:  deref(rp.ExtArtistName),
+		Album:   deref(rp.ExtAlbumName),
+		TrackID: strings.TrimPrefix(deref(rp.ExtTrackURI), "spotify:track:"),
+		Played:  time.Duration(rp.ExtMSPlayed) * time.Millisecond,
+	}
+	if play.Track == "" && deref(rp.ExtEpisodeName) != "" {
+		play.Episode = true
+		play.Track, play.Artist = deref(rp.ExtEpisodeName), deref(rp.ExtEpisodeShowName)
+	}
+
+	// older exports don't record skips, but do record why playback ended
+	switch {
+	case rp.ExtSkipped != nil:
+		play.Skipped = *rp.ExtSkipped
+	case rp.ExtReasonEnd != "":
+		play.Skipped = rp.ExtReasonEnd == "fwdbtn"
+	default:
+		play.Skipped = play.Played < MinStreamDuration
+	}
+	return play, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// IsHistoryFile reports whether the given file name is that of a streaming history file within an export. Video
+// streaming history is not supported.
+func IsHistoryFile(name string) bool {
+	base := path.Base(name)
+	if !strings.HasSuffix(base, ".json") {
+		return false
+	}
+	for _, prefix := range []string{"StreamingHistory", "endsong", "Streaming_History_Audio"} {
+		if strings.HasPrefix(base, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// zipMagic is the signature which ZIP files begin with.
+var zipMagic = []byte("PK\x03\x04")
+
+// ParseFile parses the contents of a streaming history JSON file, or of an export ZIP file, in which case every
+// streaming history file within it is parsed.
+func ParseFile(name string, data []byte) ([]Play, error) {
+	if !bytes.HasPrefix(data, zipMagic) {
+		plays, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		return plays, nil
+	}
+
+	return parseZip(name, data, defaultZipLimits)
+}
+
+// parseZip parses every streaming history file within an export ZIP file, within the given limits.
+func parseZip(name string, data []byte, limits zipLimits) ([]Play, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ZIP file %s: %w", name, err)
+	}
+	if len(archive.File) > limits.entries {
+		return nil, fmt.Errorf("%w: %s contains more than %d files", ErrFileTooLarge, name, limits.entries)
+	}
+
+	var plays []Play
+	remaining := limits.totalBytes
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || !IsHistoryFile(file.Name) {
+			continue
+		}
+		limit := limits.fileBytes
+		if remaining < limit {
+			limit = remaining
+		}
+		fileData, err := readZipFile(file, limit)
+		if errors.Is(err, ErrFileTooLarge) && limit < limits.fileBytes {
+			return nil, fmt.Errorf("%w: %s decompresses to more than %d bytes in total", ErrFileTooLarge, name,
+				limits.totalBytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s in %s: %w", file.Name, name, err)
+		}
+		remaining -= int64(len(fileData))
+
+		filePlays, err := Parse(bytes.NewReader(fileData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s in %s: %w", file.Name, name, err)
+		}
+		plays = append(plays, filePlays...)
+	}
+	return plays, nil
+}
+
+// readZipFile decompresses a file within an export ZIP file, up to limit bytes. The size recorded in the ZIP file
+// can't be trusted, so the decompressed size is limited as it is read.
+func readZipFile(file *zip.File, limit int64) ([]byte, error) {
+	r, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: decompresses to more than %d bytes", ErrFileTooLarge, limit)
+	}
+	return data, nil
+}
+
+// ReadFiles reads and parses the given streaming history JSON or export ZIP files.
+func ReadFiles(paths ...string) ([]Play, error) {
+	var plays []Play
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read streaming history file: %w", err)
+		}
+		filePlays, err := ParseFile(p, data)
+		if err != nil {
+			return nil, err
+		}
+		plays = append(plays, filePlays...)
+	}
+	return plays, nil
+}
@@ -0,0 +1,89 @@
+package history
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newZip returns a ZIP file containing the given files.
+func newZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, contents := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", name, err)
+		}
+		if _, err := f.Write([]byte(contents)); err != nil {
+			t.Fatalf("failed to write %s: %s", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close ZIP writer: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseFileZip(t *testing.T) {
+	data := newZip(t, map[string]string{
+		"MyData/StreamingHistory0.json": `[{"endTime":"2022-01-01 10:00","artistName":"Artist","trackName":"Track",` +
+			`"msPlayed":180000}]`,
+		"MyData/Userdata.json": `{}`,
+	})
+
+	plays, err := ParseFile("export.zip", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(plays) != 1 || plays[0].Track != "Track" {
+		t.Errorf("got plays %+v, want the single play of the streaming history file", plays)
+	}
+}
+
+func TestParseFileZipBomb(t *testing.T) {
+	// highly compressible, so the ZIP file is small while its contents exceed the limit
+	padding := strings.Repeat(" ", MaxZipFileBytes)
+	data := newZip(t, map[string]string{"MyData/StreamingHistory0.json": "[" + padding + "]"})
+	if len(data) > MaxZipFileBytes/100 {
+		t.Fatalf("got ZIP file of %d bytes, want it to be highly compressed", len(data))
+	}
+
+	if _, err := ParseFile("export.zip", data); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("got error %v, want ErrFileTooLarge", err)
+	}
+}
+
+func TestParseFileZipLimitsTotalSize(t *testing.T) {
+	// many small files, each within the per-file limit, which exceed the total limit between them
+	play := `[{"endTime":"2022-01-01 10:00","artistName":"Artist","trackName":"Track","msPlayed":180000}]`
+	files := make(map[string]string, 50)
+	for i := 0; i < 50; i++ {
+		files["MyData/StreamingHistory"+strconv.Itoa(i)+".json"] = play
+	}
+	data := newZip(t, files)
+	limits := zipLimits{fileBytes: int64(len(play)), totalBytes: int64(len(play)) * 40, entries: 100}
+
+	if _, err := parseZip("export.zip", data, limits); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("got error %v, want ErrFileTooLarge", err)
+	}
+	limits.totalBytes = int64(len(play)) * 50
+	if plays, err := parseZip("export.zip", data, limits); err != nil || len(plays) != 50 {
+		t.Errorf("got %d plays and error %v, want the 50 plays within the limit", len(plays), err)
+	}
+}
+
+func TestParseFileZipLimitsEntries(t *testing.T) {
+	files := make(map[string]string, MaxZipEntries+1)
+	for i := 0; i <= MaxZipEntries; i++ {
+		files["MyData/Other"+strconv.Itoa(i)+".json"] = "{}"
+	}
+
+	if _, err := ParseFile("export.zip", newZip(t, files)); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("got error %v, want ErrFileTooLarge", err)
+	}
+}
@@ -0,0 +1,279 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/stats"
+)
+
+// minPlaysForSkipRate is the minimum number of plays a track must have for its skip rate to be reported.
+const minPlaysForSkipRate = 5
+
+// Report summarises streaming history. Play counts only include streams, i.e. track plays which were not skipped and
+// lasted at least MinStreamDuration; podcast episodes are only included in the totals.
+type Report struct {
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	Plays         int       `json:"plays"`
+	Streams       int       `json:"streams"`
+	EpisodePlays  int       `json:"episode_plays"`
+	ListeningTime string    `json:"listening_time"`
+	// ListeningHours is the total listening time in hours, including podcast episodes.
+	ListeningHours float64 `json:"listening_hours"`
+	// SkipRate is the percentage of track plays which were skipped.
+	SkipRate   float64              `json:"skip_rate"`
+	TopTracks  *stats.OrderedKVPair `json:"top_tracks"`
+	TopArtists *stats.OrderedKVPair `json:"top_artists"`
+	// MostSkipped are the tracks with the highest skip rate as a percentage, of those played at least 5 times.
+	MostSkipped *stats.OrderedKVPair `json:"most_skipped"`
+	// ByHour and ByWeekday are the minutes listened by hour of day and by day of week.
+	ByHour    *stats.OrderedKVPair `json:"by_hour"`
+	ByWeekday *stats.OrderedKVPair `json:"by_weekday"`
+	// TopTracksByYear are the top tracks of each year, keyed by year.
+	TopTracksByYear map[string]*stats.OrderedKVPair `json:"top_tracks_by_year"`
+	// Enrichment is the audio feature analysis of the tracks streamed, if requested.
+	Enrichment *Enrichment `json:"enrichment,omitempty"`
+}
+
+// Opt defines an Analyse or Enrich option.
+type Opt func(*analyseOpts)
+
+type analyseOpts struct {
+	location *time.Location
+	topN     int
+}
+
+// WithLocation sets the time zone used to determine the hour of day, day of week and year of plays. Defaults to UTC.
+func WithLocation(location *time.Location) Opt {
+	return func(o *analyseOpts) {
+		o.location = location
+	}
+}
+
+// WithTopN sets the number of top tracks and artists reported. Defaults to 50. It has no effect on Enrich.
+func WithTopN(n int) Opt {
+	return func(o *analyseOpts) {
+		o.topN = n
+	}
+}
+
+func newAnalyseOpts(opts []Opt) analyseOpts {
+	o := analyseOpts{
+		location: time.UTC,
+		topN:     50,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Analyse analyses the given plays, which may be in any order.
+func Analyse(plays []Play, opts ...Opt) Report {
+	o := newAnalyseOpts(opts)
+
+	var (
+		report        = Report{TopTracksByYear: make(map[string]*stats.OrderedKVPair)}
+		totalPlayed   time.Duration
+		trackPlays    int
+		skips         int
+		trackCounts   = stats.NewMapping(1000)
+		artistCounts  = stats.NewMapping(1000)
+		playCounts    = stats.NewMapping(1000)
+		skipCounts    = stats.NewMapping(1000)
+		hourMinutes   = stats.NewMapping(24)
+		dayMinutes    = stats.NewMapping(7)
+		yearlyStreams = make(map[string]stats.Mapping)
+	)
+	for _, play := range plays {
+		report.Plays++
+		totalPlayed += play.Played
+		if report.From.IsZero() || play.EndTime.Before(report.From) {
+			report.From = play.EndTime
+		}
+		if play.EndTime.After(report.To) {
+			report.To = play.EndTime
+		}
+
+		localTime := play.EndTime.In(o.location)
+		minutes := int(math.Round(play.Played.Minutes()))
+		hourMinutes[strconv.Itoa(localTime.Hour())] += minutes
+		dayMinutes[localTime.Weekday().String()] += minutes
+
+		if play.Episode {
+			report.EpisodePlays++
+			continue
+		}
+
+		trackPlays++
+		key := play.Artist + " - " + play.Track
+		playCounts.Push(key)
+		if play.Skipped {
+			skips++
+			skipCounts.Push(key)
+		}
+		if !play.IsStream() {
+			continue
+		}
+
+		report.Streams++
+		trackCounts.Push(key)
+		artistCounts.Push(play.Artist)
+		year := strconv.Itoa(localTime.Year())
+		if yearlyStreams[year] == nil {
+			yearlyStreams[year] = stats.NewMapping(100)
+		}
+		yearlyStreams[year].Push(key)
+	}
+
+	report.ListeningTime = stats.FormatDuration(totalPlayed.Round(time.Minute))
+	report.ListeningHours = math.Round(totalPlayed.Hours()*10) / 10
+	if trackPlays > 0 {
+		report.SkipRate = math.Round(float64(skips)/float64(trackPlays)*1000) / 10
+	}
+
+	topSort := stats.WithSort(stats.SortValue, true)
+	report.TopTracks = trackCounts.OrderedLabelsAndValues(topSort, stats.WithTruncate(o.topN))
+	report.TopArtists = artistCounts.OrderedLabelsAndValues(topSort, stats.WithTruncate(o.topN))
+	for year, streams := range yearlyStreams {
+		report.TopTracksByYear[year] = streams.OrderedLabelsAndValues(topSort, stats.WithTruncate(10))
+	}
+
+	skipRates := stats.NewMapping(len(skipCounts))
+	for key, skipped := range skipCounts {
+		if played := playCounts[key]; played >= minPlaysForSkipRate {
+			skipRates[key] = int(math.Round(float64(skipped) / float64(played) * 100))
+		}
+	}
+	report.MostSkipped = skipRates.OrderedLabelsAndValues(topSort, stats.WithTruncate(20))
+
+	report.ByHour = orderedByKeys(hourMinutes, hours)
+	report.ByWeekday = orderedByKeys(dayMinutes, weekdays)
+	return report
+}
+
+var (
+	hours    = make([]string, 24)
+	weekdays = []string{
+		time.Monday.String(), time.Tuesday.String(), time.Wednesday.String(), time.Thursday.String(),
+		time.Friday.String(), time.Saturday.String(), time.Sunday.String(),
+	}
+)
+
+func init() {
+	for i := range hours {
+		hours[i] = strconv.Itoa(i)
+	}
+}
+
+// orderedByKeys converts a Mapping to an OrderedKVPair in the given key order, including keys with no count.
+func orderedByKeys(m stats.Mapping, keys []string) *stats.OrderedKVPair {
+	pair := &stats.OrderedKVPair{
+		// copy the keys so that the package level key orders can't be modified through the report
+		Keys:   append([]string(nil), keys...),
+		Values: make([]int, 0, len(keys)),
+	}
+	for _, k := range keys {
+		pair.Values = append(pair.Values, m[k])
+	}
+	return pair
+}
+
+// AudioFeaturesSource provides track audio feature data. It is satisfied by spotify.Requester.
+type AudioFeaturesSource interface {
+	GetAudioFeatures(ctx context.Context, trackIDs []string) ([]spotify.AudioFeatures, error)
+}
+
+// Enrichment is the audio feature analysis of the tracks streamed. It requires track IDs, so is only possible for
+// extended streaming history.
+type Enrichment struct {
+	// AnalysedStreams is the number of streams which audio features were found for.
+	AnalysedStreams int `json:"analysed_streams"`
+	// ByYear is the average audio features of the streams of each year, weighted by the number of streams.
+	ByYear []YearFeatures `json:"by_year"`
+}
+
+// YearFeatures is the average audio features of a year of streams.
+type YearFeatures struct {
+	Year         int     `json:"year"`
+	Streams      int     `json:"streams"`
+	Energy       float64 `json:"energy"`
+	Valence      float64 `json:"valence"`
+	Tempo        float64 `json:"tempo"`
+	Danceability float64 `json:"danceability"`
+	Acousticness float64 `json:"acousticness"`
+}
+
+// Enrich fetches the audio features of the tracks streamed from the given source. If only some audio features could
+// be fetched, the enrichment of those is returned alongside the error. Streams are grouped into years in the time zone
+// set by WithLocation, as with Analyse.
+func Enrich(ctx context.Context, source AudioFeaturesSource, plays []Play, opts ...Opt) (*Enrichment, error) {
+	o := newAnalyseOpts(opts)
+	var trackIDs []string
+	seen := make(map[string]struct{})
+	for _, play := range plays {
+		if play.TrackID == "" || !play.IsStream() {
+			continue
+		}
+		if _, ok := seen[play.TrackID]; !ok {
+			seen[play.TrackID] = struct{}{}
+			trackIDs = append(trackIDs, play.TrackID)
+		}
+	}
+	enrichment := &Enrichment{ByYear: []YearFeatures{}}
+	if len(trackIDs) == 0 {
+		return enrichment, nil
+	}
+
+	audioFeatures, err := source.GetAudioFeatures(ctx, trackIDs)
+	var audioFeaturesErr *spotify.AudioFeaturesError
+	if err != nil && !(errors.As(err, &audioFeaturesErr) && len(audioFeatures) > 0) {
+		return nil, err
+	}
+	features := make(map[string]spotify.AudioFeatures, len(audioFeatures))
+	for _, feature := range audioFeatures {
+		features[feature.ID] = feature
+	}
+
+	years := make(map[int]*YearFeatures)
+	for _, play := range plays {
+		feature, ok := features[play.TrackID]
+		if !ok || !play.IsStream() {
+			continue
+		}
+		enrichment.AnalysedStreams++
+		localYear := play.EndTime.In(o.location).Year()
+		year, ok := years[localYear]
+		if !ok {
+			year = &YearFeatures{Year: localYear}
+			years[localYear] = year
+		}
+		year.Streams++
+		year.Energy += feature.Energy
+		year.Valence += feature.Valence
+		year.Tempo += feature.Tempo
+		year.Danceability += feature.Danceability
+		year.Acousticness += feature.Acousticness
+	}
+
+	for _, year := range years {
+		n := float64(year.Streams)
+		// energy, valence, danceability and acousticness are reported as percentages
+		year.Energy = math.Round(year.Energy / n * 100)
+		year.Valence = math.Round(year.Valence / n * 100)
+		year.Tempo = math.Round(year.Tempo / n)
+		year.Danceability = math.Round(year.Danceability / n * 100)
+		year.Acousticness = math.Round(year.Acousticness / n * 100)
+		enrichment.ByYear = append(enrichment.ByYear, *year)
+	}
+	sort.Slice(enrichment.ByYear, func(i, j int) bool {
+		return enrichment.ByYear[i].Year < enrichment.ByYear[j].Year
+	})
+	return enrichment, err
+}
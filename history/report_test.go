@@ -0,0 +1,61 @@
+package history
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+func TestAnalyseDoesNotShareKeyOrders(t *testing.T) {
+	report := Analyse([]Play{{EndTime: time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC), Played: time.Minute}})
+	report.ByHour.Keys[0] = "modified"
+	report.ByWeekday.Keys[0] = "modified"
+
+	if hours[0] != "0" || weekdays[0] != "Monday" {
+		t.Errorf("modifying a report changed the key orders of later reports: %q, %q", hours[0], weekdays[0])
+	}
+}
+
+type fakeAudioFeaturesSource map[string]spotify.AudioFeatures
+
+func (s fakeAudioFeaturesSource) GetAudioFeatures(_ context.Context, trackIDs []string) ([]spotify.AudioFeatures,
+	error) {
+	features := make([]spotify.AudioFeatures, 0, len(trackIDs))
+	for _, id := range trackIDs {
+		if feature, ok := s[id]; ok {
+			features = append(features, feature)
+		}
+	}
+	return features, nil
+}
+
+func TestEnrichUsesLocationForYears(t *testing.T) {
+	location, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %s", err)
+	}
+	// late on New Year's Eve in UTC, but New Year's Day in Tokyo
+	plays := []Play{{
+		EndTime: time.Date(2021, 12, 31, 20, 0, 0, 0, time.UTC),
+		Track:   "Track",
+		Artist:  "Artist",
+		TrackID: "track",
+		Played:  time.Minute * 3,
+	}}
+	source := fakeAudioFeaturesSource{"track": {ID: "track", Energy: 0.5}}
+	opts := []Opt{WithLocation(location)}
+
+	report := Analyse(plays, opts...)
+	if _, ok := report.TopTracksByYear["2022"]; !ok {
+		t.Fatalf("got top tracks by year %v, want the play in 2022", report.TopTracksByYear)
+	}
+	enrichment, err := Enrich(context.Background(), source, plays, opts...)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(enrichment.ByYear) != 1 || enrichment.ByYear[0].Year != 2022 {
+		t.Errorf("got enrichment by year %+v, want the stream in 2022 as with Analyse", enrichment.ByYear)
+	}
+}
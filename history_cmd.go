@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/config"
+	"github.com/jemgunay/spotify-unwrapped/history"
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// runHistoryCommand analyses the given streaming history files from Spotify's "Download your data" privacy export and
+// writes the report to stdout as JSON. It works entirely offline unless enrichment is requested.
+func runHistoryCommand(conf config.Config, args []string) error {
+	logger := conf.Logger
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	tz := flags.String("tz", "UTC", "time zone for hour of day and day of week stats, e.g. Europe/London")
+	top := flags.Int("top", 50, "number of top tracks and artists to report")
+	enrich := flags.Bool("enrich", false,
+		"enrich the analysis with audio features from the Spotify API (requires SPOTIFY_CLIENT_ID and SPOTIFY_CLIENT_SECRET)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(),
+			"usage: spotify-unwrapped history [flags] <StreamingHistory*.json|endsong_*.json|export.zip>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("no streaming history files provided")
+	}
+
+	location, err := time.LoadLocation(*tz)
+	if err != nil {
+		return fmt.Errorf("failed to load time zone: %w", err)
+	}
+	plays, err := history.ReadFiles(flags.Args()...)
+	if err != nil {
+		return err
+	}
+	opts := []history.Opt{history.WithLocation(location), history.WithTopN(*top)}
+	report := history.Analyse(plays, opts...)
+
+	if *enrich {
+		if conf.Spotify.ClientID == "" || conf.Spotify.ClientSecret == "" {
+			logger.Warn("skipping streaming history enrichment as no Spotify credentials are configured")
+		} else {
+			spotifyReq := spotify.New(logger, conf.Spotify)
+			defer spotifyReq.Close()
+			report.Enrichment, err = history.Enrich(context.Background(), spotifyReq, plays, opts...)
+			if err != nil && report.Enrichment == nil {
+				return fmt.Errorf("failed to enrich streaming history: %w", err)
+			}
+			if err != nil {
+				logger.Warn("failed to fetch some streaming history audio features", zap.Error(err))
+			}
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"flag"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -12,15 +14,46 @@ import (
 
 	"github.com/jemgunay/spotify-unwrapped/api"
 	"github.com/jemgunay/spotify-unwrapped/config"
+	"github.com/jemgunay/spotify-unwrapped/source"
 	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/spotify/auth"
 )
 
 func main() {
 	conf := config.New()
 	logger := conf.Logger
 
-	// generate Spotify client auth token
+	// subcommands
+	if flag.Arg(0) == "history" {
+		if err := runHistoryCommand(conf, flag.Args()[1:]); err != nil {
+			logger.Fatal("failed to analyse streaming history", zap.Error(err))
+		}
+		return
+	}
+
+	// the Spotify requester is always required for performing requests on behalf of logged in users
 	spotifyReq := spotify.New(logger, conf.Spotify)
+	defer spotifyReq.Close()
+
+	// select the playlist data source
+	var playlistSource api.PlaylistSource
+	switch conf.Source.Kind {
+	case "spotify":
+		playlistSource = spotifyReq
+	case "fixture":
+		fixture, err := source.NewFixture(conf.Source.FixtureDir)
+		if err != nil {
+			logger.Fatal("failed to load fixture playlist source", zap.Error(err))
+			return
+		}
+		playlistSource = fixture
+	default:
+		logger.Fatal("unsupported playlist source", zap.String("source", conf.Source.Kind))
+		return
+	}
+	if conf.Source.CacheTTL > 0 {
+		playlistSource = source.NewCache(playlistSource, conf.Source.CacheTTL)
+	}
 
 	// caching middleware
 	cacheMiddleware, err := newCacheMiddleware()
@@ -29,11 +62,38 @@ func main() {
 		return
 	}
 
+	// user login
+	flow := auth.NewAuthorizationCode(http.DefaultClient, conf.Spotify.AccountsURL, conf.Spotify.ClientID,
+		conf.Auth.RedirectURL, conf.Auth.Scopes)
+	authHandlers, err := api.NewAuth(logger, conf.Auth, flow, spotifyReq)
+	if err != nil {
+		logger.Fatal("failed to initialise auth handlers", zap.Error(err))
+		return
+	}
+
 	// define HTTP handlers
-	handlers := api.New(logger, spotifyReq)
+	handlers := api.New(logger, conf.API, playlistSource, api.WithAuth(authHandlers))
 	r := mux.NewRouter()
-	r.Use(allowCORSMiddleware, cacheMiddleware)
-	r.HandleFunc("/api/v1/playlists/{playlistID}", handlers.PlaylistsHandler).Methods(http.MethodGet)
+	r.Use(newCORSMiddleware(conf.Auth.UIURL))
+	r.HandleFunc("/auth/login", authHandlers.LoginHandler).Methods(http.MethodGet)
+	r.HandleFunc("/auth/callback", authHandlers.CallbackHandler).Methods(http.MethodGet)
+	// logout changes state, so must not be triggered by cross-site links or images
+	r.HandleFunc("/auth/logout", authHandlers.LogoutHandler).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/me/top", handlers.TopHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/me/library", handlers.LibraryHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/me/sessions", handlers.SessionsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/history", handlers.HistoryHandler).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/analyse", handlers.AnalyseHandler).Methods(http.MethodPost)
+	r.HandleFunc("/api/openapi.json", handlers.OpenAPIHandler).Methods(http.MethodGet)
+	// the cache ignores the Vary header, so the content negotiated track export must not be cached
+	r.HandleFunc("/api/v1/playlists/{playlistID}/tracks", handlers.TracksHandler).Methods(http.MethodGet)
+
+	// responses are cached by URL, so only routes which do not depend on the user may be cached
+	cached := r.NewRoute().Subrouter()
+	cached.Use(cacheMiddleware)
+	cached.HandleFunc("/api/v1/playlists/{playlistID}", handlers.PlaylistsHandler).Methods(http.MethodGet)
+	cached.HandleFunc("/api/v2/playlists/{playlistID}", handlers.PlaylistsV2Handler).Methods(http.MethodGet)
+	cached.HandleFunc("/api/v1/playlists/{playlistID}/clusters", handlers.ClustersHandler).Methods(http.MethodGet)
 
 	// start HTTP server
 	logger.Info("starting HTTP server", zap.Int("port", conf.Port))
@@ -41,11 +101,26 @@ func main() {
 	logger.Info("HTTP server shut down", zap.Error(err))
 }
 
-func allowCORSMiddleware(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		h.ServeHTTP(w, r)
-	})
+// newCORSMiddleware allows cross-origin requests from any origin. Requests from the UI origin may also include
+// credentials, i.e. the session cookie.
+func newCORSMiddleware(uiURL string) func(h http.Handler) http.Handler {
+	uiOrigin := ""
+	if u, err := url.Parse(uiURL); err == nil {
+		uiOrigin = u.Scheme + "://" + u.Host
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if origin := r.Header.Get("Origin"); origin != "" && origin == uiOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				w.Header().Add("Vary", "Origin")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
 }
 
 func newCacheMiddleware() (func(h http.Handler) http.Handler, error) {
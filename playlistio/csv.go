@@ -0,0 +1,246 @@
+package playlistio
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// csvColumns maps the column names of each field to read from a CSV file. Names are case-insensitive, and include
+// those used by older versions of Exportify.
+var csvColumns = map[string][]string{
+	"uri":              {"track uri", "spotify id", "uri"},
+	"name":             {"track name", "name", "title"},
+	"artists":          {"artist name(s)", "artist name", "artist names", "artist"},
+	"release_date":     {"album release date", "release date"},
+	"duration":         {"track duration (ms)", "duration (ms)", "duration_ms"},
+	"explicit":         {"explicit"},
+	"popularity":       {"popularity"},
+	"added_at":         {"added at", "added_at"},
+	"danceability":     {"danceability"},
+	"energy":           {"energy"},
+	"key":              {"key"},
+	"loudness":         {"loudness"},
+	"mode":             {"mode"},
+	"speechiness":      {"speechiness"},
+	"acousticness":     {"acousticness"},
+	"instrumentalness": {"instrumentalness"},
+	"liveness":         {"liveness"},
+	"valence":          {"valence"},
+	"tempo":            {"tempo"},
+	"time_signature":   {"time signature", "time_signature"},
+}
+
+// ReadCSV reads a CSV playlist with a header row, such as those exported by Exportify. Only the track name column is
+// required. Audio features are read for tracks with a Spotify ID and audio feature columns.
+func ReadCSV(r io.Reader) (Import, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return Import{}, fmt.Errorf("%w: failed to read CSV header: %s", ErrUnrecognisedFormat, err)
+	}
+	row := newCSVRow(header)
+	if _, ok := row.columns["name"]; !ok {
+		return Import{}, fmt.Errorf("%w: CSV has no track name column", ErrUnrecognisedFormat)
+	}
+
+	var imported Import
+	items := make([]spotify.TrackItem, 0)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Import{}, fmt.Errorf("failed to read CSV row: %w", err)
+		}
+		row.record = record
+
+		item, err := row.trackItem(len(items))
+		if err != nil {
+			return Import{}, fmt.Errorf("failed to parse CSV line %d: %w", line, err)
+		}
+		items = append(items, item)
+
+		feature, ok, err := row.audioFeatures()
+		if err != nil {
+			return Import{}, fmt.Errorf("failed to parse CSV line %d: %w", line, err)
+		}
+		if ok && item.Kind() == spotify.ItemTrack {
+			feature.ID = item.TrackDetails.ID
+			imported.AudioFeatures = append(imported.AudioFeatures, feature)
+		}
+	}
+
+	imported.Playlist = newPlaylist("", items)
+	return imported, nil
+}
+
+// csvRow provides access to the fields of a CSV record by field name.
+type csvRow struct {
+	columns map[string]int
+	record  []string
+}
+
+func newCSVRow(header []string) *csvRow {
+	indexes := make(map[string]int, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, string(utf8BOM))))
+		indexes[column] = i
+	}
+
+	row := &csvRow{columns: make(map[string]int, len(csvColumns))}
+	for field, names := range csvColumns {
+		for _, name := range names {
+			if i, ok := indexes[name]; ok {
+				row.columns[field] = i
+				break
+			}
+		}
+	}
+	return row
+}
+
+// get gets the value of the given field, or an empty string if the CSV doesn't have the field.
+func (c *csvRow) get(field string) string {
+	i, ok := c.columns[field]
+	if !ok || i >= len(c.record) {
+		return ""
+	}
+	return strings.TrimSpace(c.record[i])
+}
+
+func (c *csvRow) trackItem(position int) (spotify.TrackItem, error) {
+	uri := c.get("uri")
+	if strings.HasPrefix(uri, "spotify:local:") {
+		return spotify.TrackItem{
+			IsLocal:      true,
+			TrackDetails: &spotify.TrackDetails{Name: c.get("name"), IsLocal: true, Type: "track"},
+		}, nil
+	}
+
+	details := spotify.TrackDetails{
+		ID:      spotifyTrackID(uri),
+		Name:    c.get("name"),
+		Artists: splitArtists(strings.Split(c.get("artists"), ",")),
+		Album:   parseReleaseDate(c.get("release_date")),
+	}
+	if details.ID == "" && !strings.Contains(uri, ":") {
+		// older Exportify versions provide the bare track ID
+		details.ID = uri
+	}
+
+	var err error
+	if details.DurationMillis, err = c.int("duration"); err != nil {
+		return spotify.TrackItem{}, err
+	}
+	if details.Popularity, err = c.float("popularity"); err != nil {
+		return spotify.TrackItem{}, err
+	}
+	if explicit := c.get("explicit"); explicit != "" {
+		if details.Explicit, err = strconv.ParseBool(explicit); err != nil {
+			return spotify.TrackItem{}, fmt.Errorf("invalid explicit value: %w", err)
+		}
+	}
+
+	item := newTrackItem(position, details)
+	if addedAt := c.get("added_at"); addedAt != "" {
+		if item.AddedAt, err = time.Parse(time.RFC3339, addedAt); err != nil {
+			return spotify.TrackItem{}, fmt.Errorf("invalid added at value: %w", err)
+		}
+	}
+	return item, nil
+}
+
+// audioFeatures reads the row's audio features, reporting false if the row has none.
+func (c *csvRow) audioFeatures() (spotify.AudioFeatures, bool, error) {
+	if c.get("energy") == "" && c.get("valence") == "" && c.get("tempo") == "" {
+		return spotify.AudioFeatures{}, false, nil
+	}
+
+	// key and mode are -1 if unknown, as with Spotify's unknown key value
+	feature := spotify.AudioFeatures{Key: -1, Mode: -1}
+	floats := map[string]*float64{
+		"danceability":     &feature.Danceability,
+		"energy":           &feature.Energy,
+		"loudness":         &feature.Loudness,
+		"speechiness":      &feature.Speechiness,
+		"acousticness":     &feature.Acousticness,
+		"instrumentalness": &feature.Instrumentalness,
+		"liveness":         &feature.Liveness,
+		"valence":          &feature.Valence,
+		"tempo":            &feature.Tempo,
+	}
+	for field, value := range floats {
+		var err error
+		if *value, err = c.float(field); err != nil {
+			return feature, false, err
+		}
+	}
+
+	var err error
+	if c.get("key") != "" {
+		if feature.Key, err = c.int("key"); err != nil {
+			return feature, false, err
+		}
+	}
+	if c.get("mode") != "" {
+		if feature.Mode, err = c.int("mode"); err != nil {
+			return feature, false, err
+		}
+	}
+	if feature.TimeSignature, err = c.int("time_signature"); err != nil {
+		return feature, false, err
+	}
+	if feature.DurationMillis, err = c.int("duration"); err != nil {
+		return feature, false, err
+	}
+	return feature, true, nil
+}
+
+func (c *csvRow) float(field string) (float64, error) {
+	value := c.get(field)
+	if value == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value: %w", field, err)
+	}
+	return f, nil
+}
+
+// int reads a whole number, which may be written with a fractional part of zero, e.g. "4.0". Other fractional values
+// are rejected rather than truncated.
+func (c *csvRow) int(field string) (int, error) {
+	f, err := c.float(field)
+	if err != nil {
+		return 0, err
+	}
+	if f != math.Trunc(f) {
+		return 0, fmt.Errorf("invalid %s value: %s is not a whole number", field, c.get(field))
+	}
+	return int(f), nil
+}
+
+// parseReleaseDate determines the precision of a release date, e.g. "2006", "2006-01" or "2006-01-02".
+func parseReleaseDate(date string) spotify.Album {
+	album := spotify.Album{ReleaseDate: date}
+	switch len(date) {
+	case len("2006"):
+		album.ReleaseDatePrecision = "year"
+	case len("2006-01"):
+		album.ReleaseDatePrecision = "month"
+	case len("2006-01-02"):
+		album.ReleaseDatePrecision = "day"
+	}
+	return album
+}
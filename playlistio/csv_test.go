@@ -0,0 +1,56 @@
+package playlistio
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadCSVUnknownKeyAndMode(t *testing.T) {
+	const data = `Track URI,Track Name,Energy,Valence,Tempo,Key,Mode
+spotify:track:both,Both,0.5,0.5,120,9,0
+spotify:track:nomode,No Mode,0.5,0.5,120,9,
+spotify:track:neither,Neither,0.5,0.5,120,,
+`
+	imported, err := ReadCSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string][2]int{
+		"both":    {9, 0},
+		"nomode":  {9, -1},
+		"neither": {-1, -1},
+	}
+	if len(imported.AudioFeatures) != len(want) {
+		t.Fatalf("got %d audio features, want %d", len(imported.AudioFeatures), len(want))
+	}
+	for _, feature := range imported.AudioFeatures {
+		if got := [2]int{feature.Key, feature.Mode}; got != want[feature.ID] {
+			t.Errorf("%s: got key and mode %v, want %v", feature.ID, got, want[feature.ID])
+		}
+	}
+}
+
+func TestReadCSVRejectsNonIntegerValues(t *testing.T) {
+	tests := []struct {
+		name, column, value string
+		wantErr             bool
+	}{
+		{name: "integer key", column: "Key", value: "4"},
+		{name: "whole float key", column: "Key", value: "4.0"},
+		{name: "fractional key", column: "Key", value: "4.7", wantErr: true},
+		{name: "fractional mode", column: "Mode", value: "0.5", wantErr: true},
+		{name: "fractional time signature", column: "Time Signature", value: "3.5", wantErr: true},
+		{name: "fractional duration", column: "Track Duration (ms)", value: "180000.5", wantErr: true},
+		{name: "non-numeric key", column: "Key", value: "A", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := "Track URI,Track Name,Energy," + test.column + "\nspotify:track:a,A,0.5," + test.value + "\n"
+			_, err := ReadCSV(strings.NewReader(data))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("got error %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
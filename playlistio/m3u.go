@@ -0,0 +1,82 @@
+package playlistio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// ReadM3U reads an M3U playlist. Track names, artists and durations are read from extended M3U #EXTINF directives,
+// falling back to the file name of each entry. Entries which are Spotify track URIs or URLs are matched to the Spotify
+// track.
+func ReadM3U(r io.Reader) (Import, error) {
+	var (
+		name    string
+		items   []spotify.TrackItem
+		pending *spotify.TrackDetails
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), string(utf8BOM)))
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#EXTINF:"):
+			details, err := parseExtInf(strings.TrimPrefix(line, "#EXTINF:"))
+			if err != nil {
+				return Import{}, err
+			}
+			pending = &details
+		case strings.HasPrefix(line, "#"):
+			// ignore comments and unsupported directives
+		default:
+			details := spotify.TrackDetails{}
+			if pending != nil {
+				details = *pending
+			} else {
+				details.Artists, details.Name = splitArtistTitle(strings.TrimSuffix(path.Base(line), path.Ext(line)))
+			}
+			details.ID = spotifyTrackID(line)
+			items = append(items, newTrackItem(len(items), details))
+			pending = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Import{}, fmt.Errorf("failed to read M3U playlist: %w", err)
+	}
+	return Import{Playlist: newPlaylist(name, items)}, nil
+}
+
+// parseExtInf parses the value of an #EXTINF directive, which is of the form "<seconds>,<artist> - <title>". Any
+// attributes between the duration and the comma are ignored.
+func parseExtInf(value string) (spotify.TrackDetails, error) {
+	info, title, _ := strings.Cut(value, ",")
+	seconds, _, _ := strings.Cut(info, " ")
+
+	details := spotify.TrackDetails{}
+	duration, err := strconv.ParseFloat(seconds, 64)
+	if err != nil {
+		return details, fmt.Errorf("%w: invalid #EXTINF duration %q", ErrUnrecognisedFormat, seconds)
+	}
+	// -1 indicates an unknown duration
+	if duration > 0 {
+		details.DurationMillis = int(duration * 1000)
+	}
+	details.Artists, details.Name = splitArtistTitle(title)
+	return details, nil
+}
+
+// splitArtistTitle splits a display title of the form "Artist - Title". Titles with no artist are returned as is.
+func splitArtistTitle(s string) ([]spotify.Artist, string) {
+	artist, title, ok := strings.Cut(strings.TrimSpace(s), " - ")
+	if !ok {
+		return nil, strings.TrimSpace(s)
+	}
+	return splitArtists(strings.Split(artist, ",")), strings.TrimSpace(title)
+}
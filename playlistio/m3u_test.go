@@ -0,0 +1,104 @@
+package playlistio
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// trackSummary is the imported metadata of a track.
+type trackSummary struct {
+	ID             string
+	Name           string
+	Artists        []string
+	DurationMillis int
+}
+
+// summariseTracks summarises the tracks of an imported playlist.
+func summariseTracks(imported Import) []trackSummary {
+	tracks := make([]trackSummary, 0, len(imported.Playlist.Tracks.TrackItems))
+	for _, item := range imported.Playlist.Tracks.TrackItems {
+		details := item.TrackDetails
+		artists := make([]string, 0, len(details.Artists))
+		for _, artist := range details.Artists {
+			artists = append(artists, artist.Name)
+		}
+		tracks = append(tracks, trackSummary{
+			ID:             details.ID,
+			Name:           details.Name,
+			Artists:        artists,
+			DurationMillis: details.DurationMillis,
+		})
+	}
+	return tracks
+}
+
+func TestReadM3U(t *testing.T) {
+	const data = "\xef\xbb\xbf#EXTM3U\n" +
+		"#PLAYLIST:Road Trip\n" +
+		"#EXTINF:215,Artist A, Artist B - First Song\n" +
+		"spotify:track:4uLU6hMCjMI75M1A2tKUQC\n" +
+		"\n" +
+		"# a comment\n" +
+		`#EXTINF:-1 tvg-id="x",Second Song` + "\n" +
+		"https://open.spotify.com/track/7GhIk7Il098yCjg4BQjzvb?si=abc\n" +
+		"/music/Artist C - Third Song.mp3\n" +
+		"#EXTINF:183.5,Artist D - Fourth Song\n" +
+		"C:\\Music\\fourth.flac\n"
+
+	imported, err := ReadM3U(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if imported.Playlist.Name != "Road Trip" {
+		t.Errorf("got playlist name %q, want Road Trip", imported.Playlist.Name)
+	}
+	want := []trackSummary{
+		{ID: "4uLU6hMCjMI75M1A2tKUQC", Name: "First Song", Artists: []string{"Artist A", "Artist B"},
+			DurationMillis: 215000},
+		// unknown durations and attributes are ignored
+		{ID: "7GhIk7Il098yCjg4BQjzvb", Name: "Second Song", Artists: []string{}},
+		// entries without #EXTINF fall back to their file name, and get a placeholder ID from their position
+		{ID: "offline:3", Name: "Third Song", Artists: []string{"Artist C"}},
+		{ID: "offline:4", Name: "Fourth Song", Artists: []string{"Artist D"}, DurationMillis: 183500},
+	}
+	if got := summariseTracks(imported); !reflect.DeepEqual(got, want) {
+		t.Errorf("got tracks %+v, want %+v", got, want)
+	}
+	for _, item := range imported.Playlist.Tracks.TrackItems {
+		if item.Kind() != spotify.ItemTrack {
+			t.Errorf("got %s item %q, want every entry to be analysable as a track", item.Kind(),
+				item.TrackDetails.Name)
+		}
+	}
+}
+
+func TestReadM3UInvalidDuration(t *testing.T) {
+	_, err := ReadM3U(strings.NewReader("#EXTM3U\n#EXTINF:abc,Song\nsong.mp3\n"))
+	if !errors.Is(err, ErrUnrecognisedFormat) {
+		t.Errorf("got error %v, want ErrUnrecognisedFormat", err)
+	}
+}
+
+func TestSpotifyTrackID(t *testing.T) {
+	tests := []struct {
+		location, want string
+	}{
+		{location: "spotify:track:4uLU6hMCjMI75M1A2tKUQC", want: "4uLU6hMCjMI75M1A2tKUQC"},
+		{location: " spotify:track:4uLU6hMCjMI75M1A2tKUQC ", want: "4uLU6hMCjMI75M1A2tKUQC"},
+		{location: "https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC", want: "4uLU6hMCjMI75M1A2tKUQC"},
+		{location: "https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC/", want: "4uLU6hMCjMI75M1A2tKUQC"},
+		{location: "https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC?si=abc", want: "4uLU6hMCjMI75M1A2tKUQC"},
+		{location: "spotify:album:4uLU6hMCjMI75M1A2tKUQC"},
+		{location: "https://open.spotify.com/album/4uLU6hMCjMI75M1A2tKUQC"},
+		{location: "/music/song.mp3"},
+	}
+	for _, test := range tests {
+		if got := spotifyTrackID(test.location); got != test.want {
+			t.Errorf("got ID %q for %q, want %q", got, test.location, test.want)
+		}
+	}
+}
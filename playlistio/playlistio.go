@@ -0,0 +1,182 @@
+// Package playlistio imports playlists exported from other tools, so that they can be analysed offline without the
+// Spotify API. CSV files exported by Exportify (including its audio feature columns), M3U and XSPF playlists are
+// supported.
+package playlistio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// Format is a playlist file format.
+type Format string
+
+const (
+	// FormatCSV is a CSV file with a header row, as exported by Exportify.
+	FormatCSV Format = "csv"
+	// FormatM3U is an M3U or extended M3U playlist.
+	FormatM3U Format = "m3u"
+	// FormatXSPF is an XML Shareable Playlist Format playlist.
+	FormatXSPF Format = "xspf"
+)
+
+// ErrUnrecognisedFormat indicates that a file is not in a supported playlist format.
+var ErrUnrecognisedFormat = errors.New("unrecognised playlist format")
+
+// Import is an imported playlist and the audio features of its tracks, in the same shapes as returned by the Spotify
+// API. Audio features are only available for formats which include them, i.e. Exportify CSV files.
+type Import struct {
+	Playlist      spotify.Playlist
+	AudioFeatures []spotify.AudioFeatures
+}
+
+// GetAudioFeatures gets the imported audio features of the given tracks. Tracks which have no imported audio features
+// are omitted. This allows an Import to be used in place of the Spotify API as an audio features source.
+func (i Import) GetAudioFeatures(_ context.Context, trackIDs []string) ([]spotify.AudioFeatures, error) {
+	wanted := make(map[string]struct{}, len(trackIDs))
+	for _, id := range trackIDs {
+		wanted[id] = struct{}{}
+	}
+	features := make([]spotify.AudioFeatures, 0, len(trackIDs))
+	for _, feature := range i.AudioFeatures {
+		if _, ok := wanted[feature.ID]; ok {
+			features = append(features, feature)
+		}
+	}
+	return features, nil
+}
+
+// ParseFormat parses a Format from a file extension or media type, e.g. ".csv" or "application/xspf+xml".
+func ParseFormat(s string) (Format, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if mediaType, _, ok := strings.Cut(s, ";"); ok {
+		s = strings.TrimSpace(mediaType)
+	}
+	switch strings.TrimPrefix(s, ".") {
+	case "csv", "text/csv":
+		return FormatCSV, nil
+	case "m3u", "m3u8", "audio/x-mpegurl", "audio/mpegurl", "application/vnd.apple.mpegurl":
+		return FormatM3U, nil
+	case "xspf", "application/xspf+xml":
+		return FormatXSPF, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnrecognisedFormat, s)
+}
+
+// DetectFormat determines the format of a playlist file from its name, falling back to sniffing its contents if the
+// name has no recognised extension.
+func DetectFormat(name string, data []byte) (Format, error) {
+	if format, err := ParseFormat(path.Ext(name)); err == nil {
+		return format, nil
+	}
+
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, utf8BOM))
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("#EXTM3U")):
+		return FormatM3U, nil
+	case bytes.HasPrefix(trimmed, []byte("<?xml")), bytes.HasPrefix(trimmed, []byte("<playlist")):
+		return FormatXSPF, nil
+	case bytes.ContainsRune(firstLine(trimmed), ','):
+		return FormatCSV, nil
+	}
+	return "", ErrUnrecognisedFormat
+}
+
+// Read parses a playlist file in the given format. The file name is used as the playlist name for formats which
+// don't include one.
+func Read(name string, data []byte, format Format) (Import, error) {
+	var (
+		imported Import
+		err      error
+	)
+	switch format {
+	case FormatCSV:
+		imported, err = ReadCSV(bytes.NewReader(data))
+	case FormatM3U:
+		imported, err = ReadM3U(bytes.NewReader(data))
+	case FormatXSPF:
+		imported, err = ReadXSPF(bytes.NewReader(data))
+	default:
+		return Import{}, fmt.Errorf("%w: %s", ErrUnrecognisedFormat, format)
+	}
+	if err != nil {
+		return Import{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	if imported.Playlist.Name == "" {
+		imported.Playlist.Name = strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+	return imported, nil
+}
+
+// ReadFile detects the format of a playlist file and parses it.
+func ReadFile(name string, data []byte) (Import, error) {
+	format, err := DetectFormat(name, data)
+	if err != nil {
+		return Import{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return Read(name, data, format)
+}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+func firstLine(data []byte) []byte {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return data[:i]
+	}
+	return data
+}
+
+// newPlaylist creates a complete playlist, i.e. with no further pages, from the given items.
+func newPlaylist(name string, items []spotify.TrackItem) spotify.Playlist {
+	return spotify.Playlist{
+		Name: name,
+		Tracks: spotify.Tracks{
+			TrackItems: items,
+			Total:      len(items),
+			Limit:      len(items),
+		},
+	}
+}
+
+// newTrackItem creates a track item from the metadata available in a playlist file. Tracks which can't be matched to
+// a Spotify track are given a placeholder ID derived from their position in the playlist, so that their metadata can
+// still be analysed.
+func newTrackItem(position int, details spotify.TrackDetails) spotify.TrackItem {
+	if details.ID == "" {
+		details.ID = fmt.Sprintf("offline:%d", position+1)
+	}
+	details.Type = "track"
+	return spotify.TrackItem{TrackDetails: &details}
+}
+
+// spotifyTrackID extracts the track ID from a Spotify track URI or URL, e.g. "spotify:track:<id>" or
+// "https://open.spotify.com/track/<id>". An empty string is returned for anything else.
+func spotifyTrackID(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "spotify:track:") {
+		return strings.TrimPrefix(s, "spotify:track:")
+	}
+	if _, rest, ok := strings.Cut(s, "open.spotify.com/track/"); ok {
+		id, _, _ := strings.Cut(rest, "?")
+		return strings.TrimSuffix(id, "/")
+	}
+	return ""
+}
+
+// splitArtists converts a list of artist names into artists.
+func splitArtists(names []string) []spotify.Artist {
+	artists := make([]spotify.Artist, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			artists = append(artists, spotify.Artist{Name: name})
+		}
+	}
+	return artists
+}
@@ -0,0 +1,42 @@
+package playlistio
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name, fileName, data string
+		want                 Format
+		wantErr              bool
+	}{
+		{name: "CSV extension", fileName: "playlist.CSV", data: "anything", want: FormatCSV},
+		{name: "M3U8 extension", fileName: "playlist.m3u8", want: FormatM3U},
+		{name: "XSPF extension", fileName: "playlist.xspf", want: FormatXSPF},
+		// the extension takes precedence over the contents
+		{name: "extension over contents", fileName: "playlist.csv", data: "#EXTM3U\n", want: FormatCSV},
+		{name: "sniffed M3U", fileName: "playlist", data: "\xef\xbb\xbf\n #EXTM3U\nsong.mp3\n", want: FormatM3U},
+		{name: "sniffed XML declaration", fileName: "upload", data: `<?xml version="1.0"?><playlist/>`,
+			want: FormatXSPF},
+		{name: "sniffed XSPF", fileName: "upload.txt", data: "  <playlist version=\"1\"/>", want: FormatXSPF},
+		{name: "sniffed CSV", fileName: "upload", data: "Track Name,Artist Name(s)\nSong,Artist\n", want: FormatCSV},
+		// the comma is only on the second line, so this isn't a CSV header
+		{name: "unrecognised", fileName: "upload", data: "song.mp3\nother, song.mp3\n", wantErr: true},
+		{name: "empty", fileName: "upload", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DetectFormat(test.fileName, []byte(test.data))
+			if test.wantErr {
+				if !errors.Is(err, ErrUnrecognisedFormat) {
+					t.Errorf("got format %q and error %v, want ErrUnrecognisedFormat", got, err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("got format %q and error %v, want %q", got, err, test.want)
+			}
+		})
+	}
+}
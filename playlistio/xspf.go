@@ -0,0 +1,55 @@
+package playlistio
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// xspfPlaylist is the subset of an XSPF playlist which is imported.
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"playlist"`
+	Title   string      `xml:"title"`
+	Creator string      `xml:"creator"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Locations   []string `xml:"location"`
+	Identifiers []string `xml:"identifier"`
+	Title       string   `xml:"title"`
+	Creator     string   `xml:"creator"`
+	// Duration is in milliseconds.
+	Duration int `xml:"duration"`
+}
+
+// ReadXSPF reads an XSPF playlist. Tracks with a Spotify track URI or URL as their location or identifier are matched
+// to the Spotify track.
+func ReadXSPF(r io.Reader) (Import, error) {
+	var playlist xspfPlaylist
+	if err := xml.NewDecoder(r).Decode(&playlist); err != nil {
+		return Import{}, fmt.Errorf("%w: %s", ErrUnrecognisedFormat, err)
+	}
+
+	items := make([]spotify.TrackItem, 0, len(playlist.Tracks))
+	for _, track := range playlist.Tracks {
+		details := spotify.TrackDetails{
+			Name:           strings.TrimSpace(track.Title),
+			Artists:        splitArtists(strings.Split(track.Creator, ",")),
+			DurationMillis: track.Duration,
+		}
+		for _, uri := range append(track.Identifiers, track.Locations...) {
+			if details.ID = spotifyTrackID(uri); details.ID != "" {
+				break
+			}
+		}
+		items = append(items, newTrackItem(len(items), details))
+	}
+
+	imported := Import{Playlist: newPlaylist(strings.TrimSpace(playlist.Title), items)}
+	imported.Playlist.Owner.DisplayName = strings.TrimSpace(playlist.Creator)
+	return imported, nil
+}
@@ -0,0 +1,91 @@
+package playlistio
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadXSPF(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		wantName  string
+		wantOwner string
+		want      []trackSummary
+	}{
+		{
+			name: "with title",
+			data: `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <title> Road Trip </title>
+  <creator>Someone</creator>
+  <trackList>
+    <track>
+      <location>file:///music/first.mp3</location>
+      <identifier>spotify:track:4uLU6hMCjMI75M1A2tKUQC</identifier>
+      <title>First Song</title>
+      <creator>Artist A, Artist B</creator>
+      <duration>215000</duration>
+    </track>
+    <track>
+      <location>https://open.spotify.com/track/7GhIk7Il098yCjg4BQjzvb</location>
+      <title>Second Song</title>
+    </track>
+    <track>
+      <location>file:///music/third.mp3</location>
+      <title>Third Song</title>
+      <creator>Artist C</creator>
+    </track>
+  </trackList>
+</playlist>`,
+			wantName:  "Road Trip",
+			wantOwner: "Someone",
+			want: []trackSummary{
+				{ID: "4uLU6hMCjMI75M1A2tKUQC", Name: "First Song", Artists: []string{"Artist A", "Artist B"},
+					DurationMillis: 215000},
+				{ID: "7GhIk7Il098yCjg4BQjzvb", Name: "Second Song", Artists: []string{}},
+				{ID: "offline:3", Name: "Third Song", Artists: []string{"Artist C"}},
+			},
+		},
+		{
+			name: "without title",
+			data: `<playlist version="1" xmlns="http://xspf.org/ns/0/"><trackList>` +
+				`<track><title>Only Song</title></track></trackList></playlist>`,
+			want: []trackSummary{{ID: "offline:1", Name: "Only Song", Artists: []string{}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			imported, err := ReadXSPF(strings.NewReader(test.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if imported.Playlist.Name != test.wantName || imported.Playlist.Owner.DisplayName != test.wantOwner {
+				t.Errorf("got playlist %q by %q, want %q by %q", imported.Playlist.Name,
+					imported.Playlist.Owner.DisplayName, test.wantName, test.wantOwner)
+			}
+			if got := summariseTracks(imported); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got tracks %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadXSPFWithoutTitleIsNamedAfterFile(t *testing.T) {
+	const data = `<playlist version="1" xmlns="http://xspf.org/ns/0/"><trackList/></playlist>`
+	imported, err := Read("/exports/Chill Mix.xspf", []byte(data), FormatXSPF)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if imported.Playlist.Name != "Chill Mix" {
+		t.Errorf("got playlist name %q, want the file name Chill Mix", imported.Playlist.Name)
+	}
+}
+
+func TestReadXSPFInvalid(t *testing.T) {
+	if _, err := ReadXSPF(strings.NewReader("not xml")); !errors.Is(err, ErrUnrecognisedFormat) {
+		t.Errorf("got error %v, want ErrUnrecognisedFormat", err)
+	}
+}
@@ -0,0 +1,149 @@
+// Package session provides server-side session storage and signed session cookies.
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify/auth"
+)
+
+// Store is a concurrency safe in-memory store of values keyed by random IDs. Entries expire after a fixed TTL.
+type Store[T any] struct {
+	ttl     time.Duration
+	onEvict func(T)
+
+	mu      sync.Mutex
+	entries map[string]entry[T]
+}
+
+type entry[T any] struct {
+	value  T
+	expiry time.Time
+}
+
+// NewStore initialises a Store. onEvict, if not nil, is called with each value once it is deleted or has expired.
+func NewStore[T any](ttl time.Duration, onEvict func(T)) *Store[T] {
+	return &Store[T]{
+		ttl:     ttl,
+		onEvict: onEvict,
+		entries: make(map[string]entry[T]),
+	}
+}
+
+// TTL returns how long entries are stored for.
+func (s *Store[T]) TTL() time.Duration {
+	return s.ttl
+}
+
+// Create stores the value under a new random ID, which is returned.
+func (s *Store[T]) Create(value T) (string, error) {
+	id, err := auth.NewRandomString()
+	if err != nil {
+		return "", err
+	}
+	s.Set(id, value)
+	return id, nil
+}
+
+// Set stores the value under the given ID, replacing any existing value.
+func (s *Store[T]) Set(id string, value T) {
+	now := time.Now()
+	var evicted []T
+
+	s.mu.Lock()
+	// prune expired entries
+	for k, e := range s.entries {
+		if now.After(e.expiry) {
+			evicted = append(evicted, e.value)
+			delete(s.entries, k)
+		}
+	}
+	if e, ok := s.entries[id]; ok {
+		evicted = append(evicted, e.value)
+	}
+	s.entries[id] = entry[T]{value: value, expiry: now.Add(s.ttl)}
+	s.mu.Unlock()
+
+	s.evict(evicted...)
+}
+
+// Get gets the value stored under the given ID, if it exists and has not expired.
+func (s *Store[T]) Get(id string) (T, bool) {
+	s.mu.Lock()
+	e, ok := s.entries[id]
+	expired := ok && time.Now().After(e.expiry)
+	if expired {
+		delete(s.entries, id)
+	}
+	s.mu.Unlock()
+
+	if expired {
+		s.evict(e.value)
+	}
+	if !ok || expired {
+		var zero T
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Delete deletes the value stored under the given ID and returns it, if it exists.
+func (s *Store[T]) Delete(id string) (T, bool) {
+	s.mu.Lock()
+	e, ok := s.entries[id]
+	delete(s.entries, id)
+	s.mu.Unlock()
+
+	if ok {
+		s.evict(e.value)
+	}
+	return e.value, ok
+}
+
+func (s *Store[T]) evict(values ...T) {
+	if s.onEvict == nil {
+		return
+	}
+	for _, v := range values {
+		s.onEvict(v)
+	}
+}
+
+// Signer signs and verifies values, e.g. session IDs stored in cookies, using HMAC-SHA256.
+type Signer struct {
+	key []byte
+}
+
+// NewSigner initialises a Signer with the given secret key.
+func NewSigner(key []byte) Signer {
+	return Signer{key: key}
+}
+
+// Sign returns the value with its signature appended.
+func (s Signer) Sign(value string) string {
+	return value + "." + s.signature(value)
+}
+
+// Verify checks the signature of a signed value and returns the original value if it is valid.
+func (s Signer) Verify(signed string) (string, bool) {
+	i := strings.LastIndex(signed, ".")
+	if i < 0 {
+		return "", false
+	}
+	value, signature := signed[:i], signed[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(s.signature(value))) {
+		return "", false
+	}
+	return value, true
+}
+
+func (s Signer) signature(value string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,134 @@
+package source
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jemgunay/spotify-unwrapped/api"
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// pruneThreshold is the number of entries a cache map may grow to before expired entries are pruned.
+const pruneThreshold = 1000
+
+// Cache is a PlaylistSource decorator which caches playlists and audio features in memory for a fixed TTL. Audio
+// features are cached per track, so tracks shared between playlists are only fetched once.
+type Cache struct {
+	source api.PlaylistSource
+	ttl    time.Duration
+
+	mu            sync.Mutex
+	playlists     map[string]cachedPlaylist
+	audioFeatures map[string]cachedAudioFeatures
+}
+
+var _ api.PlaylistSource = (*Cache)(nil)
+
+type cachedPlaylist struct {
+	playlist spotify.Playlist
+	expiry   time.Time
+}
+
+type cachedAudioFeatures struct {
+	features spotify.AudioFeatures
+	expiry   time.Time
+}
+
+// NewCache returns a Cache which wraps the given source.
+func NewCache(source api.PlaylistSource, ttl time.Duration) *Cache {
+	return &Cache{
+		source:        source,
+		ttl:           ttl,
+		playlists:     make(map[string]cachedPlaylist),
+		audioFeatures: make(map[string]cachedAudioFeatures),
+	}
+}
+
+// GetPlaylist gets the playlist for the given ID from the cache, or from the underlying source if it is not cached or
+// has expired.
+func (c *Cache) GetPlaylist(ctx context.Context, id string) (spotify.Playlist, error) {
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.playlists[id]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiry) {
+		return copyPlaylist(entry.playlist), nil
+	}
+
+	playlist, err := c.source.GetPlaylist(ctx, id)
+	if err != nil {
+		return playlist, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.playlists) >= pruneThreshold {
+		for k, v := range c.playlists {
+			if now.After(v.expiry) {
+				delete(c.playlists, k)
+			}
+		}
+	}
+	c.playlists[id] = cachedPlaylist{
+		playlist: copyPlaylist(playlist),
+		expiry:   now.Add(c.ttl),
+	}
+	return playlist, nil
+}
+
+// StreamPlaylist streams the playlist from the underlying source. Streamed playlists are not cached.
+func (c *Cache) StreamPlaylist(ctx context.Context, id string, fn func(spotify.Tracks) error) (
+	spotify.Playlist, error) {
+	return c.source.StreamPlaylist(ctx, id, fn)
+}
+
+// GetAudioFeatures gets the audio features for the given track IDs. Only the tracks which are not cached are
+// requested from the underlying source. If the source returns partial results alongside an error, the partial results
+// are cached and returned with the error.
+func (c *Cache) GetAudioFeatures(ctx context.Context, trackIDs []string) ([]spotify.AudioFeatures, error) {
+	now := time.Now()
+	features := make([]spotify.AudioFeatures, 0, len(trackIDs))
+	missingIDs := make([]string, 0, len(trackIDs))
+
+	c.mu.Lock()
+	for _, id := range trackIDs {
+		entry, ok := c.audioFeatures[id]
+		if ok && now.Before(entry.expiry) {
+			features = append(features, entry.features)
+			continue
+		}
+		missingIDs = append(missingIDs, id)
+	}
+	c.mu.Unlock()
+
+	if len(missingIDs) == 0 {
+		return features, nil
+	}
+
+	fetched, err := c.source.GetAudioFeatures(ctx, missingIDs)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.audioFeatures) >= pruneThreshold {
+		for k, v := range c.audioFeatures {
+			if now.After(v.expiry) {
+				delete(c.audioFeatures, k)
+			}
+		}
+	}
+	for _, feature := range fetched {
+		c.audioFeatures[feature.ID] = cachedAudioFeatures{
+			features: feature,
+			expiry:   now.Add(c.ttl),
+		}
+	}
+
+	return append(features, fetched...), err
+}
+
+// copyPlaylist copies the playlist's tracks so that cached playlists are not modified by callers.
+func copyPlaylist(playlist spotify.Playlist) spotify.Playlist {
+	playlist.Tracks.TrackItems = append([]spotify.TrackItem(nil), playlist.Tracks.TrackItems...)
+	return playlist
+}
@@ -0,0 +1,183 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jemgunay/spotify-unwrapped/api"
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// countingSource is a PlaylistSource which records the requests made to it.
+type countingSource struct {
+	api.PlaylistSource
+	playlistCalls  int
+	requestedIDs   [][]string
+	featuresErr    error
+	omitFeaturesOf string
+}
+
+func (s *countingSource) GetPlaylist(_ context.Context, id string) (spotify.Playlist, error) {
+	s.playlistCalls++
+	if id == "unknown" {
+		return spotify.Playlist{}, spotify.ErrNotFound
+	}
+	playlist := spotify.Playlist{ID: id}
+	playlist.Tracks.TrackItems = []spotify.TrackItem{{TrackDetails: &spotify.TrackDetails{ID: "t"}}}
+	return playlist, nil
+}
+
+func (s *countingSource) GetAudioFeatures(_ context.Context, trackIDs []string) ([]spotify.AudioFeatures, error) {
+	s.requestedIDs = append(s.requestedIDs, trackIDs)
+	features := make([]spotify.AudioFeatures, 0, len(trackIDs))
+	for _, id := range trackIDs {
+		if id != s.omitFeaturesOf {
+			features = append(features, spotify.AudioFeatures{ID: id})
+		}
+	}
+	return features, s.featuresErr
+}
+
+func featureIDs(features []spotify.AudioFeatures) []string {
+	ids := make([]string, 0, len(features))
+	for _, feature := range features {
+		ids = append(ids, feature.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestCacheGetPlaylist(t *testing.T) {
+	source := &countingSource{}
+	cache := NewCache(source, time.Minute)
+	ctx := context.Background()
+
+	// miss
+	playlist, err := cache.GetPlaylist(ctx, "p")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	playlist.Tracks.TrackItems[0] = spotify.TrackItem{}
+
+	// hit, unaffected by the caller modifying the first result
+	playlist, err = cache.GetPlaylist(ctx, "p")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if source.playlistCalls != 1 {
+		t.Errorf("got %d source calls, want 1", source.playlistCalls)
+	}
+	if playlist.ID != "p" || playlist.Tracks.TrackItems[0].TrackDetails.ID != "t" {
+		t.Errorf("got cached playlist %+v, want the original playlist", playlist)
+	}
+
+	// a different playlist is a miss
+	if _, err := cache.GetPlaylist(ctx, "q"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if source.playlistCalls != 2 {
+		t.Errorf("got %d source calls, want 2", source.playlistCalls)
+	}
+}
+
+func TestCacheGetPlaylistErrorsAreNotCached(t *testing.T) {
+	source := &countingSource{}
+	cache := NewCache(source, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.GetPlaylist(context.Background(), "unknown"); !errors.Is(err, spotify.ErrNotFound) {
+			t.Errorf("got error %v, want ErrNotFound", err)
+		}
+	}
+	if source.playlistCalls != 2 {
+		t.Errorf("got %d source calls, want 2", source.playlistCalls)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	source := &countingSource{}
+	cache := NewCache(source, time.Millisecond*20)
+	ctx := context.Background()
+
+	if _, err := cache.GetPlaylist(ctx, "p"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := cache.GetAudioFeatures(ctx, []string{"a"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	if _, err := cache.GetPlaylist(ctx, "p"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := cache.GetAudioFeatures(ctx, []string{"a"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if source.playlistCalls != 2 {
+		t.Errorf("got %d playlist source calls, want 2 after expiry", source.playlistCalls)
+	}
+	if len(source.requestedIDs) != 2 {
+		t.Errorf("got %d audio features source calls, want 2 after expiry", len(source.requestedIDs))
+	}
+}
+
+func TestCacheGetAudioFeatures(t *testing.T) {
+	source := &countingSource{}
+	cache := NewCache(source, time.Minute)
+	ctx := context.Background()
+
+	features, err := cache.GetAudioFeatures(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := featureIDs(features); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("got features for %v, want a and b", got)
+	}
+
+	// only the uncached track is requested
+	features, err = cache.GetAudioFeatures(ctx, []string{"b", "c", "a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := featureIDs(features); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("got features for %v, want a, b and c", got)
+	}
+
+	// fully cached requests don't reach the source
+	if _, err := cache.GetAudioFeatures(ctx, []string{"c", "a"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := [][]string{{"a", "b"}, {"c"}}
+	if !reflect.DeepEqual(source.requestedIDs, want) {
+		t.Errorf("got source requests %v, want %v", source.requestedIDs, want)
+	}
+}
+
+func TestCacheGetAudioFeaturesPartialResults(t *testing.T) {
+	errPartial := errors.New("partial")
+	source := &countingSource{featuresErr: errPartial, omitFeaturesOf: "b"}
+	cache := NewCache(source, time.Minute)
+	ctx := context.Background()
+
+	features, err := cache.GetAudioFeatures(ctx, []string{"a", "b"})
+	if !errors.Is(err, errPartial) {
+		t.Fatalf("got error %v, want the source error", err)
+	}
+	if got := featureIDs(features); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("got features for %v, want the partial results", got)
+	}
+
+	// the partial results were cached, but the missing track is requested again
+	source.featuresErr = nil
+	if _, err := cache.GetAudioFeatures(ctx, []string{"a", "b"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := [][]string{{"a", "b"}, {"b"}}
+	if !reflect.DeepEqual(source.requestedIDs, want) {
+		t.Errorf("got source requests %v, want %v", source.requestedIDs, want)
+	}
+}
@@ -0,0 +1,147 @@
+// Package source provides api.PlaylistSource implementations other than the live Spotify API.
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jemgunay/spotify-unwrapped/api"
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// Fixture is a PlaylistSource which serves playlists and audio features from JSON fixture files, e.g. sample_data.
+// It requires no Spotify credentials or network access.
+type Fixture struct {
+	fixtures fixtureSet
+}
+
+var _ api.PlaylistSource = (*Fixture)(nil)
+
+// NewFixture reads the fixture files in the given directory and returns a Fixture serving them.
+func NewFixture(dir string) (*Fixture, error) {
+	fixtures, err := readFixtures(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Fixture{fixtures: fixtures}, nil
+}
+
+// GetPlaylist gets the fixture playlist for the given playlist ID.
+func (f *Fixture) GetPlaylist(_ context.Context, id string) (spotify.Playlist, error) {
+	playlist, ok := f.fixtures.playlists[id]
+	if !ok {
+		return spotify.Playlist{}, fmt.Errorf("fixture playlist %s: %w", id, spotify.ErrNotFound)
+	}
+	return copyPlaylist(playlist), nil
+}
+
+// fixturePageSize is the number of tracks passed to each StreamPlaylist callback.
+const fixturePageSize = 100
+
+// StreamPlaylist gets the fixture playlist for the given playlist ID, passing its tracks to fn in pages.
+func (f *Fixture) StreamPlaylist(ctx context.Context, id string, fn func(spotify.Tracks) error) (
+	spotify.Playlist, error) {
+	playlist, err := f.GetPlaylist(ctx, id)
+	if err != nil {
+		return playlist, err
+	}
+
+	items := playlist.Tracks.TrackItems
+	playlist.Tracks.TrackItems = nil
+	for offset := 0; offset < len(items); offset += fixturePageSize {
+		end := offset + fixturePageSize
+		if end > len(items) {
+			end = len(items)
+		}
+		page := spotify.Tracks{
+			TrackItems: items[offset:end],
+			Total:      len(items),
+			Limit:      fixturePageSize,
+			Offset:     offset,
+		}
+		if err := fn(page); err != nil {
+			return playlist, err
+		}
+	}
+	return playlist, nil
+}
+
+// GetAudioFeatures gets the fixture audio features for the given track IDs. Tracks without audio feature fixtures are
+// omitted.
+func (f *Fixture) GetAudioFeatures(_ context.Context, trackIDs []string) ([]spotify.AudioFeatures, error) {
+	features := make([]spotify.AudioFeatures, 0, len(trackIDs))
+	for _, id := range trackIDs {
+		if feature, ok := f.fixtures.audioFeatures[id]; ok {
+			features = append(features, feature)
+		}
+	}
+	return features, nil
+}
+
+// fixtureSet is a set of playlists and track audio features read from Spotify API JSON responses, such as those in
+// sample_data. Playlists are keyed by playlist ID and audio features by track ID.
+type fixtureSet struct {
+	playlists     map[string]spotify.Playlist
+	audioFeatures map[string]spotify.AudioFeatures
+}
+
+// fixtureProbe is used to determine which Spotify API response a fixture file contains.
+type fixtureProbe struct {
+	ID            string           `json:"id"`
+	Tracks        *json.RawMessage `json:"tracks"`
+	AudioFeatures *json.RawMessage `json:"audio_features"`
+}
+
+// readFixtures reads every JSON file in the given directory. Files containing a playlist response or an audio
+// features response are collected, and any other files are ignored. Each playlist is treated as complete, i.e. its
+// track total is set to the number of tracks in the file and it has no further pages.
+func readFixtures(dir string) (fixtureSet, error) {
+	fixtures := fixtureSet{
+		playlists:     make(map[string]spotify.Playlist),
+		audioFeatures: make(map[string]spotify.AudioFeatures),
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return fixtures, fmt.Errorf("failed to list fixture files: %w", err)
+	}
+
+	for _, path := range paths {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return fixtures, fmt.Errorf("failed to read fixture file %s: %w", path, err)
+		}
+
+		probe := fixtureProbe{}
+		if err := json.Unmarshal(body, &probe); err != nil {
+			return fixtures, fmt.Errorf("failed to JSON decode fixture file %s: %w", path, err)
+		}
+
+		switch {
+		case probe.AudioFeatures != nil:
+			result := spotify.AudioFeaturesResult{}
+			if err := json.Unmarshal(body, &result); err != nil {
+				return fixtures, fmt.Errorf("failed to JSON decode audio features fixture %s: %w", path, err)
+			}
+			for _, feature := range result.Features {
+				if feature != nil {
+					fixtures.audioFeatures[feature.ID] = *feature
+				}
+			}
+
+		case probe.Tracks != nil && probe.ID != "":
+			playlist := spotify.Playlist{}
+			if err := json.Unmarshal(body, &playlist); err != nil {
+				return fixtures, fmt.Errorf("failed to JSON decode playlist fixture %s: %w", path, err)
+			}
+			playlist.Tracks.Total = len(playlist.Tracks.TrackItems)
+			playlist.Tracks.NextURL = ""
+			fixtures.playlists[playlist.ID] = playlist
+		}
+	}
+
+	return fixtures, nil
+}
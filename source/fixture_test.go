@@ -0,0 +1,166 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+const (
+	samplePlaylistID = "2VLA8FqcO5Oto2mACkKBOt"
+	sampleTrackID    = "1ZD51kpXHiTNqymmz3Yy6b"
+)
+
+func newTestFixture(t *testing.T) *Fixture {
+	t.Helper()
+	fixture, err := NewFixture(filepath.Join("..", "sample_data"))
+	if err != nil {
+		t.Fatalf("failed to read fixtures: %s", err)
+	}
+	return fixture
+}
+
+func TestFixtureGetPlaylist(t *testing.T) {
+	fixture := newTestFixture(t)
+
+	playlist, err := fixture.GetPlaylist(context.Background(), samplePlaylistID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if playlist.ID != samplePlaylistID || len(playlist.Tracks.TrackItems) == 0 {
+		t.Fatalf("got playlist %q with %d tracks, want %q with tracks", playlist.ID,
+			len(playlist.Tracks.TrackItems), samplePlaylistID)
+	}
+	if playlist.Tracks.Total != len(playlist.Tracks.TrackItems) || playlist.Tracks.NextURL != "" {
+		t.Errorf("got total %d and next URL %q, want a complete playlist of %d tracks", playlist.Tracks.Total,
+			playlist.Tracks.NextURL, len(playlist.Tracks.TrackItems))
+	}
+
+	// modifying a returned playlist must not modify the fixture
+	playlist.Tracks.TrackItems[0] = spotify.TrackItem{}
+	again, err := fixture.GetPlaylist(context.Background(), samplePlaylistID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if again.Tracks.TrackItems[0].TrackDetails.ID == "" {
+		t.Error("modifying a returned playlist modified the fixture")
+	}
+}
+
+func TestFixtureUnknownPlaylist(t *testing.T) {
+	fixture := newTestFixture(t)
+
+	_, err := fixture.GetPlaylist(context.Background(), "unknown")
+	if !errors.Is(err, spotify.ErrNotFound) {
+		t.Errorf("got error %v from GetPlaylist, want ErrNotFound", err)
+	}
+
+	called := false
+	_, err = fixture.StreamPlaylist(context.Background(), "unknown", func(spotify.Tracks) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, spotify.ErrNotFound) {
+		t.Errorf("got error %v from StreamPlaylist, want ErrNotFound", err)
+	}
+	if called {
+		t.Error("StreamPlaylist called fn for an unknown playlist")
+	}
+}
+
+func TestFixtureStreamPlaylist(t *testing.T) {
+	fixture := newTestFixture(t)
+	want, err := fixture.GetPlaylist(context.Background(), samplePlaylistID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	streamed := 0
+	playlist, err := fixture.StreamPlaylist(context.Background(), samplePlaylistID, func(page spotify.Tracks) error {
+		if page.Offset != streamed || page.Total != len(want.Tracks.TrackItems) {
+			t.Errorf("got page at offset %d of %d, want offset %d of %d", page.Offset, page.Total, streamed,
+				len(want.Tracks.TrackItems))
+		}
+		if len(page.TrackItems) > fixturePageSize {
+			t.Errorf("got page of %d tracks, want at most %d", len(page.TrackItems), fixturePageSize)
+		}
+		streamed += len(page.TrackItems)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if streamed != len(want.Tracks.TrackItems) {
+		t.Errorf("got %d streamed tracks, want %d", streamed, len(want.Tracks.TrackItems))
+	}
+	if playlist.ID != samplePlaylistID || len(playlist.Tracks.TrackItems) != 0 {
+		t.Errorf("got playlist %q with %d tracks, want %q without its streamed tracks", playlist.ID,
+			len(playlist.Tracks.TrackItems), samplePlaylistID)
+	}
+
+	errStop := errors.New("stop")
+	_, err = fixture.StreamPlaylist(context.Background(), samplePlaylistID, func(spotify.Tracks) error {
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("got error %v, want the error returned by fn", err)
+	}
+}
+
+func TestFixtureGetAudioFeatures(t *testing.T) {
+	fixture := newTestFixture(t)
+
+	features, err := fixture.GetAudioFeatures(context.Background(), []string{sampleTrackID, "unknown"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(features) != 1 || features[0].ID != sampleTrackID {
+		t.Errorf("got %+v, want only the features of %s", features, sampleTrackID)
+	}
+}
+
+func TestReadFixturesIgnoresOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"playlist.json": `{"id": "p", "tracks": {"items": [{"track": {"id": "t"}}], "total": 50, ` +
+			`"next": "https://api.spotify.com/v1/playlists/p/tracks?offset=1"}}`,
+		"features.json": `{"audio_features": [{"id": "t", "energy": 0.5}, null]}`,
+		"other.json":    `{"name": "not a playlist"}`,
+		"notes.txt":     "not JSON",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatalf("failed to write fixture: %s", err)
+		}
+	}
+
+	fixtures, err := readFixtures(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(fixtures.playlists) != 1 || len(fixtures.audioFeatures) != 1 {
+		t.Fatalf("got %d playlists and %d audio features, want 1 of each", len(fixtures.playlists),
+			len(fixtures.audioFeatures))
+	}
+	tracks := fixtures.playlists["p"].Tracks
+	if tracks.Total != 1 || tracks.NextURL != "" {
+		t.Errorf("got total %d and next URL %q, want a complete playlist of 1 track", tracks.Total, tracks.NextURL)
+	}
+	if fixtures.audioFeatures["t"].Energy != 0.5 {
+		t.Errorf("got audio features %+v, want energy 0.5", fixtures.audioFeatures["t"])
+	}
+}
+
+func TestReadFixturesInvalidJSON(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o600); err != nil {
+		t.Fatalf("failed to write fixture: %s", err)
+	}
+	if _, err := readFixtures(dir); err == nil {
+		t.Error("got nil error, want a decode error")
+	}
+}
@@ -1,54 +1,201 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"time"
 )
 
-// Access is a concurrency safe wrapper around the Spotify access token.
+const (
+	// refreshTimeout bounds how long a single refresh may take.
+	refreshTimeout = time.Second * 30
+	// backgroundRetryInterval is how long to wait before retrying a failed background refresh.
+	backgroundRetryInterval = time.Second * 5
+)
+
+// ErrClosed indicates that the Access has been closed.
+var ErrClosed = errors.New("access closed")
+
+// Access is a concurrency safe wrapper around the Spotify access token. Concurrent refreshes are de-duplicated so that
+// only one is in flight at a time, and the token can optionally be renewed in the background before it expires.
 type Access struct {
-	token   string
-	refresh refreshFunc
-	expiry  time.Time
-	mu      *sync.RWMutex
+	source TokenSource
+	margin time.Duration
+
+	mu       sync.Mutex
+	token    string
+	expiry   time.Time
+	inflight *refreshCall
+	closed   bool
+
+	// refreshed is signalled after each successful refresh, so that the background refresh can be rescheduled
+	refreshed chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// refreshCall represents an in flight refresh which callers can wait on.
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+// Opt defines an Access option.
+type Opt func(*Access)
+
+// WithBackgroundRefresh renews the access token in the background the given margin before it expires, so that
+// callers of Get rarely have to wait for a refresh. A zero margin disables background refreshes.
+func WithBackgroundRefresh(margin time.Duration) Opt {
+	return func(a *Access) {
+		a.margin = margin
+	}
 }
 
-type refreshFunc func() (string, time.Time, error)
+// New initialises a new Access which fetches tokens from the given TokenSource. Close should be called to release its
+// resources once it is no longer needed.
+func New(source TokenSource, opts ...Opt) *Access {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &Access{
+		source:    source,
+		refreshed: make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
 
-// New initialises a new Access.
-func New(refreshFunc refreshFunc) *Access {
-	return &Access{
-		refresh: refreshFunc,
-		mu:      &sync.RWMutex{},
+	if a.margin > 0 {
+		a.wg.Add(1)
+		go a.backgroundRefresh()
 	}
+	return a
 }
 
 // Get retrieves the access token, or lazy-fetches a fresh one if it has expired.
-func (a *Access) Get() (string, error) {
-	a.mu.RLock()
+func (a *Access) Get(ctx context.Context) (string, error) {
+	a.mu.Lock()
 	currentExpiry := a.expiry
-	a.mu.RUnlock()
+	a.mu.Unlock()
 
 	now := time.Now().UTC()
 	var err error
 	if now.After(currentExpiry) {
-		err = a.Refresh()
+		err = a.Refresh(ctx)
 	}
 
-	a.mu.RLock()
-	defer a.mu.RUnlock()
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	return a.token, err
 }
 
-// Refresh refreshes the access token.
-func (a *Access) Refresh() error {
-	token, expiry, err := a.refresh()
-	if err != nil {
-		return err
+// Refresh refreshes the access token. If a refresh is already in flight, Refresh waits for its result rather than
+// starting another. The refresh itself is not cancelled if ctx is, as other callers may be waiting on it, but Refresh
+// returns early with the context's error.
+func (a *Access) Refresh(ctx context.Context) error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return ErrClosed
+	}
+	call := a.inflight
+	if call == nil {
+		call = &refreshCall{done: make(chan struct{})}
+		a.inflight = call
+		a.wg.Add(1)
+		go a.doRefresh(call)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-call.done:
+		return call.err
 	}
+}
+
+// doRefresh performs a refresh and publishes its result to the waiting callers.
+func (a *Access) doRefresh(call *refreshCall) {
+	defer a.wg.Done()
+
+	ctx, cancel := context.WithTimeout(a.ctx, refreshTimeout)
+	defer cancel()
+	token, err := a.source.Token(ctx)
+
 	a.mu.Lock()
-	defer a.mu.Unlock()
-	a.token = token
-	a.expiry = expiry
-	return nil
+	if err == nil {
+		a.token = token.AccessToken
+		a.expiry = token.Expiry
+	}
+	a.inflight = nil
+	a.mu.Unlock()
+
+	call.err = err
+	close(call.done)
+
+	if err == nil {
+		// reschedule the background refresh, unless a reschedule is already pending
+		select {
+		case a.refreshed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// backgroundRefresh renews the access token the configured margin before it expires, until Close is called. No
+// refresh is scheduled until the first token has been fetched.
+func (a *Access) backgroundRefresh() {
+	defer a.wg.Done()
+
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+
+		case <-a.refreshed:
+			a.mu.Lock()
+			lifetime := time.Until(a.expiry)
+			a.mu.Unlock()
+			// refresh the margin before expiry, but no sooner than halfway through the token's lifetime
+			wait := lifetime - a.margin
+			if wait < lifetime/2 {
+				wait = lifetime / 2
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+
+		case <-timer.C:
+			// success reschedules via the refreshed channel, so only failures need to be rescheduled here
+			if err := a.Refresh(a.ctx); err != nil && a.ctx.Err() == nil {
+				timer.Reset(backgroundRetryInterval)
+			}
+		}
+	}
+}
+
+// Close stops any background refreshes and waits for in flight refreshes to finish. Subsequent refreshes fail.
+func (a *Access) Close() {
+	a.closeOnce.Do(func() {
+		// prevent any new refreshes from starting before waiting on those in flight
+		a.mu.Lock()
+		a.closed = true
+		a.cancel()
+		a.mu.Unlock()
+		a.wg.Wait()
+	})
 }
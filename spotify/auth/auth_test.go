@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSource is a TokenSource which issues numbered tokens with the given lifetime. If release is set, each refresh
+// blocks until it is closed.
+type fakeSource struct {
+	lifetime time.Duration
+	release  chan struct{}
+	// started is signalled when a refresh starts, if set
+	started chan struct{}
+	calls   int32
+}
+
+func (s *fakeSource) Token(ctx context.Context) (Token, error) {
+	n := atomic.AddInt32(&s.calls, 1)
+	if s.started != nil {
+		s.started <- struct{}{}
+	}
+	if s.release != nil {
+		select {
+		case <-ctx.Done():
+			return Token{}, ctx.Err()
+		case <-s.release:
+		}
+	}
+	return Token{
+		AccessToken: "token-" + strconv.Itoa(int(n)),
+		Expiry:      time.Now().Add(s.lifetime),
+	}, nil
+}
+
+func (s *fakeSource) Calls() int {
+	return int(atomic.LoadInt32(&s.calls))
+}
+
+func TestAccessDeduplicatesConcurrentRefreshes(t *testing.T) {
+	source := &fakeSource{
+		lifetime: time.Hour,
+		release:  make(chan struct{}),
+		started:  make(chan struct{}, 1),
+	}
+	access := New(source)
+	defer access.Close()
+
+	const callers = 50
+	var (
+		wg     sync.WaitGroup
+		tokens = make([]string, callers)
+		errs   = make([]error, callers)
+	)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = access.Get(context.Background())
+		}(i)
+	}
+
+	// hold the refresh open while the callers pile up behind it
+	<-source.started
+	time.Sleep(time.Millisecond * 50)
+	close(source.release)
+	wg.Wait()
+
+	for i := range tokens {
+		if errs[i] != nil {
+			t.Fatalf("caller %d got unexpected error: %s", i, errs[i])
+		}
+		if tokens[i] != "token-1" {
+			t.Errorf("caller %d got token %q, want token-1", i, tokens[i])
+		}
+	}
+	if got := source.Calls(); got != 1 {
+		t.Errorf("got %d refreshes, want 1", got)
+	}
+}
+
+func TestAccessRefreshWaitersCanBeCancelled(t *testing.T) {
+	source := &fakeSource{lifetime: time.Hour, release: make(chan struct{})}
+	access := New(source)
+	defer access.Close()
+	defer close(source.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if err := access.Refresh(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestAccessRefreshesInBackgroundBeforeExpiry(t *testing.T) {
+	source := &fakeSource{lifetime: time.Millisecond * 400}
+	access := New(source, WithBackgroundRefresh(time.Millisecond*300))
+	defer access.Close()
+
+	token, err := access.Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token != "token-1" {
+		t.Fatalf("got token %q, want token-1", token)
+	}
+
+	// the token is renewed 300ms before it expires, but no sooner than halfway through its 400ms lifetime
+	deadline := time.Now().Add(time.Millisecond * 350)
+	for source.Calls() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("token wasn't refreshed in the background before it expired")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// the renewed token is served without waiting on a refresh
+	token, err = access.Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token == "token-1" {
+		t.Error("got the original token, want the token refreshed in the background")
+	}
+}
+
+func TestAccessWithoutBackgroundRefreshOnlyRefreshesOnDemand(t *testing.T) {
+	source := &fakeSource{lifetime: time.Millisecond * 50}
+	access := New(source)
+	defer access.Close()
+
+	if _, err := access.Get(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	time.Sleep(time.Millisecond * 100)
+	if got := source.Calls(); got != 1 {
+		t.Errorf("got %d refreshes before the token was next requested, want 1", got)
+	}
+
+	token, err := access.Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token != "token-2" {
+		t.Errorf("got token %q, want the expired token to be replaced by token-2", token)
+	}
+}
+
+func TestAccessClose(t *testing.T) {
+	source := &fakeSource{lifetime: time.Hour}
+	access := New(source, WithBackgroundRefresh(time.Minute))
+
+	if _, err := access.Get(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	access.Close()
+	// closing again is a no-op
+	access.Close()
+
+	if err := access.Refresh(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("got error %v from Refresh, want ErrClosed", err)
+	}
+	if got := source.Calls(); got != 1 {
+		t.Errorf("got %d refreshes, want 1", got)
+	}
+}
+
+func TestAccessCloseCancelsInflightRefresh(t *testing.T) {
+	source := &fakeSource{
+		lifetime: time.Hour,
+		release:  make(chan struct{}),
+		started:  make(chan struct{}, 1),
+	}
+	access := New(source)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := access.Get(context.Background())
+		errs <- err
+	}()
+	<-source.started
+
+	// Close waits for the in flight refresh, which is cancelled rather than released
+	access.Close()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v from the in flight refresh, want context.Canceled", err)
+	}
+	if _, err := access.Get(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("got error %v from Get after Close, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/config"
+)
+
+// FileCache is a TokenSource which persists the tokens from another TokenSource to a file, so that a still valid token
+// can be reused after a restart rather than re-authenticating. The file is only read for the first token; subsequent
+// tokens always come from the underlying source, as they are only requested once the previous token has expired or
+// been rejected.
+type FileCache struct {
+	path   string
+	source TokenSource
+	logger config.Logger
+
+	mu     sync.Mutex
+	loaded bool
+}
+
+var _ TokenSource = (*FileCache)(nil)
+
+// NewFileCache initialises a FileCache which persists tokens to the given path.
+func NewFileCache(logger config.Logger, path string, source TokenSource) *FileCache {
+	return &FileCache{
+		path:   path,
+		source: source,
+		logger: logger,
+	}
+}
+
+// Token returns the persisted token if this is the first call and it is still valid, otherwise it fetches a fresh
+// token from the underlying source and persists it. Failing to persist a token is logged rather than returned.
+func (f *FileCache) Token(ctx context.Context) (Token, error) {
+	f.mu.Lock()
+	firstCall := !f.loaded
+	f.loaded = true
+	f.mu.Unlock()
+
+	if firstCall {
+		token, err := f.load()
+		switch {
+		case err == nil && token.Valid():
+			f.logger.Info("loaded persisted Spotify access token", zap.Time("expiry", token.Expiry))
+			return token, nil
+		case err != nil && !errors.Is(err, fs.ErrNotExist):
+			f.logger.Warn("failed to load persisted Spotify access token", zap.Error(err))
+		}
+	}
+
+	token, err := f.source.Token(ctx)
+	if err != nil {
+		return token, err
+	}
+	if err := f.store(token); err != nil {
+		f.logger.Warn("failed to persist Spotify access token", zap.Error(err))
+	}
+	return token, nil
+}
+
+func (f *FileCache) load() (Token, error) {
+	body, err := os.ReadFile(f.path)
+	if err != nil {
+		return Token{}, err
+	}
+	token := Token{}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return Token{}, fmt.Errorf("failed to JSON decode token file: %w", err)
+	}
+	return token, nil
+}
+
+// store writes the token to a temporary file which only the current user can read, then moves it into place so that
+// a partially written file is never read.
+func (f *FileCache) store(token Token) error {
+	body, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to JSON encode token: %w", err)
+	}
+
+	dir := filepath.Dir(f.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create token file directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary token file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// CreateTemp creates files with 0600 permissions, but enforce it in case of an unusual umask
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set token file permissions: %w", err)
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close token file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to move token file into place: %w", err)
+	}
+	return nil
+}
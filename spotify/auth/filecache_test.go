@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// writeTokenFile persists the given token to the path, as a previous FileCache would have.
+func writeTokenFile(t *testing.T, path string, token Token) {
+	t.Helper()
+	body, err := json.Marshal(token)
+	if err != nil {
+		t.Fatalf("failed to encode token: %s", err)
+	}
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		t.Fatalf("failed to write token file: %s", err)
+	}
+}
+
+// readTokenFile reads the persisted token from the path.
+func readTokenFile(t *testing.T, path string) Token {
+	t.Helper()
+	body, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read token file: %s", err)
+	}
+	var token Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		t.Fatalf("failed to decode token file: %s", err)
+	}
+	return token
+}
+
+func TestFileCacheReusesValidToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	writeTokenFile(t, path, Token{AccessToken: "persisted", Expiry: time.Now().Add(time.Hour)})
+	source := &fakeSource{lifetime: time.Hour}
+	cache := NewFileCache(zap.NewNop(), path, source)
+
+	token, err := cache.Token(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.AccessToken != "persisted" || source.Calls() != 0 {
+		t.Errorf("got token %q after %d source calls, want the persisted token without calling the source",
+			token.AccessToken, source.Calls())
+	}
+
+	// the file is only read for the first token, as later tokens are only requested once it's expired or rejected
+	token, err = cache.Token(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.AccessToken != "token-1" || readTokenFile(t, path).AccessToken != "token-1" {
+		t.Errorf("got token %q, want a fresh token from the source which is persisted", token.AccessToken)
+	}
+}
+
+func TestFileCacheRefreshesExpiredToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	writeTokenFile(t, path, Token{AccessToken: "persisted", Expiry: time.Now().Add(-time.Minute)})
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat token file: %s", err)
+	}
+	source := &fakeSource{lifetime: time.Hour}
+
+	token, err := NewFileCache(zap.NewNop(), path, source).Token(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.AccessToken != "token-1" || source.Calls() != 1 {
+		t.Fatalf("got token %q after %d source calls, want a single fresh token", token.AccessToken,
+			source.Calls())
+	}
+	persisted := readTokenFile(t, path)
+	if persisted.AccessToken != "token-1" || !persisted.Expiry.Equal(token.Expiry) {
+		t.Errorf("got persisted token %+v, want the fresh token %+v", persisted, token)
+	}
+
+	// the token is written to a new file which is then renamed over the old one, rather than overwriting it in place
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat token file: %s", err)
+	}
+	if os.SameFile(before, after) {
+		t.Error("got the same token file, want it to be replaced by a rename")
+	}
+	if mode := after.Mode().Perm(); mode != 0o600 {
+		t.Errorf("got token file mode %o, want 600", mode)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("failed to read token file directory: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files in the token file directory, want no temporary files left behind", len(entries))
+	}
+}
+
+func TestFileCacheFallsBackToSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{name: "missing file"},
+		{name: "corrupt file", contents: `{"access_token":`},
+		{name: "empty token", contents: `{}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the directory is created when the token is persisted
+			path := filepath.Join(t.TempDir(), "tokens", "token.json")
+			if test.contents != "" {
+				if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+					t.Fatalf("failed to create token file directory: %s", err)
+				}
+				if err := os.WriteFile(path, []byte(test.contents), 0o600); err != nil {
+					t.Fatalf("failed to write token file: %s", err)
+				}
+			}
+			source := &fakeSource{lifetime: time.Hour}
+
+			token, err := NewFileCache(zap.NewNop(), path, source).Token(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if token.AccessToken != "token-1" || source.Calls() != 1 {
+				t.Errorf("got token %q after %d source calls, want a single token from the source",
+					token.AccessToken, source.Calls())
+			}
+			if persisted := readTokenFile(t, path); persisted.AccessToken != "token-1" {
+				t.Errorf("got persisted token %q, want the token from the source", persisted.AccessToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthorizationCode implements the Spotify Authorization Code with PKCE flow, which grants access to a user's data.
+// https://developer.spotify.com/documentation/general/guides/authorization/code-flow/
+type AuthorizationCode struct {
+	accountsURL string
+	clientID    string
+	redirectURL string
+	scopes      []string
+	httpClient  *http.Client
+}
+
+// NewAuthorizationCode initialises an AuthorizationCode for the given accounts service base URL. The redirect URL must
+// be registered with the Spotify application.
+func NewAuthorizationCode(httpClient *http.Client, accountsURL, clientID, redirectURL string,
+	scopes []string) *AuthorizationCode {
+	return &AuthorizationCode{
+		accountsURL: accountsURL,
+		clientID:    clientID,
+		redirectURL: redirectURL,
+		scopes:      scopes,
+		httpClient:  httpClient,
+	}
+}
+
+// NewRandomString generates a URL safe random string suitable for use as a PKCE code verifier, state parameter or
+// session ID.
+func NewRandomString() (string, error) {
+	b := make([]byte, 48)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random string: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge derives the S256 PKCE code challenge from a code verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL to redirect the user to in order to authorise the application.
+func (a *AuthorizationCode) AuthCodeURL(state, verifier string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", a.clientID)
+	query.Set("redirect_uri", a.redirectURL)
+	query.Set("scope", strings.Join(a.scopes, " "))
+	query.Set("state", state)
+	query.Set("code_challenge_method", "S256")
+	query.Set("code_challenge", CodeChallenge(verifier))
+	return a.accountsURL + "authorize?" + query.Encode()
+}
+
+// UserToken is an access token for a user, along with the refresh token used to renew it.
+type UserToken struct {
+	Token
+	RefreshToken string `json:"refresh_token"`
+}
+
+type userTokenRespBody struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// Exchange exchanges an authorisation code for a user token.
+func (a *AuthorizationCode) Exchange(ctx context.Context, code, verifier string) (UserToken, error) {
+	formValues := url.Values{}
+	formValues.Set("grant_type", "authorization_code")
+	formValues.Set("code", code)
+	formValues.Set("redirect_uri", a.redirectURL)
+	formValues.Set("client_id", a.clientID)
+	formValues.Set("code_verifier", verifier)
+	return a.requestToken(ctx, formValues)
+}
+
+// Refresh renews a user token using its refresh token. Spotify may rotate the refresh token, in which case the
+// returned token holds the new refresh token; otherwise the given refresh token is carried over.
+func (a *AuthorizationCode) Refresh(ctx context.Context, refreshToken string) (UserToken, error) {
+	formValues := url.Values{}
+	formValues.Set("grant_type", "refresh_token")
+	formValues.Set("refresh_token", refreshToken)
+	formValues.Set("client_id", a.clientID)
+
+	token, err := a.requestToken(ctx, formValues)
+	if err != nil {
+		return token, err
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	return token, nil
+}
+
+func (a *AuthorizationCode) requestToken(ctx context.Context, formValues url.Values) (UserToken, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.accountsURL+"api/token",
+		strings.NewReader(formValues.Encode()))
+	if err != nil {
+		return UserToken{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return UserToken{}, fmt.Errorf("failed to perform token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return UserToken{}, fmt.Errorf("unexpected status from token request: %s", resp.Status)
+	}
+
+	body := userTokenRespBody{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return UserToken{}, fmt.Errorf("failed to JSON decode body from token request: %w", err)
+	}
+
+	return UserToken{
+		Token: Token{
+			AccessToken: body.AccessToken,
+			Expiry:      time.Now().UTC().Add(time.Duration(body.ExpiresIn) * time.Second),
+		},
+		RefreshToken: body.RefreshToken,
+	}, nil
+}
+
+// UserTokenSource is a TokenSource which renews a user's token using its refresh token, keeping track of rotated
+// refresh tokens.
+type UserTokenSource struct {
+	flow *AuthorizationCode
+
+	mu    sync.Mutex
+	token UserToken
+	used  bool
+}
+
+var _ TokenSource = (*UserTokenSource)(nil)
+
+// NewUserTokenSource initialises a UserTokenSource from the token returned by Exchange.
+func NewUserTokenSource(flow *AuthorizationCode, token UserToken) *UserTokenSource {
+	return &UserTokenSource{
+		flow:  flow,
+		token: token,
+	}
+}
+
+// Token returns the initial token if this is the first call and it is still valid, otherwise it renews the token.
+func (u *UserTokenSource) Token(ctx context.Context) (Token, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !u.used && u.token.Valid() {
+		u.used = true
+		return u.token.Token, nil
+	}
+	u.used = true
+
+	token, err := u.flow.Refresh(ctx, u.token.RefreshToken)
+	if err != nil {
+		return Token{}, err
+	}
+	u.token = token
+	return token.Token, nil
+}
@@ -0,0 +1,169 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify/auth"
+	"github.com/jemgunay/spotify-unwrapped/spotify/spotifytest"
+)
+
+const testRedirectURL = "http://localhost/auth/callback"
+
+// newTestFlow returns an AuthorizationCode flow targeting the fake accounts service.
+func newTestFlow(t *testing.T) (*auth.AuthorizationCode, *spotifytest.Server) {
+	t.Helper()
+	srv := spotifytest.NewServer()
+	t.Cleanup(srv.Close)
+	conf := srv.Config()
+	flow := auth.NewAuthorizationCode(srv.Client(), conf.AccountsURL, conf.ClientID, testRedirectURL,
+		[]string{"user-top-read"})
+	return flow, srv
+}
+
+// authorize follows the authorisation URL to the fake accounts service, which approves it, returning the query of the
+// redirect back to the redirect URL.
+func authorize(t *testing.T, srv *spotifytest.Server, authURL string) url.Values {
+	t.Helper()
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("failed to request authorisation: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("got authorisation status %d, want 302", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse authorisation redirect: %s", err)
+	}
+	if redirect := location.Scheme + "://" + location.Host + location.Path; redirect != testRedirectURL {
+		t.Fatalf("got redirect to %s, want %s", redirect, testRedirectURL)
+	}
+	return location.Query()
+}
+
+// login completes the authorisation code flow, returning the user token.
+func login(t *testing.T, flow *auth.AuthorizationCode, srv *spotifytest.Server) auth.UserToken {
+	t.Helper()
+	verifier, err := auth.NewRandomString()
+	if err != nil {
+		t.Fatalf("failed to generate verifier: %s", err)
+	}
+	query := authorize(t, srv, flow.AuthCodeURL("state", verifier))
+	token, err := flow.Exchange(context.Background(), query.Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("failed to exchange code: %s", err)
+	}
+	return token
+}
+
+func TestAuthorizationCodeAuthorize(t *testing.T) {
+	flow, srv := newTestFlow(t)
+
+	query := authorize(t, srv, flow.AuthCodeURL("some-state", "verifier"))
+	if got := query.Get("state"); got != "some-state" {
+		t.Errorf("got state %q, want some-state", got)
+	}
+	if query.Get("code") == "" {
+		t.Error("got no authorisation code")
+	}
+}
+
+func TestAuthorizationCodeExchange(t *testing.T) {
+	flow, srv := newTestFlow(t)
+
+	token := login(t, flow, srv)
+	if !token.Valid() {
+		t.Errorf("got invalid token %+v", token)
+	}
+	if token.RefreshToken == "" {
+		t.Error("got no refresh token")
+	}
+}
+
+func TestAuthorizationCodeExchangeRejections(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange func(t *testing.T, flow *auth.AuthorizationCode, code string) error
+	}{
+		{
+			name: "wrong verifier",
+			exchange: func(t *testing.T, flow *auth.AuthorizationCode, code string) error {
+				_, err := flow.Exchange(context.Background(), code, "other-verifier")
+				return err
+			},
+		},
+		{
+			name: "reused code",
+			exchange: func(t *testing.T, flow *auth.AuthorizationCode, code string) error {
+				if _, err := flow.Exchange(context.Background(), code, "verifier"); err != nil {
+					t.Fatalf("failed to exchange code the first time: %s", err)
+				}
+				_, err := flow.Exchange(context.Background(), code, "verifier")
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flow, srv := newTestFlow(t)
+			query := authorize(t, srv, flow.AuthCodeURL("state", "verifier"))
+			if err := tt.exchange(t, flow, query.Get("code")); err == nil {
+				t.Error("got nil error, want the exchange to be rejected")
+			}
+		})
+	}
+}
+
+func TestAuthorizationCodeRefreshRotatesRefreshToken(t *testing.T) {
+	flow, srv := newTestFlow(t)
+	token := login(t, flow, srv)
+
+	refreshed, err := flow.Refresh(context.Background(), token.RefreshToken)
+	if err != nil {
+		t.Fatalf("failed to refresh token: %s", err)
+	}
+	if refreshed.AccessToken == token.AccessToken {
+		t.Error("got the same access token, want a new one")
+	}
+	if refreshed.RefreshToken == token.RefreshToken {
+		t.Error("got the same refresh token, want it to be rotated")
+	}
+	// the fake accounts service revokes rotated refresh tokens
+	if _, err := flow.Refresh(context.Background(), token.RefreshToken); err == nil {
+		t.Error("got nil error refreshing with the rotated refresh token, want it to be rejected")
+	}
+}
+
+func TestUserTokenSourceTracksRotatedRefreshTokens(t *testing.T) {
+	flow, srv := newTestFlow(t)
+	token := login(t, flow, srv)
+	source := auth.NewUserTokenSource(flow, token)
+
+	// the initial token is returned first, then each refresh must use the latest rotated refresh token
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		got, err := source.Token(context.Background())
+		if err != nil {
+			t.Fatalf("token %d: unexpected error: %s", i, err)
+		}
+		if i == 0 && got.AccessToken != token.AccessToken {
+			t.Errorf("got initial token %q, want %q", got.AccessToken, token.AccessToken)
+		}
+		if seen[got.AccessToken] {
+			t.Errorf("token %d: got previously issued token %q, want a new one", i, got.AccessToken)
+		}
+		seen[got.AccessToken] = true
+	}
+	if got := srv.RequestCount("/api/token"); got != 3 {
+		t.Errorf("got %d token requests, want 1 exchange and 2 refreshes", got)
+	}
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/config"
+)
+
+// Token is a Spotify access token and its expiry.
+type Token struct {
+	AccessToken string    `json:"access_token"`
+	Expiry      time.Time `json:"expiry"`
+}
+
+// Valid reports whether the token is set and has not expired.
+func (t Token) Valid() bool {
+	return t.AccessToken != "" && time.Now().Before(t.Expiry)
+}
+
+// TokenSource provides fresh access tokens.
+type TokenSource interface {
+	// Token returns a new access token.
+	Token(ctx context.Context) (Token, error)
+}
+
+// ClientCredentials is a TokenSource which requests access tokens from the Spotify accounts service using the client
+// credentials grant.
+// https://developer.spotify.com/documentation/general/guides/authorization/client-credentials/
+type ClientCredentials struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	httpClient   *http.Client
+	logger       config.Logger
+}
+
+var _ TokenSource = (*ClientCredentials)(nil)
+
+// NewClientCredentials initialises a ClientCredentials for the given accounts service base URL.
+func NewClientCredentials(logger config.Logger, httpClient *http.Client, accountsURL, clientID,
+	clientSecret string) *ClientCredentials {
+	return &ClientCredentials{
+		tokenURL:     accountsURL + "api/token",
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		httpClient:   httpClient,
+		logger:       logger,
+	}
+}
+
+type authRespBody struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Token requests an access token for performing Spotify API requests, as well as its expiry date.
+func (c *ClientCredentials) Token(ctx context.Context) (Token, error) {
+	formValues := url.Values{}
+	formValues.Set("grant_type", "client_credentials")
+	formValuesBuf := strings.NewReader(formValues.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, formValuesBuf)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to create auth request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// base64 basic auth secrets
+	base64Auth := base64.StdEncoding.EncodeToString([]byte(c.clientID + ":" + c.clientSecret))
+	req.Header.Set("Authorization", "Basic "+base64Auth)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to perform auth request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Token{}, fmt.Errorf("unexpected status from auth request: %s", resp.Status)
+	}
+
+	authBody := authRespBody{}
+	if err := json.NewDecoder(resp.Body).Decode(&authBody); err != nil {
+		return Token{}, fmt.Errorf("failed to JSON decode body from auth request: %w", err)
+	}
+
+	// successfully authenticated
+	expiry := time.Now().UTC().Add(time.Duration(authBody.ExpiresIn) * time.Second)
+	c.logger.Info("successfully authenticated with Spotify", zap.Time("expiry", expiry))
+
+	return Token{AccessToken: authBody.AccessToken, Expiry: expiry}, nil
+}
+
+// staticTokenSource is a TokenSource which always returns the same token.
+type staticTokenSource struct {
+	token Token
+}
+
+// StaticToken returns a TokenSource which always returns the given access token, e.g. for use in tests. A zero expiry
+// is treated as never expiring.
+func StaticToken(accessToken string, expiry time.Time) TokenSource {
+	if expiry.IsZero() {
+		expiry = time.Now().AddDate(100, 0, 0)
+	}
+	return staticTokenSource{
+		token: Token{AccessToken: accessToken, Expiry: expiry},
+	}
+}
+
+// Token returns the static token.
+func (s staticTokenSource) Token(_ context.Context) (Token, error) {
+	return s.token, nil
+}
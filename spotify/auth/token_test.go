@@ -0,0 +1,60 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/spotify/auth"
+	"github.com/jemgunay/spotify-unwrapped/spotify/spotifytest"
+)
+
+func TestClientCredentials(t *testing.T) {
+	srv := spotifytest.NewServer(spotifytest.WithTokenExpiry(time.Minute * 30))
+	t.Cleanup(srv.Close)
+	conf := srv.Config()
+
+	start := time.Now()
+	source := auth.NewClientCredentials(zap.NewNop(), srv.Client(), conf.AccountsURL, conf.ClientID, conf.ClientSecret)
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.AccessToken == "" || !token.Valid() {
+		t.Errorf("got token %+v, want a valid access token", token)
+	}
+	if expiry := token.Expiry.Sub(start); expiry < time.Minute*29 || expiry > time.Minute*31 {
+		t.Errorf("got token expiring in %s, want around 30m", expiry)
+	}
+
+	// the token is accepted by the API
+	srv.AddPlaylist(spotify.Playlist{ID: "p"})
+	req, err := http.NewRequest(http.MethodGet, conf.APIURL+"playlists/p", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to request API: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d from the API, want the token to be accepted", resp.StatusCode)
+	}
+}
+
+func TestClientCredentialsRejectsWrongSecret(t *testing.T) {
+	srv := spotifytest.NewServer()
+	t.Cleanup(srv.Close)
+	conf := srv.Config()
+
+	source := auth.NewClientCredentials(zap.NewNop(), srv.Client(), conf.AccountsURL, conf.ClientID, "wrong")
+	if token, err := source.Token(context.Background()); err == nil {
+		t.Errorf("got token %+v, want an error for the wrong client secret", token)
+	}
+}
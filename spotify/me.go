@@ -0,0 +1,158 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// TimeRange is the period over which a user's top tracks and artists are calculated.
+type TimeRange string
+
+// Time ranges supported by the Spotify top items API.
+const (
+	// ShortTerm covers approximately the last 4 weeks.
+	ShortTerm TimeRange = "short_term"
+	// MediumTerm covers approximately the last 6 months.
+	MediumTerm TimeRange = "medium_term"
+	// LongTerm covers approximately the last year.
+	LongTerm TimeRange = "long_term"
+)
+
+// ErrInvalidTimeRange indicates that a time range is not supported.
+var ErrInvalidTimeRange = errors.New("invalid time range")
+
+// ParseTimeRange parses a time range, defaulting to MediumTerm if empty, which is also Spotify's default.
+func ParseTimeRange(s string) (TimeRange, error) {
+	switch TimeRange(s) {
+	case "":
+		return MediumTerm, nil
+	case ShortTerm, MediumTerm, LongTerm:
+		return TimeRange(s), nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidTimeRange, s)
+}
+
+// maxTopItemsLimit is the maximum page size supported by the Spotify top items API.
+const maxTopItemsLimit = 50
+
+// GetTopTracks gets the user's top tracks for the given time range, most listened to first. The tracks are wrapped
+// in track items so that they can be aggregated in the same way as playlist tracks.
+// https://developer.spotify.com/documentation/web-api/reference/#/operations/get-users-top-artists-and-tracks
+func (r *Requester) GetTopTracks(ctx context.Context, timeRange TimeRange) ([]TrackItem, error) {
+	tracks, err := getAllPages[*TrackDetails](ctx, r, r.topItemsURL("tracks", timeRange))
+	if err != nil {
+		return nil, fmt.Errorf("get top tracks request failed: %w", err)
+	}
+
+	items := make([]TrackItem, 0, len(tracks))
+	for _, track := range tracks {
+		items = append(items, TrackItem{TrackDetails: track})
+	}
+	return items, nil
+}
+
+// GetTopArtists gets the user's top artists for the given time range, most listened to first.
+// https://developer.spotify.com/documentation/web-api/reference/#/operations/get-users-top-artists-and-tracks
+func (r *Requester) GetTopArtists(ctx context.Context, timeRange TimeRange) ([]Artist, error) {
+	artists, err := getAllPages[Artist](ctx, r, r.topItemsURL("artists", timeRange))
+	if err != nil {
+		return nil, fmt.Errorf("get top artists request failed: %w", err)
+	}
+	return artists, nil
+}
+
+// maxSavedTracksLimit is the maximum page size supported by the Spotify saved tracks API.
+const maxSavedTracksLimit = 50
+
+// GetSavedTracks gets the tracks saved to the user's library, most recently saved first. As with GetPlaylist, the
+// remaining pages are fetched concurrently by offset after the first, up to the configured maximum number of playlist
+// tracks; if the library was truncated, NextURL points at the first page not fetched.
+// https://developer.spotify.com/documentation/web-api/reference/#/operations/get-users-saved-tracks
+func (r *Requester) GetSavedTracks(ctx context.Context) (Tracks, error) {
+	firstPage, err := r.getTracksPage(ctx, r.savedTracksURL())
+	if err != nil {
+		return firstPage, fmt.Errorf("get saved tracks request failed: %w", err)
+	}
+	return r.getAllTracks(ctx, firstPage)
+}
+
+// StreamSavedTracks gets the tracks saved to the user's library, passing each page to fn in order rather than
+// accumulating them, as per StreamPlaylist.
+func (r *Requester) StreamSavedTracks(ctx context.Context, fn func(Tracks) error) (Tracks, error) {
+	firstPage, err := r.getTracksPage(ctx, r.savedTracksURL())
+	if err != nil {
+		return firstPage, fmt.Errorf("get saved tracks request failed: %w", err)
+	}
+	return r.streamTracks(ctx, firstPage, fn)
+}
+
+// maxRecentlyPlayedLimit is the maximum page size supported by the Spotify recently played API.
+const maxRecentlyPlayedLimit = 50
+
+// PlayHistory represents a single play of a track.
+type PlayHistory struct {
+	Track    *TrackDetails `json:"track"`
+	PlayedAt time.Time     `json:"played_at"`
+}
+
+// GetRecentlyPlayed gets the tracks the user has recently played, most recent first. Spotify only provides a limited
+// number of recent plays.
+// https://developer.spotify.com/documentation/web-api/reference/#/operations/get-recently-played
+func (r *Requester) GetRecentlyPlayed(ctx context.Context) ([]PlayHistory, error) {
+	reqURL := r.conf.APIURL + "me/player/recently-played?limit=" + strconv.Itoa(maxRecentlyPlayedLimit)
+	plays, err := getAllPages[PlayHistory](ctx, r, reqURL)
+	if err != nil {
+		return nil, fmt.Errorf("get recently played request failed: %w", err)
+	}
+	return plays, nil
+}
+
+func (r *Requester) savedTracksURL() string {
+	return r.conf.APIURL + "me/tracks?limit=" + strconv.Itoa(maxSavedTracksLimit)
+}
+
+func (r *Requester) topItemsURL(itemType string, timeRange TimeRange) string {
+	query := url.Values{}
+	query.Set("time_range", string(timeRange))
+	query.Set("limit", strconv.Itoa(maxTopItemsLimit))
+	return r.conf.APIURL + "me/top/" + itemType + "?" + query.Encode()
+}
+
+// page represents a page of a paginated Spotify API response.
+type page[T any] struct {
+	Items   []T    `json:"items"`
+	NextURL string `json:"next"`
+	Total   int    `json:"total"`
+}
+
+// getAllPages gets the items of every page of a paginated response by following each page's next URL, until either
+// the last page or the configured maximum number of playlist tracks has been fetched.
+func getAllPages[T any](ctx context.Context, r *Requester, reqURL string) ([]T, error) {
+	maxItems := r.conf.MaxPlaylistTracks
+	var items []T
+	for reqURL != "" && (maxItems <= 0 || len(items) < maxItems) {
+		current := page[T]{}
+		if err := r.performGetRequest(ctx, reqURL, &current); err != nil {
+			return items, err
+		}
+		// guard against looping forever on empty pages which still link to a next page
+		if len(current.Items) == 0 {
+			break
+		}
+		items = append(items, current.Items...)
+
+		reqURL = ""
+		if current.NextURL != "" {
+			reqURL = r.rewriteURL(current.NextURL)
+		}
+	}
+
+	if maxItems > 0 && len(items) > maxItems {
+		items = items[:maxItems]
+	}
+	return items, nil
+}
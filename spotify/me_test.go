@@ -0,0 +1,34 @@
+package spotify
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetAllPagesStopsOnEmptyPage(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 1}
+	r, attempts := newRetryTestRequester(t, policy, func(w http.ResponseWriter, n int32) {
+		w.Header().Set("Content-Type", "application/json")
+		if n == 1 {
+			w.Write([]byte(`{"items":[{"name":"Artist"}],"next":"https://api.spotify.com/v1/me/top/artists?offset=1"}`))
+			return
+		}
+		// every later page is empty, but still links to another page
+		w.Write([]byte(`{"items":[],"next":"https://api.spotify.com/v1/me/top/artists?offset=1"}`))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	artists, err := r.GetTopArtists(ctx, ShortTerm)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(artists) != 1 || artists[0].Name != "Artist" {
+		t.Errorf("got artists %+v, want the single artist of the first page", artists)
+	}
+	if got := *attempts; got != 2 {
+		t.Errorf("got %d page requests, want 2", got)
+	}
+}
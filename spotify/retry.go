@@ -0,0 +1,159 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy defines how failed Spotify API requests are retried. Delays grow exponentially from InitialInterval by
+// Multiplier up to MaxInterval, with each delay randomised by +/- Jitter. A Retry-After delay provided by a rate
+// limited response takes precedence over the computed delay.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is performed, including the first attempt. A request is
+	// always attempted at least once.
+	MaxAttempts int
+	// InitialInterval is the delay before the first retry.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between any two attempts, excluding Retry-After delays.
+	MaxInterval time.Duration
+	// Multiplier is the factor the delay grows by after each failed attempt.
+	Multiplier float64
+	// Jitter is the randomisation factor applied to each delay, between 0 and 1.
+	Jitter float64
+	// MaxElapsedTime is the total time budget for a request and its retries. Zero means no limit.
+	MaxElapsedTime time.Duration
+}
+
+// DefaultRetryPolicy returns the RetryPolicy used by a Requester unless otherwise configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     10,
+		InitialInterval: time.Millisecond * 200,
+		MaxInterval:     time.Second * 10,
+		Multiplier:      2,
+		Jitter:          0.5,
+		MaxElapsedTime:  time.Second * 30,
+	}
+}
+
+// backoff returns the delay to wait before the given retry attempt, where attempt 1 is the first retry.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxInterval > 0 && delay > float64(p.MaxInterval) {
+		delay = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		delta := p.Jitter * delay
+		delay = delay - delta + rand.Float64()*(2*delta)
+	}
+	return time.Duration(delay)
+}
+
+// RateLimitError indicates that a request was rate limited. RetryAfter holds the delay requested by Spotify via the
+// Retry-After header, or zero if none was provided. It matches ErrRateLimited when used with errors.Is.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+// Error returns the error string.
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter == 0 {
+		return ErrRateLimited.Error()
+	}
+	return fmt.Sprintf("%s: retry after %s", ErrRateLimited, e.RetryAfter)
+}
+
+// Is reports whether the target is ErrRateLimited.
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// StatusError indicates that a request failed with an unexpected response status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+// Error returns the error string.
+func (e *StatusError) Error() string {
+	return "unexpected response status: " + e.Status
+}
+
+// Temporary reports whether the status is a server side failure which may succeed if retried.
+func (e *StatusError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// transportError indicates that a request failed without a response status, or that its response body couldn't be
+// read, e.g. due to a connection reset or timeout.
+type transportError struct {
+	err error
+}
+
+// Error returns the error string.
+func (e *transportError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// isRetryable determines whether a failed request should be attempted again. Only transport failures, rate limiting
+// and temporary server side failures are retried, as any other failure, e.g. a malformed response body, would fail the
+// same way again.
+func isRetryable(err error) bool {
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+	var transportErr *transportError
+	return errors.As(err, &transportErr)
+}
+
+// parseRetryAfter parses a Retry-After header value, which is either a number of seconds or an HTTP date.
+func parseRetryAfter(val string) time.Duration {
+	if val == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(val); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(val); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// sleep pauses for the given duration, returning early with the context's error if it is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,218 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/config"
+	"github.com/jemgunay/spotify-unwrapped/spotify/auth"
+)
+
+// staticTokenSource issues the same long lived access token.
+type staticTokenSource struct{}
+
+func (staticTokenSource) Token(context.Context) (auth.Token, error) {
+	return auth.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+// newRetryTestRequester returns a Requester targeting a server which responds to the nth request, from 1, using the
+// given func. The number of requests received is counted in attempts.
+func newRetryTestRequester(t *testing.T, policy RetryPolicy, respond func(w http.ResponseWriter, n int32)) (*Requester,
+	*int32) {
+	t.Helper()
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		respond(w, atomic.AddInt32(&attempts, 1))
+	}))
+	t.Cleanup(srv.Close)
+
+	r := New(zap.NewNop(), config.Spotify{APIURL: srv.URL + "/v1/", Concurrency: 1},
+		WithRetryPolicy(policy), WithTokenSource(staticTokenSource{}))
+	t.Cleanup(r.Close)
+	return r, &attempts
+}
+
+// writePlaylist writes a minimal playlist response.
+func writePlaylist(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"id":"playlist","name":"Playlist","tracks":{"items":[],"total":0}}`))
+}
+
+func TestPerformGetRequestHonoursRetryAfter(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond}
+	r, attempts := newRetryTestRequester(t, policy, func(w http.ResponseWriter, n int32) {
+		if n == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		writePlaylist(w)
+	})
+
+	start := time.Now()
+	playlist, err := r.GetPlaylist(context.Background(), "playlist")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if playlist.Name != "Playlist" {
+		t.Errorf("got playlist name %q, want %q", playlist.Name, "Playlist")
+	}
+	if got := atomic.LoadInt32(attempts); got != 2 {
+		t.Errorf("got %d attempts, want 2", got)
+	}
+	// the Retry-After delay overrides the 1ms backoff
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want at least the Retry-After delay of 1s", elapsed)
+	}
+}
+
+func TestPerformGetRequestBacksOffOnServerErrors(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialInterval: time.Millisecond * 20, Multiplier: 2}
+	r, attempts := newRetryTestRequester(t, policy, func(w http.ResponseWriter, n int32) {
+		if n <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writePlaylist(w)
+	})
+
+	start := time.Now()
+	if _, err := r.GetPlaylist(context.Background(), "playlist"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := atomic.LoadInt32(attempts); got != 3 {
+		t.Errorf("got %d attempts, want 3", got)
+	}
+	// without jitter, the retries are delayed by 20ms then 40ms
+	if elapsed := time.Since(start); elapsed < time.Millisecond*60 {
+		t.Errorf("succeeded after %s, want at least 60ms of backoff", elapsed)
+	}
+}
+
+func TestPerformGetRequestDoesNotRetryPermanentFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(w http.ResponseWriter)
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name: "bad request",
+			respond: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusBadRequest)
+			},
+			check: func(t *testing.T, err error) {
+				var statusErr *StatusError
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+					t.Errorf("got error %v, want a 400 *StatusError", err)
+				}
+			},
+		},
+		{
+			name: "not found",
+			respond: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("got error %v, want ErrNotFound", err)
+				}
+			},
+		},
+		{
+			name: "malformed JSON",
+			respond: func(w http.ResponseWriter) {
+				w.Write([]byte(`{"id":"playl`))
+			},
+			check: func(t *testing.T, err error) {
+				if err == nil {
+					t.Error("got nil error, want a JSON decode error")
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := RetryPolicy{MaxAttempts: 5, InitialInterval: time.Millisecond}
+			r, attempts := newRetryTestRequester(t, policy, func(w http.ResponseWriter, _ int32) {
+				tt.respond(w)
+			})
+
+			_, err := r.GetPlaylist(context.Background(), "playlist")
+			tt.check(t, err)
+			if got := atomic.LoadInt32(attempts); got != 1 {
+				t.Errorf("got %d attempts, want 1", got)
+			}
+		})
+	}
+}
+
+func TestPerformGetRequestStopsAtMaxElapsedTime(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:     100,
+		InitialInterval: time.Millisecond * 50,
+		Multiplier:      1,
+		MaxElapsedTime:  time.Millisecond * 120,
+	}
+	r, attempts := newRetryTestRequester(t, policy, func(w http.ResponseWriter, _ int32) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	start := time.Now()
+	_, err := r.GetPlaylist(context.Background(), "playlist")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got error %v, want a 503 *StatusError", err)
+	}
+	// attempts at roughly 0ms, 50ms and 100ms fit within the budget, but a fourth at 150ms would not
+	if got := atomic.LoadInt32(attempts); got < 2 || got > 3 {
+		t.Errorf("got %d attempts, want 2 or 3", got)
+	}
+	// allow some leeway for the time taken by the requests themselves
+	if elapsed := time.Since(start); elapsed > policy.MaxElapsedTime+time.Millisecond*100 {
+		t.Errorf("gave up after %s, want within the maximum elapsed time of %s", elapsed, policy.MaxElapsedTime)
+	}
+}
+
+func TestWithRetryPolicyAttemptsAtLeastOnce(t *testing.T) {
+	r, attempts := newRetryTestRequester(t, RetryPolicy{}, func(w http.ResponseWriter, _ int32) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	if _, err := r.GetPlaylist(context.Background(), "playlist"); err == nil {
+		t.Error("got nil error, want the failure of the only attempt")
+	}
+	if got := atomic.LoadInt32(attempts); got != 1 {
+		t.Errorf("got %d attempts, want 1", got)
+	}
+}
+
+func TestPerformGetRequestRetriesTransportFailures(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond}
+	r, attempts := newRetryTestRequester(t, policy, func(w http.ResponseWriter, n int32) {
+		if n == 1 {
+			// drop the connection without responding
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("failed to hijack connection: %s", err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		writePlaylist(w)
+	})
+
+	if _, err := r.GetPlaylist(context.Background(), "playlist"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := atomic.LoadInt32(attempts); got != 2 {
+		t.Errorf("got %d attempts, want 2", got)
+	}
+}
@@ -1,13 +1,14 @@
 package spotify
 
 import (
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,70 +20,92 @@ import (
 
 // Requester wraps the Spotify HTTP REST API.
 type Requester struct {
-	conf       config.Spotify
-	access     *auth.Access
-	httpClient *http.Client
-	logger     config.Logger
+	conf        config.Spotify
+	access      *auth.Access
+	httpClient  *http.Client
+	retry       RetryPolicy
+	limiter     *rateLimiter
+	tokenSource auth.TokenSource
+	logger      config.Logger
 }
 
-// New initialises a Requester.
-func New(logger config.Logger, conf config.Spotify) Requester {
-	r := Requester{
-		conf: conf,
-		httpClient: &http.Client{
-			Timeout: time.Second * 10,
-		},
-		logger: logger,
+// RequesterOpt defines a Requester option.
+type RequesterOpt func(*Requester)
+
+// WithRetryPolicy sets the policy used to retry failed requests. A MaxAttempts below 1 is treated as 1, i.e. no
+// retries.
+func WithRetryPolicy(policy RetryPolicy) RequesterOpt {
+	return func(r *Requester) {
+		if policy.MaxAttempts < 1 {
+			policy.MaxAttempts = 1
+		}
+		r.retry = policy
 	}
-	r.access = auth.New(r.authenticate)
-	return r
 }
 
-type authRespBody struct {
-	AccessToken string `json:"access_token"`
-	ExpiresIn   int    `json:"expires_in"`
+// WithHTTPClient sets the HTTP client used to perform requests.
+func WithHTTPClient(client *http.Client) RequesterOpt {
+	return func(r *Requester) {
+		r.httpClient = client
+	}
 }
 
-// authenticate requests an access token for performing Spotify API requests, as well as its expiry date.
-func (r *Requester) authenticate() (string, time.Time, error) {
-	formValues := url.Values{}
-	formValues.Set("grant_type", "client_credentials")
-	formValuesBuf := strings.NewReader(formValues.Encode())
-
-	req, err := http.NewRequest(http.MethodPost, "https://accounts.spotify.com/api/token", formValuesBuf)
-	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to create auth request: %w", err)
+// WithTokenSource sets the source of access tokens, overriding the default client credentials source.
+func WithTokenSource(source auth.TokenSource) RequesterOpt {
+	return func(r *Requester) {
+		r.tokenSource = source
 	}
+}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	// base64 basic auth secrets
-	base64Auth := base64.StdEncoding.EncodeToString([]byte(r.conf.ClientID + ":" + r.conf.ClientSecret))
-	req.Header.Set("Authorization", "Basic "+base64Auth)
-
-	resp, err := r.httpClient.Do(req)
-	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to perform auth request: %w", err)
+// New initialises a Requester. Unless otherwise configured, access tokens are requested using the client credentials
+// grant and, if a token cache path is configured, persisted across restarts.
+func New(logger config.Logger, conf config.Spotify, opts ...RequesterOpt) *Requester {
+	r := &Requester{
+		conf: conf,
+		httpClient: &http.Client{
+			Timeout: time.Second * 10,
+		},
+		retry:   DefaultRetryPolicy(),
+		limiter: newRateLimiter(float64(conf.RequestsPerSecond)),
+		logger:  logger,
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", time.Time{}, fmt.Errorf("unexpected status from auth request: %s", resp.Status)
+	for _, opt := range opts {
+		opt(r)
 	}
-
-	authBody := authRespBody{}
-	if err := json.NewDecoder(resp.Body).Decode(&authBody); err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to JSON decode body from auth request: %w", err)
+	if r.tokenSource == nil {
+		r.tokenSource = auth.NewClientCredentials(logger, r.httpClient, conf.AccountsURL, conf.ClientID,
+			conf.ClientSecret)
+		if conf.TokenCachePath != "" {
+			r.tokenSource = auth.NewFileCache(logger, conf.TokenCachePath, r.tokenSource)
+		}
 	}
+	r.access = auth.New(r.tokenSource, auth.WithBackgroundRefresh(conf.TokenRefreshMargin))
+	return r
+}
 
-	// successfully authenticated
-	expiry := time.Now().UTC().Add(time.Duration(authBody.ExpiresIn) * time.Second)
-	r.logger.Info("successfully authenticated with Spotify", zap.Time("expiry", expiry))
+// ForUser returns a Requester which performs requests on behalf of a user, using access tokens from the given source,
+// e.g. an auth.UserTokenSource. It shares the HTTP client, retry policy and rate limiter of r. User tokens are only
+// renewed on demand, rather than in the background.
+func (r *Requester) ForUser(source auth.TokenSource) *Requester {
+	return &Requester{
+		conf:        r.conf,
+		access:      auth.New(source),
+		httpClient:  r.httpClient,
+		retry:       r.retry,
+		limiter:     r.limiter,
+		tokenSource: source,
+		logger:      r.logger,
+	}
+}
 
-	return authBody.AccessToken, expiry, nil
+// Close stops the Requester's background access token refreshes.
+func (r *Requester) Close() {
+	r.access.Close()
 }
 
 // Playlist represents a playlist of tracks.
 type Playlist struct {
+	ID           string `json:"id"`
 	Name         string `json:"name"`
 	Owner        Owner  `json:"owner"`
 	Tracks       Tracks `json:"tracks"`
@@ -105,22 +128,76 @@ type Tracks struct {
 	TrackItems []TrackItem `json:"items"`
 	NextURL    string      `json:"next"`
 	Total      int         `json:"total"`
+	Limit      int         `json:"limit"`
+	Offset     int         `json:"offset"`
 }
 
-// TrackItem represents the details for a given track.
+// TrackItem represents a playlist or saved library item. Items are usually tracks, but may also be local files, podcast episodes or
+// content which is no longer available, in which case TrackDetails is nil. Use Kind to distinguish between them.
 type TrackItem struct {
-	TrackDetails TrackDetails `json:"track"`
+	// AddedAt is when the item was added to the playlist or saved to the library. It may be zero for items added to
+	// playlists long ago.
+	AddedAt      time.Time     `json:"added_at"`
+	IsLocal      bool          `json:"is_local"`
+	TrackDetails *TrackDetails `json:"track"`
+}
+
+// ItemKind defines the kinds of playlist item.
+type ItemKind int
+
+const (
+	// ItemTrack is a Spotify track which can be analysed.
+	ItemTrack ItemKind = iota
+	// ItemLocal is a local file added to the playlist from a user's device. Local files have no Spotify ID.
+	ItemLocal
+	// ItemEpisode is a podcast episode.
+	ItemEpisode
+	// ItemUnavailable is content which has been removed from Spotify.
+	ItemUnavailable
+)
+
+// String returns the item kind's name.
+func (k ItemKind) String() string {
+	switch k {
+	case ItemTrack:
+		return "track"
+	case ItemLocal:
+		return "local"
+	case ItemEpisode:
+		return "episode"
+	case ItemUnavailable:
+		return "unavailable"
+	}
+	return "unknown"
+}
+
+// Kind determines the kind of playlist item.
+func (t TrackItem) Kind() ItemKind {
+	switch {
+	case t.TrackDetails == nil:
+		return ItemUnavailable
+	case t.IsLocal || t.TrackDetails.IsLocal:
+		return ItemLocal
+	case t.TrackDetails.Type == "episode":
+		return ItemEpisode
+	case t.TrackDetails.ID == "":
+		return ItemUnavailable
+	}
+	return ItemTrack
 }
 
-// TrackDetails represents the details of a track.
+// TrackDetails represents the details of a track, or of a podcast episode if Type is "episode".
 type TrackDetails struct {
-	ID           string   `json:"id"`
-	Name         string   `json:"name"`
-	Popularity   float64  `json:"popularity"` // 0-100
-	Artists      []Artist `json:"artists"`
-	Album        Album    `json:"album"`
-	Explicit     bool     `json:"explicit"`
-	ExternalURLs struct {
+	ID             string   `json:"id"`
+	Type           string   `json:"type"`
+	IsLocal        bool     `json:"is_local"`
+	Name           string   `json:"name"`
+	Popularity     float64  `json:"popularity"` // 0-100
+	Artists        []Artist `json:"artists"`
+	Album          Album    `json:"album"`
+	Explicit       bool     `json:"explicit"`
+	DurationMillis int      `json:"duration_ms"`
+	ExternalURLs   struct {
 		Spotify string `json:"spotify"`
 	} `json:"external_urls"`
 	artistsFormatted string
@@ -151,10 +228,17 @@ func (t *TrackDetails) GetArtists() string {
 	return t.artistsFormatted
 }
 
-// Artist represents a single artist.
+// Artist represents a single artist. Genres, Popularity and Images are only set for full artist objects, e.g. a
+// user's top artists, rather than those embedded in tracks.
 type Artist struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Genres       []string `json:"genres"`
+	Popularity   float64  `json:"popularity"` // 0-100
+	Images       Images   `json:"images"`
+	ExternalURLs struct {
+		Spotify string `json:"spotify"`
+	} `json:"external_urls"`
 }
 
 // Album represents a single album.
@@ -200,62 +284,221 @@ var (
 	ErrRateLimited  = errors.New("rate limited")
 )
 
-const (
-	apiURL = "https://api.spotify.com/v1/"
-	// only the first ~3000 tracks of a playlist will be processed
-	maxPlaylistPages = 30
-)
-
-// GetPlaylist gets all required data for the given playlist ID.
+// GetPlaylist gets all required data for the given playlist ID. The first page of tracks is returned with the
+// playlist, after which the remaining pages are fetched concurrently by offset. Only the configured maximum number of
+// tracks are fetched; if the playlist was truncated, its tracks' NextURL points at the first page not fetched.
 // https://developer.spotify.com/documentation/web-api/reference/#/operations/get-playlist
-func (r *Requester) GetPlaylist(id string) (Playlist, error) {
-	playlist, err := r.getPlaylist(id)
+func (r *Requester) GetPlaylist(ctx context.Context, id string) (Playlist, error) {
+	playlist, err := r.getPlaylist(ctx, id)
 	if err != nil {
 		return playlist, err
 	}
+	playlist.Tracks, err = r.getAllTracks(ctx, playlist.Tracks)
+	return playlist, err
+}
 
-	// get the rest of the paginated playlist tracks
-	for i := 0; i < maxPlaylistPages; i++ {
-		if playlist.Tracks.NextURL == "" {
-			return playlist, nil
-		}
+// StreamPlaylist gets the playlist for the given ID, passing each page of its tracks to fn in playlist order rather
+// than accumulating them. Pages are fetched concurrently in windows of the configured concurrency, so only a window of
+// pages is held in memory at once. The returned playlist contains no track items, and its tracks' NextURL indicates
+// truncation as per GetPlaylist. An error returned by fn stops streaming and is returned.
+func (r *Requester) StreamPlaylist(ctx context.Context, id string, fn func(Tracks) error) (Playlist, error) {
+	playlist, err := r.getPlaylist(ctx, id)
+	if err != nil {
+		return playlist, err
+	}
+	playlist.Tracks, err = r.streamTracks(ctx, playlist.Tracks, fn)
+	return playlist, err
+}
+
+// getAllTracks fetches the remaining pages of tracks following the first page concurrently by offset, returning all
+// of the track items, up to the configured maximum number of playlist tracks, in a single page.
+func (r *Requester) getAllTracks(ctx context.Context, firstPage Tracks) (Tracks, error) {
+	tracks := firstPage
+	tracks.TrackItems = r.capTracks(tracks.TrackItems, tracks.Offset)
+	if tracks.NextURL == "" {
+		return tracks, nil
+	}
 
-		playlistTracks, err := r.getPlaylistTracksPage(playlist.Tracks.NextURL)
+	pageURLs, err := r.tracksPageURLs(tracks)
+	if err != nil {
+		return tracks, err
+	}
+	if len(pageURLs) == 0 {
+		return tracks, nil
+	}
+
+	pages, err := r.getTracksPages(ctx, pageURLs)
+	if err != nil {
+		return tracks, err
+	}
+	for _, page := range pages {
+		tracks.TrackItems = append(tracks.TrackItems, page.TrackItems...)
+	}
+	tracks.NextURL = pages[len(pages)-1].NextURL
+
+	return tracks, nil
+}
+
+// streamTracks passes the first page of tracks, followed by each of the remaining pages, to fn in order. The returned
+// tracks contain no track items.
+func (r *Requester) streamTracks(ctx context.Context, firstPage Tracks, fn func(Tracks) error) (Tracks, error) {
+	tracks := firstPage
+	tracks.TrackItems = nil
+	firstPage.TrackItems = r.capTracks(firstPage.TrackItems, firstPage.Offset)
+
+	if err := fn(firstPage); err != nil {
+		return tracks, err
+	}
+	if firstPage.NextURL == "" {
+		return tracks, nil
+	}
+
+	pageURLs, err := r.tracksPageURLs(firstPage)
+	if err != nil {
+		return tracks, err
+	}
+
+	window := r.conf.Concurrency
+	if window <= 0 {
+		window = 1
+	}
+	for lower := 0; lower < len(pageURLs); lower += window {
+		upper := lower + window
+		if upper > len(pageURLs) {
+			upper = len(pageURLs)
+		}
+		pages, err := r.getTracksPages(ctx, pageURLs[lower:upper])
 		if err != nil {
-			return playlist, err
+			return tracks, err
+		}
+		for _, page := range pages {
+			if err := fn(page); err != nil {
+				return tracks, err
+			}
 		}
+		tracks.NextURL = pages[len(pages)-1].NextURL
+	}
 
-		playlist.Tracks.TrackItems = append(playlist.Tracks.TrackItems, playlistTracks.TrackItems...)
-		playlist.Tracks.NextURL = playlistTracks.NextURL
+	return tracks, nil
+}
+
+// capTracks truncates a page of track items starting at the given offset to the configured maximum number of
+// playlist tracks.
+func (r *Requester) capTracks(items []TrackItem, offset int) []TrackItem {
+	if r.conf.MaxPlaylistTracks <= 0 || offset+len(items) <= r.conf.MaxPlaylistTracks {
+		return items
 	}
+	if offset >= r.conf.MaxPlaylistTracks {
+		return nil
+	}
+	return items[:r.conf.MaxPlaylistTracks-offset]
+}
 
-	// we reached maximum pages
-	return playlist, nil
+// tracksPageURLs determines the URLs of the remaining track pages from the first page, up to the configured maximum
+// number of playlist tracks. Each page URL is derived from the first page's next URL so that any other query
+// parameters are preserved.
+func (r *Requester) tracksPageURLs(firstPage Tracks) ([]string, error) {
+	nextURL, err := url.Parse(r.rewriteURL(firstPage.NextURL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tracks next URL: %w", err)
+	}
+
+	pageSize := firstPage.Limit
+	if pageSize <= 0 {
+		pageSize = len(firstPage.TrackItems)
+	}
+	if pageSize <= 0 {
+		return nil, errors.New("failed to determine tracks page size")
+	}
+
+	total := firstPage.Total
+	if r.conf.MaxPlaylistTracks > 0 && total > r.conf.MaxPlaylistTracks {
+		total = r.conf.MaxPlaylistTracks
+	}
+
+	var pageURLs []string
+	for offset := firstPage.Offset + len(firstPage.TrackItems); offset < total; offset += pageSize {
+		limit := pageSize
+		if offset+limit > total {
+			limit = total - offset
+		}
+		query := nextURL.Query()
+		query.Set("offset", strconv.Itoa(offset))
+		query.Set("limit", strconv.Itoa(limit))
+		pageURL := *nextURL
+		pageURL.RawQuery = query.Encode()
+		pageURLs = append(pageURLs, pageURL.String())
+	}
+	return pageURLs, nil
 }
 
-func (r *Requester) getPlaylist(id string) (Playlist, error) {
-	reqURL := apiURL + "playlists/" + id
+// getTracksPages fetches the given track pages concurrently, limited to the configured concurrency.
+// Pages are returned in the same order as their URLs. The first failure cancels any outstanding requests and is
+// returned.
+func (r *Requester) getTracksPages(ctx context.Context, pageURLs []string) ([]Tracks, error) {
+	pages := make([]Tracks, len(pageURLs))
+	err := runConcurrently(ctx, len(pageURLs), r.conf.Concurrency, func(ctx context.Context, i int) error {
+		page, err := r.getTracksPage(ctx, pageURLs[i])
+		if err != nil {
+			return err
+		}
+		pages[i] = page
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+func (r *Requester) getPlaylist(ctx context.Context, id string) (Playlist, error) {
+	reqURL := r.conf.APIURL + "playlists/" + id
 
 	playlist := Playlist{}
-	if err := r.performGetRequest(reqURL, &playlist); err != nil {
+	if err := r.performGetRequest(ctx, reqURL, &playlist); err != nil {
 		return playlist, fmt.Errorf("get playlist request failed: %w", err)
 	}
 
 	return playlist, nil
 }
 
-func (r *Requester) getPlaylistTracksPage(nextURL string) (Tracks, error) {
+func (r *Requester) getTracksPage(ctx context.Context, nextURL string) (Tracks, error) {
 	tracks := Tracks{}
-	if err := r.performGetRequest(nextURL, &tracks); err != nil {
-		return tracks, fmt.Errorf("get playlist tracks request failed: %w", err)
+	if err := r.performGetRequest(ctx, nextURL, &tracks); err != nil {
+		return tracks, fmt.Errorf("get tracks page request failed: %w", err)
 	}
 
 	return tracks, nil
 }
 
-// AudioFeaturesResult represents the response body from the Spotify audio features API.
+// rewriteURL rewrites an absolute Spotify API URL returned in a response, such as a pagination URL, so that it
+// targets the configured API base URL instead. URLs which cannot be rewritten are returned unchanged.
+func (r *Requester) rewriteURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	base, err := url.Parse(r.conf.APIURL)
+	if err != nil {
+		return rawURL
+	}
+
+	// Spotify API paths are versioned, e.g. /v1/playlists/{id}/tracks
+	const versionPrefix = "/v1/"
+	if !strings.HasPrefix(u.Path, versionPrefix) {
+		return rawURL
+	}
+	u.Scheme = base.Scheme
+	u.Host = base.Host
+	u.Path = base.Path + strings.TrimPrefix(u.Path, versionPrefix)
+	u.RawPath = ""
+	return u.String()
+}
+
+// AudioFeaturesResult represents the response body from the Spotify audio features API. Features are nil for track
+// IDs which Spotify does not recognise.
 type AudioFeaturesResult struct {
-	Features []AudioFeatures `json:"audio_features"`
+	Features []*AudioFeatures `json:"audio_features"`
 }
 
 // AudioFeatures represents the audio feature properties of a track.
@@ -271,66 +514,158 @@ type AudioFeatures struct {
 	Tempo            float64 `json:"tempo"`
 	Key              int     `json:"key"`
 	DurationMillis   int     `json:"duration_ms"`
+	// Loudness is the average loudness of the track in decibels, typically between -60 and 0.
+	Loudness float64 `json:"loudness"`
+	// Mode is the modality of the track: 1 is major and 0 is minor. It is -1 if unknown, e.g. for tracks imported from
+	// playlist files without it.
+	Mode int `json:"mode"`
+	// TimeSignature is the estimated number of beats per bar, from 3 to 7, i.e. 3/4 to 7/4.
+	TimeSignature int    `json:"time_signature"`
+	URI           string `json:"uri"`
+	TrackHref     string `json:"track_href"`
+	AnalysisURL   string `json:"analysis_url"`
+}
+
+// audioFeaturesBatchSize is the maximum number of track IDs per audio features request.
+const audioFeaturesBatchSize = 100
+
+// AudioFeaturesError reports the audio features batches which failed. It is returned by GetAudioFeatures alongside
+// the audio features of the batches which succeeded.
+type AudioFeaturesError struct {
+	Batches []BatchError
+	// TotalBatches is the total number of batches requested.
+	TotalBatches int
+}
+
+// BatchError describes a failed batch of audio features.
+type BatchError struct {
+	TrackIDs []string
+	Err      error
+}
+
+// Error returns the error string.
+func (e *AudioFeaturesError) Error() string {
+	return fmt.Sprintf("%d of %d audio features batches failed: %s", len(e.Batches), e.TotalBatches,
+		e.Batches[0].Err)
+}
+
+// Unwrap returns the first batch error.
+func (e *AudioFeaturesError) Unwrap() error {
+	return e.Batches[0].Err
 }
 
-// GetAudioFeatures gets audio properties for a set of tracks.
+// GetAudioFeatures gets audio properties for a set of tracks. Tracks are requested in batches of 100, which are
+// dispatched concurrently. If any batches fail, the audio features of the successful batches are returned along with
+// an *AudioFeaturesError describing the failures. Tracks which Spotify has no audio features for are omitted.
 // https://developer.spotify.com/documentation/web-api/reference/#/operations/get-several-audio-features
-func (r *Requester) GetAudioFeatures(trackIDs []string) ([]AudioFeatures, error) {
-	totalAudioFeatures := AudioFeaturesResult{}
-	for i := 100; ; i += 100 {
-		lower := i - 100
-		if i > len(trackIDs) {
-			i = len(trackIDs)
+func (r *Requester) GetAudioFeatures(ctx context.Context, trackIDs []string) ([]AudioFeatures, error) {
+	var batches [][]string
+	for lower := 0; lower < len(trackIDs); lower += audioFeaturesBatchSize {
+		upper := lower + audioFeaturesBatchSize
+		if upper > len(trackIDs) {
+			upper = len(trackIDs)
 		}
-		ids := trackIDs[lower:i]
-		reqURL := apiURL + "audio-features?ids=" + strings.Join(ids, ",")
+		batches = append(batches, trackIDs[lower:upper])
+	}
 
-		audioFeatures := AudioFeaturesResult{}
-		if err := r.performGetRequest(reqURL, &audioFeatures); err != nil {
-			return nil, fmt.Errorf("audio features request failed: %w", err)
+	results := make([]AudioFeaturesResult, len(batches))
+	batchErrs := make([]error, len(batches))
+	// failed batches are recorded rather than returned, so that they don't cancel the other batches
+	err := runConcurrently(ctx, len(batches), r.conf.Concurrency, func(ctx context.Context, i int) error {
+		reqURL := r.conf.APIURL + "audio-features?ids=" + strings.Join(batches[i], ",")
+		if err := r.performGetRequest(ctx, reqURL, &results[i]); err != nil {
+			batchErrs[i] = fmt.Errorf("audio features request failed: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		if len(totalAudioFeatures.Features) == 0 {
-			totalAudioFeatures = audioFeatures
-		} else {
-			totalAudioFeatures.Features = append(totalAudioFeatures.Features, audioFeatures.Features...)
+	audioFeaturesErr := &AudioFeaturesError{TotalBatches: len(batches)}
+	features := make([]AudioFeatures, 0, len(trackIDs))
+	for i, result := range results {
+		if batchErrs[i] != nil {
+			audioFeaturesErr.Batches = append(audioFeaturesErr.Batches, BatchError{
+				TrackIDs: batches[i],
+				Err:      batchErrs[i],
+			})
+			continue
 		}
-
-		if i == len(trackIDs) {
-			return totalAudioFeatures.Features, nil
+		for _, feature := range result.Features {
+			// Spotify returns null for tracks it has no audio features for
+			if feature == nil {
+				continue
+			}
+			features = append(features, *feature)
 		}
 	}
+
+	if len(audioFeaturesErr.Batches) > 0 {
+		return features, audioFeaturesErr
+	}
+	return features, nil
 }
 
-func (r *Requester) performGetRequest(reqURL string, target any) error {
-	var err error
-	for i := 1; i <= 10; i++ {
+// performGetRequest performs a GET request, retrying according to the Requester's RetryPolicy. Retries are aborted
+// as soon as the context is cancelled.
+func (r *Requester) performGetRequest(ctx context.Context, reqURL string, target any) error {
+	var (
+		err   error
+		start = time.Now()
+	)
+	for i := 1; i <= r.retry.MaxAttempts; i++ {
+		if i > 1 {
+			delay := r.retry.backoff(i - 1)
+			// prefer the delay requested by Spotify if we were rate limited
+			var rateLimitErr *RateLimitError
+			if errors.As(err, &rateLimitErr) && rateLimitErr.RetryAfter > 0 {
+				delay = rateLimitErr.RetryAfter
+			}
+			if r.retry.MaxElapsedTime > 0 && time.Since(start)+delay > r.retry.MaxElapsedTime {
+				r.logger.Error("failed to perform get request within maximum elapsed time", zap.Error(err),
+					zap.String("url", reqURL), zap.Int("attempt", i-1), zap.Duration("next_delay", delay))
+				return err
+			}
+			if err := sleep(ctx, delay); err != nil {
+				return err
+			}
+		}
+
+		if err := r.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
 		var accessToken string
-		accessToken, err = r.access.Get()
+		accessToken, err = r.access.Get(ctx)
 		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
 			r.logger.Error("failed to refresh access token after natural token expiry", zap.Error(err),
 				zap.String("url", reqURL), zap.Int("attempt", i))
 			continue
 		}
 
-		err = r.get(reqURL, accessToken, target)
-		switch err {
-		case nil, ErrNotFound:
-			return err
-		case ErrUnauthorised:
-			if err := r.access.Refresh(); err != nil {
+		err = r.get(ctx, reqURL, accessToken, target)
+		switch {
+		case err == nil:
+			return nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, ErrUnauthorised):
+			if err := r.access.Refresh(ctx); err != nil {
 				r.logger.Error("failed to refresh access token", zap.Error(err),
 					zap.String("url", reqURL), zap.Int("attempt", i))
 			}
-		case ErrRateLimited:
+		case errors.Is(err, ErrRateLimited):
 			r.logger.Error("requests are being rate limited", zap.Error(err),
-				zap.Error(err), zap.String("url", reqURL), zap.Int("attempt", i))
-			// TODO: use API Retry-After header (this will do for now): https://stackoverflow.com/questions/30548073/spotify-web-api-rate-limits
-			time.Sleep(time.Millisecond * 500)
+				zap.String("url", reqURL), zap.Int("attempt", i))
+		case !isRetryable(err):
+			return err
 		default:
 			r.logger.Error("failed to perform get request", zap.Error(err),
-				zap.Error(err), zap.String("url", reqURL), zap.Int("attempt", i))
-			time.Sleep(time.Millisecond * 200)
+				zap.String("url", reqURL), zap.Int("attempt", i))
 		}
 	}
 
@@ -339,8 +674,8 @@ func (r *Requester) performGetRequest(reqURL string, target any) error {
 	return err
 }
 
-func (r *Requester) get(reqURL string, accessToken string, target any) error {
-	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+func (r *Requester) get(ctx context.Context, reqURL string, accessToken string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -351,7 +686,7 @@ func (r *Requester) get(reqURL string, accessToken string, target any) error {
 
 	resp, err := r.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to perform request: %w", err)
+		return &transportError{err: fmt.Errorf("failed to perform request: %w", err)}
 	}
 	defer resp.Body.Close()
 
@@ -363,14 +698,14 @@ func (r *Requester) get(reqURL string, accessToken string, target any) error {
 		// trigger force access token refresh
 		return ErrUnauthorised
 	case http.StatusTooManyRequests:
-		return ErrRateLimited
+		return &RateLimitError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
 	default:
-		return fmt.Errorf("unexpected response status: %s", resp.Status)
+		return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read resp body: %w", err)
+		return &transportError{err: fmt.Errorf("failed to read resp body: %w", err)}
 	}
 
 	if err := json.Unmarshal(body, target); err != nil {
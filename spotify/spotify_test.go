@@ -0,0 +1,341 @@
+package spotify_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jemgunay/spotify-unwrapped/config"
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/spotify/spotifytest"
+)
+
+// testRetryPolicy retries quickly so that injected faults don't slow the tests down.
+var testRetryPolicy = spotify.RetryPolicy{
+	MaxAttempts:     3,
+	InitialInterval: time.Millisecond,
+	MaxInterval:     time.Millisecond * 10,
+	Multiplier:      2,
+}
+
+// newTestPlaylist returns a playlist of the given number of tracks, named "Track 0", "Track 1" and so on.
+func newTestPlaylist(id string, trackCount int) spotify.Playlist {
+	playlist := spotify.Playlist{ID: id, Name: "Playlist " + id}
+	for i := 0; i < trackCount; i++ {
+		playlist.Tracks.TrackItems = append(playlist.Tracks.TrackItems, spotify.TrackItem{
+			TrackDetails: &spotify.TrackDetails{
+				ID:   id + "-" + strconv.Itoa(i),
+				Type: "track",
+				Name: "Track " + strconv.Itoa(i),
+			},
+		})
+	}
+	return playlist
+}
+
+// newTestRequester returns a Requester targeting the fake server.
+func newTestRequester(t *testing.T, srv *spotifytest.Server, edit func(conf *config.Spotify),
+	opts ...spotify.RequesterOpt) *spotify.Requester {
+	t.Helper()
+	conf := srv.Config()
+	conf.Concurrency = 4
+	if edit != nil {
+		edit(&conf)
+	}
+	r := spotify.New(zap.NewNop(), conf, append([]spotify.RequesterOpt{spotify.WithRetryPolicy(testRetryPolicy)},
+		opts...)...)
+	t.Cleanup(r.Close)
+	return r
+}
+
+// assertTrackOrder checks that the items are the first n tracks of a playlist created by newTestPlaylist, in order.
+func assertTrackOrder(t *testing.T, items []spotify.TrackItem, n int) {
+	t.Helper()
+	if len(items) != n {
+		t.Fatalf("got %d tracks, want %d", len(items), n)
+	}
+	for i, item := range items {
+		if want := "Track " + strconv.Itoa(i); item.TrackDetails.Name != want {
+			t.Fatalf("got track %q at position %d, want %q", item.TrackDetails.Name, i, want)
+		}
+	}
+}
+
+func TestGetPlaylistPaging(t *testing.T) {
+	tests := []struct {
+		name      string
+		tracks    int
+		maxTracks int
+		want      int
+		truncated bool
+	}{
+		{name: "single page", tracks: 20, want: 20},
+		{name: "exact pages", tracks: 150, want: 150},
+		{name: "partial last page", tracks: 237, want: 237},
+		{name: "truncated", tracks: 237, maxTracks: 120, want: 120, truncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := spotifytest.NewServer(spotifytest.WithPageSize(50))
+			defer srv.Close()
+			srv.AddPlaylist(newTestPlaylist("p", tt.tracks))
+			r := newTestRequester(t, srv, func(conf *config.Spotify) {
+				conf.MaxPlaylistTracks = tt.maxTracks
+			})
+
+			playlist, err := r.GetPlaylist(context.Background(), "p")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			assertTrackOrder(t, playlist.Tracks.TrackItems, tt.want)
+			if playlist.Tracks.Total != tt.tracks {
+				t.Errorf("got total %d, want %d", playlist.Tracks.Total, tt.tracks)
+			}
+			if truncated := playlist.Tracks.NextURL != ""; truncated != tt.truncated {
+				t.Errorf("got truncated %t, want %t", truncated, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestStreamPlaylistPaging(t *testing.T) {
+	srv := spotifytest.NewServer(spotifytest.WithPageSize(50))
+	defer srv.Close()
+	srv.AddPlaylist(newTestPlaylist("p", 237))
+	r := newTestRequester(t, srv, func(conf *config.Spotify) {
+		conf.Concurrency = 2
+	})
+
+	var (
+		items []spotify.TrackItem
+		pages int
+	)
+	playlist, err := r.StreamPlaylist(context.Background(), "p", func(page spotify.Tracks) error {
+		pages++
+		items = append(items, page.TrackItems...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertTrackOrder(t, items, 237)
+	if pages != 5 {
+		t.Errorf("got %d pages, want 5", pages)
+	}
+	if len(playlist.Tracks.TrackItems) != 0 {
+		t.Errorf("got %d tracks in the returned playlist, want none", len(playlist.Tracks.TrackItems))
+	}
+}
+
+func TestGetPlaylistNotFound(t *testing.T) {
+	srv := spotifytest.NewServer()
+	defer srv.Close()
+	r := newTestRequester(t, srv, nil)
+
+	if _, err := r.GetPlaylist(context.Background(), "missing"); !errors.Is(err, spotify.ErrNotFound) {
+		t.Errorf("got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetPlaylistRateLimited(t *testing.T) {
+	srv := spotifytest.NewServer(spotifytest.WithPageSize(50))
+	defer srv.Close()
+	srv.AddPlaylist(newTestPlaylist("p", 120))
+	srv.InjectFault(spotifytest.Fault{
+		PathPrefix: "/v1/playlists/p/tracks",
+		Times:      1,
+		Status:     http.StatusTooManyRequests,
+		RetryAfter: 1,
+	})
+	r := newTestRequester(t, srv, nil)
+
+	start := time.Now()
+	playlist, err := r.GetPlaylist(context.Background(), "p")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertTrackOrder(t, playlist.Tracks.TrackItems, 120)
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("completed after %s, want at least the Retry-After delay of 1s", elapsed)
+	}
+	// two tracks pages, one of which was retried
+	if got := srv.RequestCount("/v1/playlists/p/tracks"); got != 3 {
+		t.Errorf("got %d tracks page requests, want 3", got)
+	}
+}
+
+func TestGetPlaylistSlowResponse(t *testing.T) {
+	srv := spotifytest.NewServer(spotifytest.WithPageSize(50))
+	defer srv.Close()
+	srv.AddPlaylist(newTestPlaylist("p", 120))
+	srv.InjectFault(spotifytest.Fault{
+		PathPrefix: "/v1/playlists/p/tracks",
+		Times:      1,
+		Delay:      time.Second,
+	})
+	// the slow response times out, so it is retried
+	r := newTestRequester(t, srv, nil, spotify.WithHTTPClient(&http.Client{Timeout: time.Millisecond * 200}))
+
+	playlist, err := r.GetPlaylist(context.Background(), "p")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertTrackOrder(t, playlist.Tracks.TrackItems, 120)
+	if got := srv.RequestCount("/v1/playlists/p/tracks"); got != 3 {
+		t.Errorf("got %d tracks page requests, want 3", got)
+	}
+}
+
+func TestGetPlaylistCancelledDuringSlowResponse(t *testing.T) {
+	srv := spotifytest.NewServer()
+	defer srv.Close()
+	srv.AddPlaylist(newTestPlaylist("p", 10))
+	srv.InjectFault(spotifytest.Fault{PathPrefix: "/v1/playlists/p", Delay: time.Second * 5})
+	r := newTestRequester(t, srv, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start := time.Now()
+	if _, err := r.GetPlaylist(ctx, "p"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %s, want promptly after the context was cancelled", elapsed)
+	}
+}
+
+func TestGetPlaylistMalformedJSON(t *testing.T) {
+	srv := spotifytest.NewServer()
+	defer srv.Close()
+	srv.AddPlaylist(newTestPlaylist("p", 10))
+	srv.InjectFault(spotifytest.Fault{PathPrefix: "/v1/playlists/p", Malformed: true})
+	r := newTestRequester(t, srv, nil)
+
+	if _, err := r.GetPlaylist(context.Background(), "p"); err == nil {
+		t.Fatal("got nil error, want a JSON decode error")
+	}
+	// a malformed body would be malformed again, so it isn't retried
+	if got := srv.RequestCount("/v1/playlists/p"); got != 1 {
+		t.Errorf("got %d playlist requests, want 1", got)
+	}
+}
+
+func TestGetAudioFeatures(t *testing.T) {
+	srv := spotifytest.NewServer()
+	defer srv.Close()
+	playlist := newTestPlaylist("p", 250)
+	ids := make([]string, 0, len(playlist.Tracks.TrackItems))
+	for i, item := range playlist.Tracks.TrackItems {
+		ids = append(ids, item.TrackDetails.ID)
+		// every tenth track has no audio features
+		if i%10 != 0 {
+			srv.AddAudioFeatures(spotify.AudioFeatures{ID: item.TrackDetails.ID, Energy: 0.5})
+		}
+	}
+	r := newTestRequester(t, srv, nil)
+
+	features, err := r.GetAudioFeatures(context.Background(), ids)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(features) != 225 {
+		t.Errorf("got %d audio features, want 225", len(features))
+	}
+	if got := srv.RequestCount("/v1/audio-features"); got != 3 {
+		t.Errorf("got %d audio features requests, want 3 batches", got)
+	}
+}
+
+func TestGetAudioFeaturesPartialFailure(t *testing.T) {
+	srv := spotifytest.NewServer()
+	defer srv.Close()
+	var ids []string
+	for _, item := range newTestPlaylist("p", 250).Tracks.TrackItems {
+		ids = append(ids, item.TrackDetails.ID)
+		srv.AddAudioFeatures(spotify.AudioFeatures{ID: item.TrackDetails.ID})
+	}
+	// one batch fails on every attempt
+	srv.InjectFault(spotifytest.Fault{
+		PathPrefix: "/v1/audio-features",
+		Times:      testRetryPolicy.MaxAttempts,
+		Status:     http.StatusServiceUnavailable,
+	})
+	r := newTestRequester(t, srv, func(conf *config.Spotify) {
+		conf.Concurrency = 1
+	})
+
+	features, err := r.GetAudioFeatures(context.Background(), ids)
+	var audioFeaturesErr *spotify.AudioFeaturesError
+	if !errors.As(err, &audioFeaturesErr) {
+		t.Fatalf("got error %v, want an *AudioFeaturesError", err)
+	}
+	if len(audioFeaturesErr.Batches) != 1 || audioFeaturesErr.TotalBatches != 3 {
+		t.Errorf("got %d of %d batches failed, want 1 of 3", len(audioFeaturesErr.Batches),
+			audioFeaturesErr.TotalBatches)
+	}
+	if len(features) != 150 {
+		t.Errorf("got %d audio features, want 150 from the successful batches", len(features))
+	}
+}
+
+func TestRequesterRefreshesRevokedToken(t *testing.T) {
+	srv := spotifytest.NewServer()
+	defer srv.Close()
+	srv.AddPlaylist(newTestPlaylist("p", 10))
+	r := newTestRequester(t, srv, nil)
+
+	if _, err := r.GetPlaylist(context.Background(), "p"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	srv.RevokeTokens()
+	if _, err := r.GetPlaylist(context.Background(), "p"); err != nil {
+		t.Fatalf("unexpected error after revoking tokens: %s", err)
+	}
+	if got := srv.RequestCount("/api/token"); got != 2 {
+		t.Errorf("got %d token requests, want 2", got)
+	}
+}
+
+func TestGetPlaylistConcurrentPagesKeepOrder(t *testing.T) {
+	const (
+		pageCount = 6
+		delay     = time.Millisecond * 200
+	)
+	srv := spotifytest.NewServer(spotifytest.WithPageSize(50))
+	defer srv.Close()
+	srv.AddPlaylist(newTestPlaylist("p", 50*pageCount))
+	// delay the tracks pages by decreasing amounts in the order they're requested, so that the pages requested first
+	// complete last
+	for i := 0; i < pageCount-1; i++ {
+		srv.InjectFault(spotifytest.Fault{
+			PathPrefix: "/v1/playlists/p/tracks",
+			Times:      1,
+			Delay:      delay - time.Duration(i)*delay/pageCount,
+		})
+	}
+	r := newTestRequester(t, srv, func(conf *config.Spotify) {
+		conf.Concurrency = pageCount
+	})
+
+	start := time.Now()
+	playlist, err := r.GetPlaylist(context.Background(), "p")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	elapsed := time.Since(start)
+	assertTrackOrder(t, playlist.Tracks.TrackItems, 50*pageCount)
+
+	// fetched sequentially, the delayed pages would take the sum of their delays
+	var sequential time.Duration
+	for i := 0; i < pageCount-1; i++ {
+		sequential += delay - time.Duration(i)*delay/pageCount
+	}
+	if elapsed >= sequential/2 {
+		t.Errorf("fetched pages in %s, want well under the %s sequential fetching would take", elapsed, sequential)
+	}
+}
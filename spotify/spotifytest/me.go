@@ -0,0 +1,158 @@
+package spotifytest
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// Maximum page sizes of the user APIs.
+const (
+	maxTopItemsLimit       = 50
+	maxSavedTracksLimit    = 50
+	maxRecentlyPlayedLimit = 50
+)
+
+// SetTopItems sets the user's top tracks and artists for the given time range, most listened to first.
+func (s *Server) SetTopItems(timeRange spotify.TimeRange, tracks []*spotify.TrackDetails, artists []spotify.Artist) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.topTracks[timeRange] = tracks
+	s.topArtists[timeRange] = artists
+}
+
+// topItemsHandler serves the user's top tracks or artists for a time range.
+func (s *Server) topItemsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	timeRange, err := spotify.ParseTimeRange(query.Get("time_range"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(query.Get("limit"), 20)
+	if err != nil || limit < 1 || limit > maxTopItemsLimit {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	itemType := strings.TrimPrefix(r.URL.Path, "/v1/me/top/")
+	baseURL := s.URL + r.URL.Path + "?" + url.Values{"time_range": {string(timeRange)}}.Encode()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch itemType {
+	case "tracks":
+		writeJSON(w, paginate(baseURL, s.topTracks[timeRange], offset, limit))
+	case "artists":
+		writeJSON(w, paginate(baseURL, s.topArtists[timeRange], offset, limit))
+	default:
+		writeError(w, http.StatusNotFound)
+	}
+}
+
+// SetSavedTracks sets the tracks saved to the user's library, most recently saved first.
+func (s *Server) SetSavedTracks(items []spotify.TrackItem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.savedTracks = items
+}
+
+// savedTracksHandler serves the tracks saved to the user's library.
+func (s *Server) savedTracksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	offset, err := queryInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(query.Get("limit"), 20)
+	if err != nil || limit < 1 || limit > maxSavedTracksLimit {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, paginate(s.URL+"/v1/me/tracks", s.savedTracks, offset, limit))
+}
+
+// SetRecentlyPlayed sets the user's recently played tracks.
+func (s *Server) SetRecentlyPlayed(plays []spotify.PlayHistory) {
+	sorted := append([]spotify.PlayHistory(nil), plays...)
+	// most recent first
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].PlayedAt.After(sorted[j].PlayedAt)
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recentlyPlayed = sorted
+}
+
+// recentlyPlayedHandler serves the user's recently played tracks, paginated by a cursor of the unix millisecond
+// timestamp to return plays before.
+func (s *Server) recentlyPlayedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := queryInt(query.Get("limit"), 20)
+	if err != nil || limit < 1 || limit > maxRecentlyPlayedLimit {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+	before, err := queryInt(query.Get("before"), 0)
+	if err != nil || before < 0 {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]spotify.PlayHistory, 0, limit)
+	for _, play := range s.recentlyPlayed {
+		if before > 0 && play.PlayedAt.UnixMilli() >= int64(before) {
+			continue
+		}
+		items = append(items, play)
+		if len(items) == limit {
+			break
+		}
+	}
+
+	var next *string
+	if len(items) > 0 && items[len(items)-1] != s.recentlyPlayed[len(s.recentlyPlayed)-1] {
+		nextURL := s.URL + "/v1/me/player/recently-played?" + url.Values{
+			"limit":  {strconv.Itoa(limit)},
+			"before": {strconv.FormatInt(items[len(items)-1].PlayedAt.UnixMilli(), 10)},
+		}.Encode()
+		next = &nextURL
+	}
+	writeJSON(w, map[string]any{
+		"items": items,
+		"limit": limit,
+		"next":  next,
+	})
+}
@@ -0,0 +1,570 @@
+// Package spotifytest provides a fake Spotify Web API and accounts service for use in tests and offline development.
+package spotifytest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jemgunay/spotify-unwrapped/config"
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+	"github.com/jemgunay/spotify-unwrapped/spotify/auth"
+)
+
+// Credentials accepted by the fake accounts service.
+const (
+	ClientID     = "spotifytest-client-id"
+	ClientSecret = "spotifytest-client-secret"
+)
+
+const (
+	defaultPageSize    = 100
+	maxAudioFeatureIDs = 100
+)
+
+// Server is a fake Spotify Web API and accounts service backed by an httptest.Server. It serves the following:
+//
+//	GET  /authorize
+//	POST /api/token
+//	GET  /v1/playlists/{id}
+//	GET  /v1/playlists/{id}/tracks?offset={offset}&limit={limit}
+//	GET  /v1/audio-features?ids={ids}
+//	GET  /v1/me/top/{tracks|artists}?time_range={range}&offset={offset}&limit={limit}
+//	GET  /v1/me/tracks?offset={offset}&limit={limit}
+//	GET  /v1/me/player/recently-played?before={timestamp}&limit={limit}
+//
+// The accounts service approves every authorisation request on behalf of a single user, whose data is set with
+// SetTopItems, SetSavedTracks and SetRecentlyPlayed. User endpoints can only be accessed with tokens issued to the
+// user.
+//
+// Faults such as error statuses, slow responses and malformed bodies can be injected with InjectFault.
+type Server struct {
+	*httptest.Server
+
+	pageSize      int
+	latency       time.Duration
+	playlists     map[string]spotify.Playlist
+	audioFeatures map[string]spotify.AudioFeatures
+
+	mu          sync.Mutex
+	faults      []*Fault
+	tokens      map[string]struct{}
+	tokenCount  int
+	tokenExpiry time.Duration
+	requests    map[string]int
+	// codes maps issued authorisation codes to the PKCE code challenge and redirect URI they were requested with
+	codes map[string]authCode
+	// refreshTokens and userTokens are the valid refresh and access tokens issued to the user
+	refreshTokens  map[string]struct{}
+	userTokens     map[string]struct{}
+	topTracks      map[spotify.TimeRange][]*spotify.TrackDetails
+	topArtists     map[spotify.TimeRange][]spotify.Artist
+	savedTracks    []spotify.TrackItem
+	recentlyPlayed []spotify.PlayHistory
+}
+
+type authCode struct {
+	challenge   string
+	redirectURI string
+}
+
+// ServerOpt defines a Server option.
+type ServerOpt func(*Server)
+
+// WithPageSize sets the default number of tracks served per playlist tracks page.
+func WithPageSize(size int) ServerOpt {
+	return func(s *Server) {
+		s.pageSize = size
+	}
+}
+
+// WithLatency delays every response by the given duration.
+func WithLatency(latency time.Duration) ServerOpt {
+	return func(s *Server) {
+		s.latency = latency
+	}
+}
+
+// WithTokenExpiry sets the expiry of access tokens issued by the accounts service.
+func WithTokenExpiry(expiry time.Duration) ServerOpt {
+	return func(s *Server) {
+		s.tokenExpiry = expiry
+	}
+}
+
+// NewServer starts and returns a new Server. The caller should call Close when finished with it.
+func NewServer(opts ...ServerOpt) *Server {
+	s := &Server{
+		pageSize:      defaultPageSize,
+		playlists:     make(map[string]spotify.Playlist),
+		audioFeatures: make(map[string]spotify.AudioFeatures),
+		tokens:        make(map[string]struct{}),
+		tokenExpiry:   time.Hour,
+		requests:      make(map[string]int),
+		codes:         make(map[string]authCode),
+		refreshTokens: make(map[string]struct{}),
+		userTokens:    make(map[string]struct{}),
+		topTracks:     make(map[spotify.TimeRange][]*spotify.TrackDetails),
+		topArtists:    make(map[spotify.TimeRange][]spotify.Artist),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authorize", s.authorizeHandler)
+	mux.HandleFunc("/api/token", s.tokenHandler)
+	mux.HandleFunc("/v1/playlists/", s.requireToken(s.playlistsHandler))
+	mux.HandleFunc("/v1/audio-features", s.requireToken(s.audioFeaturesHandler))
+	mux.HandleFunc("/v1/me/top/", s.requireUserToken(s.topItemsHandler))
+	mux.HandleFunc("/v1/me/tracks", s.requireUserToken(s.savedTracksHandler))
+	mux.HandleFunc("/v1/me/player/recently-played", s.requireUserToken(s.recentlyPlayedHandler))
+	s.Server = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+// Config returns a Spotify config which targets the Server.
+func (s *Server) Config() config.Spotify {
+	return config.Spotify{
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		APIURL:       s.URL + "/v1/",
+		AccountsURL:  s.URL + "/",
+	}
+}
+
+// AddPlaylist adds or replaces a playlist. All of the playlist's track items are served across paginated responses.
+func (s *Server) AddPlaylist(playlist spotify.Playlist) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.playlists[playlist.ID] = playlist
+}
+
+// AddAudioFeatures adds or replaces audio features, keyed by their track ID.
+func (s *Server) AddAudioFeatures(features ...spotify.AudioFeatures) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, feature := range features {
+		s.audioFeatures[feature.ID] = feature
+	}
+}
+
+// RevokeTokens invalidates all previously issued access tokens, causing subsequent API requests using them to fail
+// with 401 Unauthorized.
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = make(map[string]struct{})
+	s.userTokens = make(map[string]struct{})
+}
+
+// RequestCount returns the number of requests received for the given path, e.g. "/api/token".
+func (s *Server) RequestCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// Fault describes a failure to inject into responses.
+type Fault struct {
+	// PathPrefix restricts the fault to requests with a matching URL path. Empty matches every request.
+	PathPrefix string
+	// Times is the number of requests the fault applies to. Zero applies it to every matching request.
+	Times int
+	// Status is the status code to respond with, e.g. 404, 429 or 503. Zero serves the normal response status.
+	Status int
+	// RetryAfter sets the Retry-After header in seconds.
+	RetryAfter int
+	// Delay delays the response.
+	Delay time.Duration
+	// Malformed serves a truncated JSON body.
+	Malformed bool
+}
+
+// InjectFault registers a fault. Faults are matched in the order they were injected.
+func (s *Server) InjectFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults removes all injected faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// matchFault finds the first fault matching the given path and consumes one of its uses.
+func (s *Server) matchFault(path string) (Fault, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, fault := range s.faults {
+		if !strings.HasPrefix(path, fault.PathPrefix) {
+			continue
+		}
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return *fault, true
+	}
+	return Fault{}, false
+}
+
+// malformedWriter truncates the response body to produce invalid JSON.
+type malformedWriter struct {
+	http.ResponseWriter
+}
+
+func (w malformedWriter) Write(b []byte) (int, error) {
+	if _, err := w.ResponseWriter.Write(b[:len(b)/2]); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// middleware counts requests and applies latency and injected faults.
+func (s *Server) middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		s.mu.Unlock()
+
+		fault, ok := s.matchFault(r.URL.Path)
+		if !sleep(r, s.latency+fault.Delay) {
+			return
+		}
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(fault.RetryAfter))
+		}
+		if fault.Status != 0 {
+			writeError(w, fault.Status)
+			return
+		}
+		if fault.Malformed {
+			w = malformedWriter{ResponseWriter: w}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// sleep pauses for the given duration, returning false if the request was cancelled in the meantime.
+func sleep(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-r.Context().Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// authorizeHandler immediately approves the authorisation request on behalf of the user, redirecting back to the
+// redirect URI with an authorisation code.
+func (s *Server) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("client_id") != ClientID || query.Get("response_type") != "code" ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.tokenCount++
+	code := "spotifytest-code-" + strconv.Itoa(s.tokenCount)
+	s.codes[code] = authCode{
+		challenge:   query.Get("code_challenge"),
+		redirectURI: redirectURI.String(),
+	}
+	s.mu.Unlock()
+
+	redirectQuery := redirectURI.Query()
+	redirectQuery.Set("code", code)
+	redirectQuery.Set("state", query.Get("state"))
+	redirectURI.RawQuery = redirectQuery.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// tokenHandler implements the client credentials, authorization code and refresh token grants.
+func (s *Server) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "client_credentials":
+		wantAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte(ClientID+":"+ClientSecret))
+		if r.Header.Get("Authorization") != wantAuth {
+			writeError(w, http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, s.issueToken(false))
+
+	case "authorization_code":
+		if r.PostForm.Get("client_id") != ClientID {
+			writeError(w, http.StatusUnauthorized)
+			return
+		}
+		s.mu.Lock()
+		code, ok := s.codes[r.PostForm.Get("code")]
+		// codes are single use
+		delete(s.codes, r.PostForm.Get("code"))
+		s.mu.Unlock()
+		if !ok || code.redirectURI != r.PostForm.Get("redirect_uri") ||
+			code.challenge != auth.CodeChallenge(r.PostForm.Get("code_verifier")) {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, s.issueToken(true))
+
+	case "refresh_token":
+		if r.PostForm.Get("client_id") != ClientID {
+			writeError(w, http.StatusUnauthorized)
+			return
+		}
+		s.mu.Lock()
+		_, ok := s.refreshTokens[r.PostForm.Get("refresh_token")]
+		// refresh tokens are rotated on every use
+		delete(s.refreshTokens, r.PostForm.Get("refresh_token"))
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, s.issueToken(true))
+
+	default:
+		writeError(w, http.StatusBadRequest)
+	}
+}
+
+// issueToken issues a new access token, returning the token response body. User tokens are issued with a refresh
+// token.
+func (s *Server) issueToken(user bool) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokenCount++
+	token := "spotifytest-token-" + strconv.Itoa(s.tokenCount)
+	s.tokens[token] = struct{}{}
+	body := map[string]any{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(s.tokenExpiry.Seconds()),
+	}
+	if user {
+		s.userTokens[token] = struct{}{}
+		refreshToken := "spotifytest-refresh-" + strconv.Itoa(s.tokenCount)
+		s.refreshTokens[refreshToken] = struct{}{}
+		body["refresh_token"] = refreshToken
+	}
+	return body
+}
+
+// requireToken rejects requests which do not provide a valid bearer token.
+func (s *Server) requireToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		_, ok := s.tokens[token]
+		s.mu.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// requireUserToken rejects requests which do not provide a valid bearer token issued to the user.
+func (s *Server) requireUserToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		_, ok := s.userTokens[token]
+		s.mu.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// page is a paginated set of items, e.g. playlist tracks, in the format of the Spotify API's paging object.
+type page[T any] struct {
+	Href   string  `json:"href"`
+	Items  []T     `json:"items"`
+	Limit  int     `json:"limit"`
+	Next   *string `json:"next"`
+	Offset int     `json:"offset"`
+	Total  int     `json:"total"`
+}
+
+type tracksPage = page[spotify.TrackItem]
+
+// playlistResponse is a playlist with its first page of tracks.
+type playlistResponse struct {
+	spotify.Playlist
+	Tracks tracksPage `json:"tracks"`
+}
+
+// playlistsHandler serves playlists and their paginated tracks.
+func (s *Server) playlistsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/playlists/"), "/")
+	s.mu.Lock()
+	playlist, ok := s.playlists[parts[0]]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		writeJSON(w, playlistResponse{
+			Playlist: playlist,
+			Tracks:   s.tracksPage(playlist, 0, s.pageSize),
+		})
+
+	case len(parts) == 2 && parts[1] == "tracks":
+		query := r.URL.Query()
+		offset, err := queryInt(query.Get("offset"), 0)
+		if err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		limit, err := queryInt(query.Get("limit"), s.pageSize)
+		if err != nil || limit < 1 || limit > defaultPageSize {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, s.tracksPage(playlist, offset, limit))
+
+	default:
+		writeError(w, http.StatusNotFound)
+	}
+}
+
+// tracksPage slices a page of tracks from the given playlist.
+func (s *Server) tracksPage(playlist spotify.Playlist, offset, limit int) tracksPage {
+	return paginate(s.URL+"/v1/playlists/"+playlist.ID+"/tracks", playlist.Tracks.TrackItems, offset, limit)
+}
+
+// paginate slices a page of items, linking to the next page if there are further items. The base URL may include a
+// query, which is preserved in page URLs.
+func paginate[T any](baseURL string, items []T, offset, limit int) page[T] {
+	sep := "?"
+	if strings.Contains(baseURL, "?") {
+		sep = "&"
+	}
+	pageURL := func(offset int) string {
+		return baseURL + sep + "offset=" + strconv.Itoa(offset) + "&limit=" + strconv.Itoa(limit)
+	}
+
+	p := page[T]{
+		Href:   pageURL(offset),
+		Items:  []T{},
+		Limit:  limit,
+		Offset: offset,
+		Total:  len(items),
+	}
+	if offset < len(items) {
+		end := offset + limit
+		if end > len(items) {
+			end = len(items)
+		}
+		p.Items = items[offset:end]
+		if end < len(items) {
+			next := pageURL(end)
+			p.Next = &next
+		}
+	}
+	return p
+}
+
+// audioFeaturesHandler serves audio features for up to 100 track IDs. Unknown IDs are represented by null, as per the
+// Spotify API.
+func (s *Server) audioFeaturesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	ids := strings.Split(r.URL.Query().Get("ids"), ",")
+	if len(ids) > maxAudioFeatureIDs {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	features := make([]*spotify.AudioFeatures, 0, len(ids))
+	s.mu.Lock()
+	for _, id := range ids {
+		feature, ok := s.audioFeatures[id]
+		if !ok {
+			features = append(features, nil)
+			continue
+		}
+		features = append(features, &feature)
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]any{"audio_features": features})
+}
+
+func queryInt(val string, defaultValue int) (int, error) {
+	if val == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(val)
+}
+
+func writeJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes an error in the format of the Spotify API.
+func writeError(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"status":  status,
+			"message": http.StatusText(status),
+		},
+	})
+}
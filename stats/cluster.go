@@ -0,0 +1,411 @@
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+const (
+	// defaultMaxClusters is the largest number of clusters considered when the number of clusters is chosen
+	// automatically.
+	defaultMaxClusters = 8
+	// kmeansRestarts is the number of times k-means is run for each number of clusters, keeping the tightest result,
+	// as a poor choice of initial centroids can produce a poor clustering.
+	kmeansRestarts = 5
+	// kmeansMaxIterations bounds the number of k-means iterations, which almost always converge much sooner.
+	kmeansMaxIterations = 100
+	// silhouetteSampleSize is the maximum number of tracks whose silhouettes are calculated when choosing the number of
+	// clusters, as each silhouette requires the distance to every other track.
+	silhouetteSampleSize = 1000
+	// descriptionFeatureCount is the maximum number of distinguishing variables in a cluster's description.
+	descriptionFeatureCount = 3
+	// minDistinguishingScore is the minimum number of standard deviations that a cluster's centroid must be from the
+	// mean of a variable for it to be distinguished by that variable.
+	minDistinguishingScore = 0.5
+)
+
+// clusterCalc defines how Cluster clusters tracks.
+type clusterCalc struct {
+	seed        int64
+	k           int
+	maxClusters int
+}
+
+// ClusterOpt defines a Cluster option.
+type ClusterOpt func(*clusterCalc)
+
+// WithSeed sets the seed used to choose the initial centroids. The same tracks clustered with the same seed always
+// produce the same clusters. The seed is 1 by default.
+func WithSeed(seed int64) ClusterOpt {
+	return func(c *clusterCalc) {
+		c.seed = seed
+	}
+}
+
+// WithClusterCount sets the number of clusters rather than choosing it automatically. It is reduced if there are
+// fewer distinct tracks.
+func WithClusterCount(k int) ClusterOpt {
+	return func(c *clusterCalc) {
+		c.k = k
+	}
+}
+
+// WithMaxClusters sets the largest number of clusters considered when the number of clusters is chosen
+// automatically, which is 8 by default.
+func WithMaxClusters(k int) ClusterOpt {
+	return func(c *clusterCalc) {
+		c.maxClusters = k
+	}
+}
+
+// Clusters are groups of similar tracks.
+type Clusters struct {
+	Variables []string `json:"variables"`
+	// Silhouette is the mean silhouette coefficient of the clustering, from -1 to 1, where higher values indicate more
+	// distinct clusters. It is null if there is only one cluster.
+	Silhouette Coefficient `json:"silhouette"`
+	// Unclustered is the number of tracks which weren't clustered as they had unknown values.
+	Unclustered int `json:"unclustered"`
+	// Clusters are ordered from largest to smallest.
+	Clusters []Cluster `json:"clusters"`
+}
+
+// Cluster is a group of similar tracks.
+type Cluster struct {
+	// Centroid is the mean value of each variable over the cluster's tracks, in the same order as the variables and to
+	// 1 decimal place.
+	Centroid []float64 `json:"centroid"`
+	// Description lists the variables which most distinguish the cluster from the rest of the tracks, e.g. "high
+	// energy, low acousticness".
+	Description string         `json:"description"`
+	Size        int            `json:"size"`
+	Tracks      []ClusterTrack `json:"tracks"`
+}
+
+// ClusterTrack is a member track of a Cluster.
+type ClusterTrack struct {
+	Name       string `json:"name"`
+	CoverImage string `json:"cover_image,omitempty"`
+	SpotifyURL string `json:"spotify_url,omitempty"`
+}
+
+// Cluster groups the tracks into clusters of similar tracks using k-means, where each variable is standardised so
+// that they contribute equally. Tracks with any unknown values are excluded. Unless set by WithClusterCount, the
+// number of clusters is that with the highest mean silhouette coefficient. Each cluster's tracks are ordered from the
+// closest to its centroid.
+func (v *Vectors) Cluster(lookup map[string]spotify.TrackDetails, opts ...ClusterOpt) Clusters {
+	c := clusterCalc{seed: 1, maxClusters: defaultMaxClusters}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	ids, points := v.completeRows()
+	clusters := Clusters{
+		Variables:   v.names,
+		Silhouette:  Coefficient(math.NaN()),
+		Unclustered: len(v.rows) - len(points),
+		Clusters:    []Cluster{},
+	}
+	if len(points) == 0 {
+		return clusters
+	}
+	means, stdDevs := standardise(points)
+
+	// the seeded source makes the clustering deterministic
+	rng := rand.New(rand.NewSource(c.seed))
+	var assignments []int
+	switch {
+	case c.k > 0:
+		assignments = kmeans(rng, points, c.k)
+		clusters.Silhouette = Coefficient(silhouette(rng, points, assignments))
+	default:
+		// silhouettes are undefined for a single cluster, so it is only used if no other clustering is defined
+		assignments = make([]int, len(points))
+		for k := 2; k <= c.maxClusters && k < len(points); k++ {
+			candidate := kmeans(rng, points, k)
+			score := Coefficient(silhouette(rng, points, candidate))
+			if score > clusters.Silhouette || math.IsNaN(float64(clusters.Silhouette)) && !math.IsNaN(float64(score)) {
+				assignments, clusters.Silhouette = candidate, score
+			}
+		}
+	}
+
+	members := make([][]int, len(points))
+	for i, cluster := range assignments {
+		members[cluster] = append(members[cluster], i)
+	}
+	for _, rows := range members {
+		if len(rows) == 0 {
+			continue
+		}
+		clusters.Clusters = append(clusters.Clusters, newCluster(lookup, ids, points, rows, means, stdDevs, v.names))
+	}
+	sort.SliceStable(clusters.Clusters, func(i, j int) bool {
+		return clusters.Clusters[i].Size > clusters.Clusters[j].Size
+	})
+	return clusters
+}
+
+// completeRows returns copies of the rows with no unknown values, and their IDs.
+func (v *Vectors) completeRows() ([]string, [][]float64) {
+	ids := make([]string, 0, len(v.rows))
+	points := make([][]float64, 0, len(v.rows))
+rows:
+	for r, row := range v.rows {
+		for _, val := range row {
+			if math.IsNaN(val) {
+				continue rows
+			}
+		}
+		point := make([]float64, len(row))
+		copy(point, row)
+		ids, points = append(ids, v.ids[r]), append(points, point)
+	}
+	return ids, points
+}
+
+// standardise converts each variable of the points into the number of standard deviations from its mean in place,
+// returning the original means and standard deviations. Variables with no variance are zeroed.
+func standardise(points [][]float64) ([]float64, []float64) {
+	dims := len(points[0])
+	means, stdDevs := make([]float64, dims), make([]float64, dims)
+	for d := 0; d < dims; d++ {
+		for _, point := range points {
+			means[d] += point[d]
+		}
+		means[d] /= float64(len(points))
+		for _, point := range points {
+			stdDevs[d] += (point[d] - means[d]) * (point[d] - means[d])
+		}
+		stdDevs[d] = math.Sqrt(stdDevs[d] / float64(len(points)))
+
+		for _, point := range points {
+			point[d] -= means[d]
+			if stdDevs[d] > 0 {
+				point[d] /= stdDevs[d]
+			}
+		}
+	}
+	return means, stdDevs
+}
+
+// kmeans clusters the points into at most k clusters, returning the cluster index of each point. It keeps the
+// tightest of several runs, each initialised using k-means++.
+func kmeans(rng *rand.Rand, points [][]float64, k int) []int {
+	var best []int
+	bestInertia := math.Inf(1)
+	for run := 0; run < kmeansRestarts; run++ {
+		assignments, inertia := kmeansRun(rng, points, k)
+		if inertia < bestInertia {
+			best, bestInertia = assignments, inertia
+		}
+	}
+	return best
+}
+
+// kmeansRun runs k-means once, returning the cluster index of each point and the sum of squared distances from each
+// point to its centroid.
+func kmeansRun(rng *rand.Rand, points [][]float64, k int) ([]int, float64) {
+	centroids := initCentroids(rng, points, k)
+	assignments := make([]int, len(points))
+	var inertia float64
+	for iteration := 0; iteration < kmeansMaxIterations; iteration++ {
+		changed := false
+		inertia = 0
+		for i, point := range points {
+			nearest, distance := nearestCentroid(centroids, point)
+			if nearest != assignments[i] || iteration == 0 {
+				assignments[i] = nearest
+				changed = true
+			}
+			inertia += distance
+		}
+		if !changed {
+			break
+		}
+
+		// move each centroid to the mean of its points, leaving any without points where they are
+		sums := make([][]float64, len(centroids))
+		counts := make([]int, len(centroids))
+		for i, point := range points {
+			cluster := assignments[i]
+			if sums[cluster] == nil {
+				sums[cluster] = make([]float64, len(point))
+			}
+			for d, val := range point {
+				sums[cluster][d] += val
+			}
+			counts[cluster]++
+		}
+		for cluster, sum := range sums {
+			if counts[cluster] == 0 {
+				continue
+			}
+			for d := range sum {
+				sum[d] /= float64(counts[cluster])
+			}
+			centroids[cluster] = sum
+		}
+	}
+	return assignments, inertia
+}
+
+// initCentroids chooses up to k initial centroids using k-means++, where each centroid is chosen from the points with a
+// probability proportional to its squared distance from the nearest centroid already chosen. Fewer centroids are
+// chosen if there are fewer than k distinct points.
+func initCentroids(rng *rand.Rand, points [][]float64, k int) [][]float64 {
+	centroids := make([][]float64, 0, k)
+	centroids = append(centroids, points[rng.Intn(len(points))])
+	distances := make([]float64, len(points))
+	for len(centroids) < k {
+		var total float64
+		for i, point := range points {
+			_, distances[i] = nearestCentroid(centroids, point)
+			total += distances[i]
+		}
+		if total == 0 {
+			// every point is a centroid already
+			break
+		}
+
+		target := rng.Float64() * total
+		chosen := len(points) - 1
+		for i, distance := range distances {
+			if target -= distance; target < 0 {
+				chosen = i
+				break
+			}
+		}
+		centroids = append(centroids, points[chosen])
+	}
+	return centroids
+}
+
+// nearestCentroid returns the index of the centroid nearest to the point and the squared distance to it.
+func nearestCentroid(centroids [][]float64, point []float64) (int, float64) {
+	nearest, nearestDistance := 0, math.Inf(1)
+	for i, centroid := range centroids {
+		if distance := squaredDistance(centroid, point); distance < nearestDistance {
+			nearest, nearestDistance = i, distance
+		}
+	}
+	return nearest, nearestDistance
+}
+
+func squaredDistance(a, b []float64) float64 {
+	var sum float64
+	for d := range a {
+		sum += (a[d] - b[d]) * (a[d] - b[d])
+	}
+	return sum
+}
+
+// silhouette calculates the mean silhouette coefficient of the clustering, i.e. how much closer each point is to the
+// other points of its cluster than to those of the nearest other cluster. For large sets of points it is estimated
+// from a random sample. It is NaN if there are fewer than 2 clusters.
+func silhouette(rng *rand.Rand, points [][]float64, assignments []int) float64 {
+	sizes := make(map[int]int)
+	for _, cluster := range assignments {
+		sizes[cluster]++
+	}
+	if len(sizes) < 2 {
+		return math.NaN()
+	}
+
+	sample := rng.Perm(len(points))
+	if len(sample) > silhouetteSampleSize {
+		sample = sample[:silhouetteSampleSize]
+	}
+	var sum float64
+	for _, i := range sample {
+		own := assignments[i]
+		if sizes[own] == 1 {
+			// the silhouette of a point in a cluster of its own is 0
+			continue
+		}
+		totals := make(map[int]float64, len(sizes))
+		for j, point := range points {
+			if j != i {
+				totals[assignments[j]] += math.Sqrt(squaredDistance(points[i], point))
+			}
+		}
+
+		a, b := totals[own]/float64(sizes[own]-1), math.Inf(1)
+		for cluster, total := range totals {
+			if cluster != own && total/float64(sizes[cluster]) < b {
+				b = total / float64(sizes[cluster])
+			}
+		}
+		if a != 0 || b != 0 {
+			sum += (b - a) / math.Max(a, b)
+		}
+	}
+	return sum / float64(len(sample))
+}
+
+// newCluster describes the cluster of the given rows of the standardised points.
+func newCluster(lookup map[string]spotify.TrackDetails, ids []string, points [][]float64, rows []int, means,
+	stdDevs []float64, names []string) Cluster {
+	// the mean of the standardised points is the number of standard deviations of the centroid from each mean
+	scores := make([]float64, len(names))
+	for _, row := range rows {
+		for d, val := range points[row] {
+			scores[d] += val / float64(len(rows))
+		}
+	}
+
+	cluster := Cluster{
+		Centroid:    make([]float64, len(names)),
+		Description: describeCluster(names, scores),
+		Size:        len(rows),
+		Tracks:      make([]ClusterTrack, 0, len(rows)),
+	}
+	for d, score := range scores {
+		cluster.Centroid[d] = math.Round((means[d]+score*stdDevs[d])*10) / 10
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return squaredDistance(points[rows[i]], scores) < squaredDistance(points[rows[j]], scores)
+	})
+	for _, row := range rows {
+		track := lookup[ids[row]]
+		cluster.Tracks = append(cluster.Tracks, ClusterTrack{
+			Name:       track.GetTrackString(),
+			CoverImage: track.Album.Images.First(),
+			SpotifyURL: track.ExternalURLs.Spotify,
+		})
+	}
+	return cluster
+}
+
+// describeCluster lists the variables whose scores, i.e. the number of standard deviations of the cluster's centroid
+// from their means, are the furthest from 0.
+func describeCluster(names []string, scores []float64) string {
+	order := make([]int, len(names))
+	for d := range order {
+		order[d] = d
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return math.Abs(scores[order[a]]) > math.Abs(scores[order[b]])
+	})
+
+	features := make([]string, 0, descriptionFeatureCount)
+	for _, d := range order {
+		if len(features) == descriptionFeatureCount || math.Abs(scores[d]) < minDistinguishingScore {
+			break
+		}
+		level := "high"
+		if scores[d] < 0 {
+			level = "low"
+		}
+		features = append(features, level+" "+strings.ReplaceAll(names[d], "_", " "))
+	}
+	if len(features) == 0 {
+		return "typical of the playlist"
+	}
+	return strings.Join(features, ", ")
+}
@@ -0,0 +1,139 @@
+package stats
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// blobCentres are the energy, acousticness and tempo of three well separated groups of tracks.
+var blobCentres = [][]float64{
+	{90, 10, 170},
+	{20, 80, 80},
+	{50, 40, 125},
+}
+
+// newBlobs returns vectors of tracks normally distributed around each of the blob centres, where each track's artist
+// is the blob it belongs to.
+func newBlobs(perBlob int, spread float64) (*Vectors, map[string]spotify.TrackDetails) {
+	rng := rand.New(rand.NewSource(42))
+	vectors := NewVectors("energy", "acousticness", "tempo")
+	lookup := make(map[string]spotify.TrackDetails)
+	for b, centre := range blobCentres {
+		for i := 0; i < perBlob; i++ {
+			id := strconv.Itoa(b) + "-" + strconv.Itoa(i)
+			lookup[id] = spotify.TrackDetails{
+				ID:      id,
+				Name:    "Track " + id,
+				Artists: []spotify.Artist{{Name: "Blob " + strconv.Itoa(b)}},
+			}
+			values := make([]float64, len(centre))
+			for d, c := range centre {
+				values[d] = c + rng.NormFloat64()*spread
+			}
+			vectors.Push(id, values...)
+		}
+	}
+	return vectors, lookup
+}
+
+// clusterBlobs returns the blob of each track in each cluster.
+func clusterBlobs(clusters Clusters) [][]string {
+	blobs := make([][]string, 0, len(clusters.Clusters))
+	for _, cluster := range clusters.Clusters {
+		members := make([]string, 0, len(cluster.Tracks))
+		for _, track := range cluster.Tracks {
+			blob, _, _ := strings.Cut(track.Name, " - ")
+			members = append(members, blob)
+		}
+		blobs = append(blobs, members)
+	}
+	return blobs
+}
+
+func TestClusterIsDeterministicForSeed(t *testing.T) {
+	// overlapping blobs, so that the clustering depends on the initial centroids
+	vectors, lookup := newBlobs(40, 25)
+
+	first := vectors.Cluster(lookup, WithSeed(7))
+	for i := 0; i < 5; i++ {
+		if again := vectors.Cluster(lookup, WithSeed(7)); !reflect.DeepEqual(first, again) {
+			t.Fatalf("clustering %d with the same seed differs from the first", i+2)
+		}
+	}
+}
+
+func TestClusterRecoversSeparatedBlobs(t *testing.T) {
+	vectors, lookup := newBlobs(30, 3)
+
+	clusters := vectors.Cluster(lookup, WithClusterCount(3))
+	if len(clusters.Clusters) != 3 {
+		t.Fatalf("got %d clusters, want 3", len(clusters.Clusters))
+	}
+	seen := make(map[string]bool)
+	for i, members := range clusterBlobs(clusters) {
+		if len(members) != 30 {
+			t.Errorf("cluster %d has %d tracks, want 30", i, len(members))
+		}
+		for _, blob := range members {
+			if blob != members[0] {
+				t.Errorf("cluster %d mixes tracks of %s and %s", i, members[0], blob)
+				break
+			}
+		}
+		if seen[members[0]] {
+			t.Errorf("%s is split across clusters", members[0])
+		}
+		seen[members[0]] = true
+	}
+
+	// the first blob is the most energetic and least acoustic
+	for _, cluster := range clusters.Clusters {
+		if blob, _, _ := strings.Cut(cluster.Tracks[0].Name, " - "); blob == "Blob 0" &&
+			!strings.Contains(cluster.Description, "high energy") {
+			t.Errorf("got description %q for the most energetic blob, want it to include high energy",
+				cluster.Description)
+		}
+	}
+}
+
+func TestClusterChoosesClusterCountBySilhouette(t *testing.T) {
+	vectors, lookup := newBlobs(30, 3)
+
+	clusters := vectors.Cluster(lookup)
+	if got := len(clusters.Clusters); got != 3 {
+		t.Errorf("got %d clusters, want the 3 blobs", got)
+	}
+	if clusters.Silhouette < 0.7 {
+		t.Errorf("got silhouette %v, want well separated clusters", clusters.Silhouette)
+	}
+
+	// forcing another number of clusters gives a worse silhouette
+	for _, k := range []int{2, 4} {
+		if other := vectors.Cluster(lookup, WithClusterCount(k)); other.Silhouette >= clusters.Silhouette {
+			t.Errorf("got silhouette %v for %d clusters, want less than %v for 3", other.Silhouette, k,
+				clusters.Silhouette)
+		}
+	}
+}
+
+func TestClusterExcludesUnknownValues(t *testing.T) {
+	vectors, lookup := newBlobs(10, 3)
+	vectors.Push("unknown", 50)
+
+	clusters := vectors.Cluster(lookup)
+	if clusters.Unclustered != 1 {
+		t.Errorf("got %d unclustered tracks, want 1", clusters.Unclustered)
+	}
+	size := 0
+	for _, cluster := range clusters.Clusters {
+		size += cluster.Size
+	}
+	if size != 30 {
+		t.Errorf("got %d clustered tracks, want 30", size)
+	}
+}
@@ -0,0 +1,282 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+const (
+	// strongestPairCount is the number of strongest positive and negative pairs reported.
+	strongestPairCount = 3
+	// minPairStrength is the minimum absolute Spearman coefficient for a pair to be reported as strongly correlated.
+	minPairStrength = 0.3
+	// pairExampleCount is the number of example tracks reported for each strongly correlated pair.
+	pairExampleCount = 3
+)
+
+// Vectors retains a vector of values for each track, one per variable, so that the relationships between variables
+// can be analysed. Unlike Group, every value is retained unless the Vectors are sampled.
+type Vectors struct {
+	names  []string
+	ids    []string
+	rows   [][]float64
+	count  int
+	sample reservoir
+}
+
+// NewVectors returns Vectors for the given variable names.
+func NewVectors(names ...string) *Vectors {
+	return &Vectors{names: names}
+}
+
+// NewSampledVectors returns Vectors for the given variable names which retain a uniform random sample of at most size
+// tracks, so that their memory usage doesn't grow with the number of tracks pushed. The analysis is then an estimate
+// from the sample. A size of 0 retains every track.
+func NewSampledVectors(size int, names ...string) *Vectors {
+	return &Vectors{names: names, sample: reservoir{size: size}}
+}
+
+// Push pushes a track's values, in the same order as the variable names. Use math.NaN for unknown values, which are
+// excluded from the analysis of that variable. Missing values are unknown and extra values are ignored.
+func (v *Vectors) Push(id string, values ...float64) {
+	row := make([]float64, len(v.names))
+	for i := range row {
+		row[i] = math.NaN()
+	}
+	copy(row, values)
+
+	v.count++
+	switch i := v.sample.slot(v.count); {
+	case i == len(v.rows):
+		v.ids = append(v.ids, id)
+		v.rows = append(v.rows, row)
+	case i >= 0:
+		v.ids[i], v.rows[i] = id, row
+	}
+}
+
+// CollectIDs adds the IDs of the retained tracks, which may be looked up as examples, to ids.
+func (v *Vectors) CollectIDs(ids map[string]struct{}) {
+	for _, id := range v.ids {
+		ids[id] = struct{}{}
+	}
+}
+
+// Coefficient is a correlation coefficient from -1 to 1. It is encoded as null if undefined, i.e. if either variable
+// has no variance.
+type Coefficient float64
+
+// MarshalJSON encodes the coefficient to 2 decimal places, or as null if undefined.
+func (c Coefficient) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(c)) {
+		return []byte("null"), nil
+	}
+	return []byte(strconv.FormatFloat(math.Round(float64(c)*100)/100, 'f', -1, 64)), nil
+}
+
+// Correlations are the correlation matrices of a set of variables. Row and column i of each matrix correspond to
+// Variables[i].
+type Correlations struct {
+	Variables []string        `json:"variables"`
+	Pearson   [][]Coefficient `json:"pearson"`
+	Spearman  [][]Coefficient `json:"spearman"`
+	// StrongestPositive and StrongestNegative are the most strongly correlated pairs of variables by Spearman
+	// coefficient, strongest first.
+	StrongestPositive []CorrelatedPair `json:"strongest_positive"`
+	StrongestNegative []CorrelatedPair `json:"strongest_negative"`
+}
+
+// CorrelatedPair is a pair of correlated variables.
+type CorrelatedPair struct {
+	A        string      `json:"a"`
+	B        string      `json:"b"`
+	Pearson  Coefficient `json:"pearson"`
+	Spearman Coefficient `json:"spearman"`
+	// Summary describes the correlation, e.g. "tracks with a higher release year tend to have lower acousticness".
+	Summary string `json:"summary"`
+	// Examples are the tracks which best exemplify the correlation.
+	Examples []PairExample `json:"examples"`
+}
+
+// PairExample is a track exemplifying a correlation, along with its values of the pair of variables to 1 decimal
+// place.
+type PairExample struct {
+	Name       string  `json:"name"`
+	CoverImage string  `json:"cover_image,omitempty"`
+	SpotifyURL string  `json:"spotify_url,omitempty"`
+	A          float64 `json:"a"`
+	B          float64 `json:"b"`
+}
+
+// Correlate calculates the Pearson and Spearman correlation matrices of the variables. Each pair of variables is
+// correlated using the tracks with known values of both.
+func (v *Vectors) Correlate(lookup map[string]spotify.TrackDetails) Correlations {
+	n := len(v.names)
+	c := Correlations{
+		Variables:         v.names,
+		Pearson:           make([][]Coefficient, n),
+		Spearman:          make([][]Coefficient, n),
+		StrongestPositive: []CorrelatedPair{},
+		StrongestNegative: []CorrelatedPair{},
+	}
+	for i := range v.names {
+		c.Pearson[i] = make([]Coefficient, n)
+		c.Spearman[i] = make([]Coefficient, n)
+	}
+
+	var pairs []CorrelatedPair
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			xs, ys, rows := v.pairwise(i, j)
+			p, s := Coefficient(pearson(xs, ys)), Coefficient(pearson(ranks(xs), ranks(ys)))
+			c.Pearson[i][j], c.Pearson[j][i] = p, p
+			c.Spearman[i][j], c.Spearman[j][i] = s, s
+			if i == j || math.IsNaN(float64(s)) || math.Abs(float64(s)) < minPairStrength {
+				continue
+			}
+			pair := CorrelatedPair{A: v.names[i], B: v.names[j], Pearson: p, Spearman: s}
+			pair.Summary = summarisePair(pair)
+			pair.Examples = v.examples(lookup, xs, ys, rows, s > 0)
+			pairs = append(pairs, pair)
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return math.Abs(float64(pairs[i].Spearman)) > math.Abs(float64(pairs[j].Spearman))
+	})
+	for _, pair := range pairs {
+		if pair.Spearman > 0 && len(c.StrongestPositive) < strongestPairCount {
+			c.StrongestPositive = append(c.StrongestPositive, pair)
+		} else if pair.Spearman < 0 && len(c.StrongestNegative) < strongestPairCount {
+			c.StrongestNegative = append(c.StrongestNegative, pair)
+		}
+	}
+	return c
+}
+
+// pairwise returns the values of variables i and j, and their row indexes, for the rows where both are known.
+func (v *Vectors) pairwise(i, j int) ([]float64, []float64, []int) {
+	xs := make([]float64, 0, len(v.rows))
+	ys := make([]float64, 0, len(v.rows))
+	rows := make([]int, 0, len(v.rows))
+	for r, row := range v.rows {
+		if math.IsNaN(row[i]) || math.IsNaN(row[j]) {
+			continue
+		}
+		xs, ys, rows = append(xs, row[i]), append(ys, row[j]), append(rows, r)
+	}
+	return xs, ys, rows
+}
+
+// examples picks the tracks which best exemplify the correlation between a pair of variables, i.e. those ranked highly
+// for both variables if positively correlated, or highly for one and lowly for the other if negatively correlated.
+func (v *Vectors) examples(lookup map[string]spotify.TrackDetails, xs, ys []float64, rows []int,
+	positive bool) []PairExample {
+	xRanks, yRanks := ranks(xs), ranks(ys)
+	scores := make([]float64, len(rows))
+	for k := range rows {
+		if positive {
+			scores[k] = xRanks[k] + yRanks[k]
+		} else {
+			scores[k] = xRanks[k] - yRanks[k]
+		}
+	}
+	order := make([]int, len(rows))
+	for k := range order {
+		order[k] = k
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+
+	examples := make([]PairExample, 0, pairExampleCount)
+	seen := make(map[string]struct{}, pairExampleCount)
+	for _, k := range order {
+		if len(examples) == pairExampleCount {
+			break
+		}
+		id := v.ids[rows[k]]
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		track := lookup[id]
+		examples = append(examples, PairExample{
+			Name:       track.GetTrackString(),
+			CoverImage: track.Album.Images.First(),
+			SpotifyURL: track.ExternalURLs.Spotify,
+			A:          math.Round(xs[k]*10) / 10,
+			B:          math.Round(ys[k]*10) / 10,
+		})
+	}
+	return examples
+}
+
+// summarisePair describes a correlated pair of variables.
+func summarisePair(pair CorrelatedPair) string {
+	direction := "higher"
+	if pair.Spearman < 0 {
+		direction = "lower"
+	}
+	return fmt.Sprintf("tracks with a higher %s tend to have %s %s", strings.ReplaceAll(pair.A, "_", " "),
+		direction, strings.ReplaceAll(pair.B, "_", " "))
+}
+
+// pearson calculates the Pearson correlation coefficient of xs and ys, which is NaN if there are fewer than 2 values
+// or either has no variance.
+func pearson(xs, ys []float64) float64 {
+	n := float64(len(xs))
+	if n < 2 {
+		return math.NaN()
+	}
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return math.NaN()
+	}
+	return cov / math.Sqrt(varX*varY)
+}
+
+// ranks converts values into their ranks from 1, where tied values share the average of their ranks. The Pearson
+// coefficient of ranks is the Spearman coefficient.
+func ranks(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return values[order[a]] < values[order[b]]
+	})
+
+	ranked := make([]float64, len(values))
+	for start := 0; start < len(order); {
+		end := start + 1
+		for end < len(order) && values[order[end]] == values[order[start]] {
+			end++
+		}
+		// ranks start to end-1 are tied, so each gets the average of ranks start+1 to end
+		rank := float64(start+end+1) / 2
+		for k := start; k < end; k++ {
+			ranked[order[k]] = rank
+		}
+		start = end
+	}
+	return ranked
+}
@@ -0,0 +1,171 @@
+package stats
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+func TestPearson(t *testing.T) {
+	tests := []struct {
+		name   string
+		xs, ys []float64
+		want   float64
+	}{
+		{name: "known value", xs: []float64{1, 2, 3, 4, 5}, ys: []float64{2, 4, 5, 4, 5}, want: 6 / math.Sqrt(60)},
+		{name: "perfectly positive", xs: []float64{1, 2, 3}, ys: []float64{10, 20, 30}, want: 1},
+		{name: "perfectly negative", xs: []float64{1, 2, 3}, ys: []float64{3, 2, 1}, want: -1},
+		{name: "no values", want: math.NaN()},
+		{name: "single value", xs: []float64{1}, ys: []float64{2}, want: math.NaN()},
+		{name: "no variance", xs: []float64{1, 2, 3}, ys: []float64{5, 5, 5}, want: math.NaN()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := pearson(test.xs, test.ys)
+			if math.IsNaN(test.want) != math.IsNaN(got) || math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRanks(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   []float64
+	}{
+		{name: "distinct", values: []float64{30, 10, 20}, want: []float64{3, 1, 2}},
+		{name: "ties share the average rank", values: []float64{10, 20, 20, 30}, want: []float64{1, 2.5, 2.5, 4}},
+		{name: "all tied", values: []float64{5, 5, 5}, want: []float64{2, 2, 2}},
+		{name: "empty", values: []float64{}, want: []float64{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ranks(test.values); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got ranks %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// newTestVectors returns Vectors of the given variables, where each row is a track whose ID is the row index, along
+// with a lookup of the tracks.
+func newTestVectors(names []string, rows ...[]float64) (*Vectors, map[string]spotify.TrackDetails) {
+	v := NewVectors(names...)
+	lookup := make(map[string]spotify.TrackDetails, len(rows))
+	for i, row := range rows {
+		id := strconv.Itoa(i)
+		v.Push(id, row...)
+		lookup[id] = spotify.TrackDetails{ID: id, Name: "Track " + id, Artists: []spotify.Artist{{Name: "Artist"}}}
+	}
+	return v, lookup
+}
+
+func TestCorrelateSpearmanWithTies(t *testing.T) {
+	v, lookup := newTestVectors([]string{"a", "b"}, []float64{1, 1}, []float64{2, 2}, []float64{2, 3},
+		[]float64{3, 4})
+	c := v.Correlate(lookup)
+
+	// the ranks of a are 1, 2.5, 2.5 and 4, and those of b are 1 to 4
+	want := 4.5 / math.Sqrt(22.5)
+	if got := float64(c.Spearman[0][1]); math.Abs(got-want) > 1e-9 || c.Spearman[1][0] != c.Spearman[0][1] {
+		t.Errorf("got Spearman coefficients %v and %v, want both %v", c.Spearman[0][1], c.Spearman[1][0], want)
+	}
+	if c.Spearman[0][0] != 1 || c.Pearson[1][1] != 1 {
+		t.Errorf("got self correlations %v and %v, want 1", c.Spearman[0][0], c.Pearson[1][1])
+	}
+}
+
+func TestCorrelateExcludesUnknownValuesPairwise(t *testing.T) {
+	nan := math.NaN()
+	v, lookup := newTestVectors([]string{"a", "b", "c"},
+		[]float64{1, 2, nan}, []float64{2, 4, 1}, []float64{3, 5, 3}, []float64{4, 4, 2}, []float64{5, 5, nan},
+	)
+	c := v.Correlate(lookup)
+
+	// the unknown values of c don't exclude their rows from the correlation of a and b
+	want := pearson([]float64{1, 2, 3, 4, 5}, []float64{2, 4, 5, 4, 5})
+	if got := float64(c.Pearson[0][1]); got != want {
+		t.Errorf("got a/b Pearson coefficient %v, want %v from every row", got, want)
+	}
+	want = pearson([]float64{2, 3, 4}, []float64{1, 3, 2})
+	if got := float64(c.Pearson[0][2]); got != want {
+		t.Errorf("got a/c Pearson coefficient %v, want %v from the rows with known values of c", got, want)
+	}
+}
+
+func TestCorrelateFewerThanTwoValues(t *testing.T) {
+	nan := math.NaN()
+	v, lookup := newTestVectors([]string{"a", "b"}, []float64{1, nan}, []float64{2, 3})
+	c := v.Correlate(lookup)
+
+	// a and b only have a single row in common, and b only has a single value
+	for _, coefficient := range []Coefficient{c.Pearson[0][1], c.Spearman[0][1], c.Pearson[1][1]} {
+		if !math.IsNaN(float64(coefficient)) {
+			t.Errorf("got coefficient %v, want NaN", coefficient)
+		}
+	}
+	body, err := json.Marshal(c.Pearson)
+	if err != nil {
+		t.Fatalf("failed to encode coefficients: %s", err)
+	}
+	if got, want := string(body), `[[1,null],[null,null]]`; got != want {
+		t.Errorf("got encoded coefficients %s, want %s", got, want)
+	}
+	if len(c.StrongestPositive) != 0 || len(c.StrongestNegative) != 0 {
+		t.Errorf("got strongest pairs %+v and %+v, want none", c.StrongestPositive, c.StrongestNegative)
+	}
+}
+
+func TestCorrelateStrongestPairs(t *testing.T) {
+	// square is perfectly ranked with x, noisy swaps adjacent pairs of x, and weak is barely correlated with anything
+	// but noisy
+	names := []string{"x", "square", "opposite", "noisy", "weak"}
+	noisy := []float64{2, 1, 4, 3, 6, 5, 8, 7, 10, 9}
+	weak := []float64{5, 1, 9, 3, 7, 2, 10, 4, 8, 6}
+	rows := make([][]float64, 0, 10)
+	for i := 0; i < 10; i++ {
+		x := float64(i + 1)
+		rows = append(rows, []float64{x, x * x, 11 - x, noisy[i], weak[i]})
+	}
+	v, lookup := newTestVectors(names, rows...)
+	c := v.Correlate(lookup)
+
+	pairNames := func(pairs []CorrelatedPair) []string {
+		got := make([]string, 0, len(pairs))
+		for _, pair := range pairs {
+			got = append(got, pair.A+"/"+pair.B)
+		}
+		return got
+	}
+	// noisy/weak is the fourth strongest positive pair, and weak is too weakly correlated with the rest to be reported
+	wantPositive := []string{"x/square", "x/noisy", "square/noisy"}
+	if got := pairNames(c.StrongestPositive); !reflect.DeepEqual(got, wantPositive) {
+		t.Errorf("got strongest positive pairs %q, want %q", got, wantPositive)
+	}
+	wantNegative := []string{"x/opposite", "square/opposite", "opposite/noisy"}
+	if got := pairNames(c.StrongestNegative); !reflect.DeepEqual(got, wantNegative) {
+		t.Errorf("got strongest negative pairs %q, want %q", got, wantNegative)
+	}
+
+	pair := c.StrongestPositive[0]
+	if pair.Summary != "tracks with a higher x tend to have higher square" {
+		t.Errorf("got summary %q", pair.Summary)
+	}
+	wantExamples := []PairExample{
+		{Name: "Artist - Track 9", A: 10, B: 100},
+		{Name: "Artist - Track 8", A: 9, B: 81},
+		{Name: "Artist - Track 7", A: 8, B: 64},
+	}
+	if !reflect.DeepEqual(pair.Examples, wantExamples) {
+		t.Errorf("got examples %+v, want %+v", pair.Examples, wantExamples)
+	}
+	if summary := c.StrongestNegative[0].Summary; summary != "tracks with a higher x tend to have lower opposite" {
+		t.Errorf("got summary %q", summary)
+	}
+}
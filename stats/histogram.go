@@ -0,0 +1,161 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// BinEdges determines the ascending edges of a Histogram's bins from its sorted values, where n+1 edges define n bins.
+// Each bin includes its lower edge and excludes its upper edge, except for the last bin which includes both.
+type BinEdges func(sorted []float64) []float64
+
+// FixedWidthBins divides the range from lower to upper into the given number of bins of equal width.
+func FixedWidthBins(lower, upper float64, count int) BinEdges {
+	return func([]float64) []float64 {
+		edges := make([]float64, 0, count+1)
+		width := (upper - lower) / float64(count)
+		for i := 0; i < count; i++ {
+			edges = append(edges, lower+width*float64(i))
+		}
+		return append(edges, upper)
+	}
+}
+
+// QuantileBins divides the values into the given number of bins which each contain roughly the same number of values.
+// Bins are merged where repeated values would otherwise produce empty bins, so fewer bins may be returned.
+func QuantileBins(count int) BinEdges {
+	return func(sorted []float64) []float64 {
+		if len(sorted) == 0 {
+			return nil
+		}
+		edges := make([]float64, 0, count+1)
+		for i := 0; i <= count; i++ {
+			rank := float64(i) / float64(count) * float64(len(sorted)-1)
+			edge := sorted[int(math.Round(rank))]
+			if len(edges) == 0 || edge > edges[len(edges)-1] {
+				edges = append(edges, edge)
+			}
+		}
+		if len(edges) == 1 {
+			// every value is the same, so there is a single bin
+			edges = append(edges, edges[0])
+		}
+		return edges
+	}
+}
+
+// FixedBins uses the given edges, e.g. domain specific ranges. An infinite first or last edge produces an open-ended
+// bin.
+func FixedBins(edges ...float64) BinEdges {
+	return func([]float64) []float64 {
+		return edges
+	}
+}
+
+// TempoBins are tempo ranges in BPM which roughly separate slow, mid-tempo, upbeat and fast tracks.
+var TempoBins = FixedBins(0, 80, 100, 120, 140, 160, math.Inf(1))
+
+// Histogram counts values into bins. Call Calc to finalise the counts. If the bin edges don't depend on the values,
+// values are counted as they are pushed rather than retained.
+type Histogram struct {
+	edges  BinEdges
+	format func(float64) string
+	values []float64
+	// fixed are the bin edges if they don't depend on the values, in which case counts are the counts of each bin
+	fixed  []float64
+	counts []int
+}
+
+// HistogramOpt defines a Histogram option.
+type HistogramOpt func(*Histogram)
+
+// WithEdgeFormat sets how bin edges are formatted in bin labels. Edges are rounded to 2 decimal places by default.
+func WithEdgeFormat(format func(float64) string) HistogramOpt {
+	return func(h *Histogram) {
+		h.format = format
+	}
+}
+
+// NewHistogram returns a Histogram with bins determined by the given edges.
+func NewHistogram(edges BinEdges, opts ...HistogramOpt) *Histogram {
+	h := &Histogram{
+		edges: edges,
+		format: func(val float64) string {
+			return strconv.FormatFloat(math.Round(val*100)/100, 'f', -1, 64)
+		},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	// edges which are determined without any values don't depend on them
+	if fixed := edges(nil); len(fixed) >= 2 {
+		h.fixed = fixed
+		h.counts = make([]int, len(fixed)-1)
+	}
+	return h
+}
+
+// Push pushes a value into the Histogram.
+func (h *Histogram) Push(val float64) {
+	if h.counts != nil {
+		h.counts[bin(h.fixed, val)]++
+		return
+	}
+	h.values = append(h.values, val)
+}
+
+// Calc counts the values in each bin, returning the counts in bin order keyed by bin label, e.g. "10-20". Values
+// outside of the bin edges are counted in the first or last bin.
+func (h *Histogram) Calc() *OrderedKVPair {
+	edges, counts := h.fixed, h.counts
+	if counts == nil {
+		sorted := make([]float64, len(h.values))
+		copy(sorted, h.values)
+		sort.Float64s(sorted)
+
+		edges = h.edges(sorted)
+		if len(edges) >= 2 {
+			counts = make([]int, len(edges)-1)
+			for _, val := range sorted {
+				counts[bin(edges, val)]++
+			}
+		}
+	}
+
+	pair := &OrderedKVPair{
+		Keys:   make([]string, 0, len(counts)),
+		Values: make([]int, 0, len(counts)),
+	}
+	for i, count := range counts {
+		pair.Keys = append(pair.Keys, h.label(edges[i], edges[i+1]))
+		pair.Values = append(pair.Values, count)
+	}
+	return pair
+}
+
+// bin returns the index of the bin which the value falls into, of the bins defined by the given edges. Values outside
+// of the edges fall into the first or last bin.
+func bin(edges []float64, val float64) int {
+	// find the last edge which the value is not below
+	i := sort.Search(len(edges), func(i int) bool {
+		return edges[i] > val
+	}) - 1
+	switch {
+	case i < 0:
+		return 0
+	case i >= len(edges)-1:
+		return len(edges) - 2
+	}
+	return i
+}
+
+func (h *Histogram) label(lower, upper float64) string {
+	switch {
+	case math.IsInf(upper, 1):
+		return h.format(lower) + "+"
+	case math.IsInf(lower, -1):
+		return "<" + h.format(upper)
+	}
+	return h.format(lower) + "-" + h.format(upper)
+}
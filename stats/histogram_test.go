@@ -0,0 +1,124 @@
+package stats
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestHistogramCalc(t *testing.T) {
+	tests := []struct {
+		name       string
+		edges      BinEdges
+		values     []float64
+		wantKeys   []string
+		wantValues []int
+	}{
+		{
+			name:       "fixed width",
+			edges:      FixedWidthBins(0, 30, 3),
+			values:     []float64{0, 5, 10, 19.9, 20, 25},
+			wantKeys:   []string{"0-10", "10-20", "20-30"},
+			wantValues: []int{2, 2, 2},
+		},
+		{
+			name:       "upper edge is inclusive in the last bin",
+			edges:      FixedWidthBins(0, 30, 3),
+			values:     []float64{30, 30},
+			wantKeys:   []string{"0-10", "10-20", "20-30"},
+			wantValues: []int{0, 0, 2},
+		},
+		{
+			name:       "out of range values are clamped into the end bins",
+			edges:      FixedWidthBins(0, 30, 3),
+			values:     []float64{-5, -0.1, 30.1, 100},
+			wantKeys:   []string{"0-10", "10-20", "20-30"},
+			wantValues: []int{2, 0, 2},
+		},
+		{
+			name:       "open-ended bins",
+			edges:      FixedBins(math.Inf(-1), 10, math.Inf(1)),
+			values:     []float64{-100, 9, 10, 1000},
+			wantKeys:   []string{"<10", "10+"},
+			wantValues: []int{2, 2},
+		},
+		{
+			name:       "fixed width without values",
+			edges:      FixedWidthBins(0, 30, 3),
+			wantKeys:   []string{"0-10", "10-20", "20-30"},
+			wantValues: []int{0, 0, 0},
+		},
+		{
+			name:       "quantiles",
+			edges:      QuantileBins(2),
+			values:     []float64{4, 1, 3, 2, 5},
+			wantKeys:   []string{"1-3", "3-5"},
+			wantValues: []int{2, 3},
+		},
+		{
+			// the edges at ranks 0, 1.25 and 2.5 are all 1, so collapse into a single edge
+			name:       "quantile edges of duplicate values collapse",
+			edges:      QuantileBins(4),
+			values:     []float64{1, 1, 1, 1, 2, 3},
+			wantKeys:   []string{"1-2", "2-3"},
+			wantValues: []int{4, 2},
+		},
+		{
+			name:       "quantiles of identical values",
+			edges:      QuantileBins(4),
+			values:     []float64{5, 5, 5},
+			wantKeys:   []string{"5-5"},
+			wantValues: []int{3},
+		},
+		{
+			name:       "quantiles without values",
+			edges:      QuantileBins(4),
+			wantKeys:   []string{},
+			wantValues: []int{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := NewHistogram(test.edges)
+			for _, v := range test.values {
+				h.Push(v)
+			}
+			got := h.Calc()
+			if !reflect.DeepEqual(got.Keys, test.wantKeys) || !reflect.DeepEqual(got.Values, test.wantValues) {
+				t.Errorf("got bins %q with counts %v, want %q with %v", got.Keys, got.Values, test.wantKeys,
+					test.wantValues)
+			}
+		})
+	}
+}
+
+func TestHistogramEdgeFormat(t *testing.T) {
+	// edges are rounded to 2 decimal places by default
+	h := NewHistogram(FixedWidthBins(0, 1, 3))
+	if got, want := h.Calc().Keys, []string{"0-0.33", "0.33-0.67", "0.67-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got bins %q, want %q", got, want)
+	}
+
+	h = NewHistogram(FixedWidthBins(0, 120, 2), WithEdgeFormat(func(val float64) string {
+		return strconv.Itoa(int(val/60)) + "m"
+	}))
+	if got, want := h.Calc().Keys, []string{"0m-1m", "1m-2m"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got bins %q, want %q", got, want)
+	}
+}
+
+func TestHistogramWithFixedEdgesRetainsNoValues(t *testing.T) {
+	h := NewHistogram(FixedWidthBins(0, 100, 10))
+	for i := 0; i < 1000; i++ {
+		h.Push(float64(i % 100))
+	}
+	if len(h.values) != 0 {
+		t.Errorf("retained %d values, want them counted as they are pushed", len(h.values))
+	}
+	for i, count := range h.Calc().Values {
+		if count != 100 {
+			t.Errorf("got %d values in bin %d, want 100", count, i)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package stats
+
+import (
+	"math"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// Mood is a mood quadrant of the valence/energy plane.
+type Mood string
+
+// The mood quadrants, where valence describes how positive a track sounds and energy how intense it is.
+const (
+	MoodHappy Mood = "happy/energetic" // high valence, high energy
+	MoodCalm  Mood = "calm/content"    // high valence, low energy
+	MoodAngry Mood = "angry/tense"     // low valence, high energy
+	MoodSad   Mood = "sad/melancholic" // low valence, low energy
+)
+
+// Moods are the mood quadrants, ordered clockwise from the top right of the valence/energy plane.
+var Moods = []Mood{MoodHappy, MoodCalm, MoodSad, MoodAngry}
+
+// MoodClassifier classifies tracks into mood quadrants by their valence and energy, from 0 to 1. Call Calc to finalise
+// the classification.
+type MoodClassifier struct {
+	valenceThreshold, energyThreshold float64
+	counts                            map[Mood]int
+	representatives                   map[Mood]moodPoint
+}
+
+// moodPoint is a track's position on the valence/energy plane. Its strength is how far it is within its quadrant.
+type moodPoint struct {
+	id              string
+	valence, energy float64
+	strength        float64
+}
+
+// MoodOpt defines a MoodClassifier option.
+type MoodOpt func(*MoodClassifier)
+
+// WithMoodThresholds sets the valence and energy values, from 0 to 1, which divide the quadrants. Values equal to a
+// threshold are classified as high. Both thresholds are 0.5 by default.
+func WithMoodThresholds(valence, energy float64) MoodOpt {
+	return func(c *MoodClassifier) {
+		c.valenceThreshold = valence
+		c.energyThreshold = energy
+	}
+}
+
+// NewMoodClassifier returns a MoodClassifier.
+func NewMoodClassifier(opts ...MoodOpt) *MoodClassifier {
+	c := &MoodClassifier{
+		valenceThreshold: 0.5,
+		energyThreshold:  0.5,
+		counts:           make(map[Mood]int, len(Moods)),
+		representatives:  make(map[Mood]moodPoint, len(Moods)),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Classify returns the mood quadrant of the given valence and energy.
+func (c *MoodClassifier) Classify(valence, energy float64) Mood {
+	switch {
+	case valence >= c.valenceThreshold && energy >= c.energyThreshold:
+		return MoodHappy
+	case valence >= c.valenceThreshold:
+		return MoodCalm
+	case energy >= c.energyThreshold:
+		return MoodAngry
+	}
+	return MoodSad
+}
+
+// Push classifies a track by its valence and energy.
+func (c *MoodClassifier) Push(id string, valence, energy float64) {
+	mood := c.Classify(valence, energy)
+	c.counts[mood]++
+
+	// a track is only as firmly within its quadrant as its distance from the nearest threshold
+	point := moodPoint{
+		id:       id,
+		valence:  valence,
+		energy:   energy,
+		strength: math.Min(math.Abs(valence-c.valenceThreshold), math.Abs(energy-c.energyThreshold)),
+	}
+	if current, ok := c.representatives[mood]; !ok || point.strength > current.strength {
+		c.representatives[mood] = point
+	}
+}
+
+// CollectIDs adds the IDs of the representative tracks, which Calc looks up, to ids.
+func (c *MoodClassifier) CollectIDs(ids map[string]struct{}) {
+	for _, point := range c.representatives {
+		ids[point.id] = struct{}{}
+	}
+}
+
+// MoodStats are the number of tracks in each mood quadrant and the overall mood. Thresholds, valences and energies
+// are percentages.
+type MoodStats struct {
+	// Mood is the most common mood quadrant, with ties going to the first in Moods order. It is empty if no tracks were
+	// classified.
+	Mood             Mood           `json:"mood"`
+	ValenceThreshold float64        `json:"valence_threshold"`
+	EnergyThreshold  float64        `json:"energy_threshold"`
+	Quadrants        []MoodQuadrant `json:"quadrants"`
+}
+
+// MoodQuadrant is the number of tracks in a mood quadrant.
+type MoodQuadrant struct {
+	Mood  Mood `json:"mood"`
+	Count int  `json:"count"`
+	// Representative is the track most firmly within the quadrant, i.e. furthest from both thresholds. It is nil if
+	// the quadrant has no tracks.
+	Representative *MoodTrack `json:"representative"`
+}
+
+// MoodTrack is a track representing a mood quadrant, along with its valence and energy to 1 decimal place.
+type MoodTrack struct {
+	Name       string  `json:"name"`
+	CoverImage string  `json:"cover_image,omitempty"`
+	SpotifyURL string  `json:"spotify_url,omitempty"`
+	Valence    float64 `json:"valence"`
+	Energy     float64 `json:"energy"`
+}
+
+// Calc counts the tracks in each mood quadrant, in Moods order, and looks up each quadrant's representative track.
+func (c *MoodClassifier) Calc(lookup map[string]spotify.TrackDetails) MoodStats {
+	s := MoodStats{
+		ValenceThreshold: c.valenceThreshold * 100,
+		EnergyThreshold:  c.energyThreshold * 100,
+		Quadrants:        make([]MoodQuadrant, 0, len(Moods)),
+	}
+	var maxCount int
+	for _, mood := range Moods {
+		quadrant := MoodQuadrant{Mood: mood, Count: c.counts[mood]}
+		if quadrant.Count > maxCount {
+			maxCount = quadrant.Count
+			s.Mood = mood
+		}
+		if point, ok := c.representatives[mood]; ok {
+			track := lookup[point.id]
+			quadrant.Representative = &MoodTrack{
+				Name:       track.GetTrackString(),
+				CoverImage: track.Album.Images.First(),
+				SpotifyURL: track.ExternalURLs.Spotify,
+				Valence:    math.Round(point.valence*1000) / 10,
+				Energy:     math.Round(point.energy*1000) / 10,
+			}
+		}
+		s.Quadrants = append(s.Quadrants, quadrant)
+	}
+	return s
+}
@@ -0,0 +1,162 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+func TestMoodClassifierClassify(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            []MoodOpt
+		valence, energy float64
+		want            Mood
+	}{
+		{name: "happy", valence: 0.8, energy: 0.8, want: MoodHappy},
+		{name: "calm", valence: 0.8, energy: 0.2, want: MoodCalm},
+		{name: "sad", valence: 0.2, energy: 0.2, want: MoodSad},
+		{name: "angry", valence: 0.2, energy: 0.8, want: MoodAngry},
+		// values equal to a threshold are classified as high
+		{name: "both at the thresholds", valence: 0.5, energy: 0.5, want: MoodHappy},
+		{name: "valence at the threshold", valence: 0.5, energy: 0.49, want: MoodCalm},
+		{name: "energy at the threshold", valence: 0.49, energy: 0.5, want: MoodAngry},
+		{name: "just below both thresholds", valence: 0.49, energy: 0.49, want: MoodSad},
+		{
+			name:    "custom thresholds",
+			opts:    []MoodOpt{WithMoodThresholds(0.7, 0.3)},
+			valence: 0.6, energy: 0.4,
+			want: MoodAngry,
+		},
+		{
+			name:    "at custom thresholds",
+			opts:    []MoodOpt{WithMoodThresholds(0.7, 0.3)},
+			valence: 0.7, energy: 0.3,
+			want: MoodHappy,
+		},
+		{
+			name:    "below custom thresholds",
+			opts:    []MoodOpt{WithMoodThresholds(0.7, 0.3)},
+			valence: 0.69, energy: 0.29,
+			want: MoodSad,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := NewMoodClassifier(test.opts...).Classify(test.valence, test.energy); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+// moodTrack is a track pushed into a MoodClassifier.
+type moodTrack struct {
+	id              string
+	valence, energy float64
+}
+
+func TestMoodClassifierCalc(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []MoodOpt
+		tracks []moodTrack
+		want   Mood
+		// wantCounts and wantRepresentatives are in Moods order, where an empty representative means none
+		wantCounts          []int
+		wantRepresentatives []string
+	}{
+		{
+			name:                "no tracks",
+			wantCounts:          []int{0, 0, 0, 0},
+			wantRepresentatives: []string{"", "", "", ""},
+		},
+		{
+			// the representative is the track furthest from both thresholds, not just one of them
+			name: "representatives",
+			tracks: []moodTrack{
+				{"happy-edge", 0.99, 0.51}, {"happy-firm", 0.8, 0.8}, {"happy-mid", 0.7, 0.6},
+				{"sad", 0.1, 0.1}, {"angry", 0.3, 0.9},
+			},
+			want:                MoodHappy,
+			wantCounts:          []int{3, 0, 1, 1},
+			wantRepresentatives: []string{"happy-firm", "", "sad", "angry"},
+		},
+		{
+			// a later track of equal strength doesn't replace the representative
+			name:                "representative tie",
+			tracks:              []moodTrack{{"first", 0.2, 0.8}, {"second", 0.8, 0.2}, {"third", 0.2, 0.8}},
+			want:                MoodAngry,
+			wantCounts:          []int{0, 1, 0, 2},
+			wantRepresentatives: []string{"", "second", "", "first"},
+		},
+		{
+			// tied quadrants resolve to the first in Moods order
+			name:                "mood tie",
+			tracks:              []moodTrack{{"angry", 0.2, 0.8}, {"sad", 0.2, 0.2}, {"calm", 0.8, 0.2}},
+			want:                MoodCalm,
+			wantCounts:          []int{0, 1, 1, 1},
+			wantRepresentatives: []string{"", "calm", "sad", "angry"},
+		},
+		{
+			// with a valence threshold of 0.9, the happy tracks of the default thresholds are angry
+			name:                "custom thresholds",
+			opts:                []MoodOpt{WithMoodThresholds(0.9, 0.5)},
+			tracks:              []moodTrack{{"a", 0.8, 0.8}, {"b", 0.7, 0.9}, {"c", 0.95, 0.2}},
+			want:                MoodAngry,
+			wantCounts:          []int{0, 1, 0, 2},
+			wantRepresentatives: []string{"", "c", "", "b"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewMoodClassifier(test.opts...)
+			lookup := make(map[string]spotify.TrackDetails, len(test.tracks))
+			for _, track := range test.tracks {
+				c.Push(track.id, track.valence, track.energy)
+				lookup[track.id] = spotify.TrackDetails{ID: track.id, Name: track.id,
+					Artists: []spotify.Artist{{Name: "Artist"}}}
+			}
+			s := c.Calc(lookup)
+
+			if s.Mood != test.want {
+				t.Errorf("got mood %q, want %q", s.Mood, test.want)
+			}
+			counts := make([]int, 0, len(s.Quadrants))
+			representatives := make([]string, 0, len(s.Quadrants))
+			for i, quadrant := range s.Quadrants {
+				if quadrant.Mood != Moods[i] {
+					t.Errorf("got quadrant %d of %s, want %s", i, quadrant.Mood, Moods[i])
+				}
+				counts = append(counts, quadrant.Count)
+				representative := ""
+				if quadrant.Representative != nil {
+					representative = quadrant.Representative.Name[len("Artist - "):]
+				}
+				representatives = append(representatives, representative)
+			}
+			if !reflect.DeepEqual(counts, test.wantCounts) {
+				t.Errorf("got counts %v, want %v", counts, test.wantCounts)
+			}
+			if !reflect.DeepEqual(representatives, test.wantRepresentatives) {
+				t.Errorf("got representatives %q, want %q", representatives, test.wantRepresentatives)
+			}
+		})
+	}
+}
+
+func TestMoodClassifierCalcReportsPercentages(t *testing.T) {
+	c := NewMoodClassifier(WithMoodThresholds(0.6, 0.4))
+	c.Push("a", 0.123, 0.987)
+	s := c.Calc(map[string]spotify.TrackDetails{"a": {ID: "a", Name: "A"}})
+
+	if s.ValenceThreshold != 60 || s.EnergyThreshold != 40 {
+		t.Errorf("got thresholds %v and %v, want 60 and 40", s.ValenceThreshold, s.EnergyThreshold)
+	}
+	// angry is after sad in Moods order
+	representative := s.Quadrants[3].Representative
+	if representative == nil || representative.Valence != 12.3 || representative.Energy != 98.7 {
+		t.Errorf("got representative %+v, want valence 12.3 and energy 98.7", representative)
+	}
+}
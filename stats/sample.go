@@ -0,0 +1,25 @@
+package stats
+
+import "math/rand"
+
+// reservoir selects a uniform random sample of at most size items from a stream of items of unknown length, using
+// reservoir sampling. The sample is seeded, so is the same for the same stream. A size of 0 retains every item.
+type reservoir struct {
+	size int
+	rng  *rand.Rand
+}
+
+// slot returns the index of the sample to store the nth item of the stream at, counting from 1, or -1 if the item
+// isn't sampled. The index is the length of the sample if the item should be appended.
+func (r *reservoir) slot(n int) int {
+	if r.size <= 0 || n <= r.size {
+		return n - 1
+	}
+	if r.rng == nil {
+		r.rng = rand.New(rand.NewSource(int64(r.size)))
+	}
+	if i := r.rng.Intn(n); i < r.size {
+		return i
+	}
+	return -1
+}
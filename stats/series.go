@@ -0,0 +1,81 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// Series is a time-ordered set of values. Where Group summarises the distribution of a dataset, Series captures how
+// its values changed over time, e.g. the energy arc of a listening session.
+type Series struct {
+	// Points are the values in time order, along with their track metadata.
+	Points []SeriesPoint `json:"points"`
+	Mean   float64       `json:"avg"`
+	// Change is the change in value from the start to the end of the series according to a least squares linear fit,
+	// which is less sensitive to individual outliers than comparing the first and last values.
+	Change float64 `json:"change"`
+}
+
+// SeriesPoint is a single value in a Series.
+type SeriesPoint struct {
+	Time time.Time `json:"time"`
+	Detail
+}
+
+// Push pushes a value, its key and the time it occurred into the Series. Values may be pushed in any order. Call Calc
+// to finalise the Series statistics.
+func (s *Series) Push(id string, t time.Time, val float64) {
+	s.Points = append(s.Points, SeriesPoint{
+		Time:   t,
+		Detail: Detail{id: id, value: val},
+	})
+}
+
+// Len returns the number of values pushed.
+func (s *Series) Len() int {
+	return len(s.Points)
+}
+
+// Calc calculates the final statistics for the Series; to be called once all values have been Pushed.
+func (s *Series) Calc(lookup map[string]spotify.TrackDetails) {
+	sort.SliceStable(s.Points, func(i, j int) bool {
+		return s.Points[i].Time.Before(s.Points[j].Time)
+	})
+
+	var sum float64
+	for i := range s.Points {
+		p := &s.Points[i]
+		track := lookup[p.id]
+		p.Set(track.GetTrackString(), track.Album.Images.First(), track.ExternalURLs.Spotify)
+		p.ValueOut = math.Round(p.value)
+		sum += p.value
+	}
+	if len(s.Points) == 0 {
+		return
+	}
+	s.Mean = math.Round(sum / float64(len(s.Points)))
+
+	// fit a line through the values over time, measured in seconds since the first value
+	start := s.Points[0].Time
+	n := float64(len(s.Points))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, p := range s.Points {
+		x := p.Time.Sub(start).Seconds()
+		sumX += x
+		sumY += p.value
+		sumXY += x * p.value
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		// all values occurred at the same time, so there is no change over time
+		s.Change = 0
+		return
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	duration := s.Points[len(s.Points)-1].Time.Sub(start).Seconds()
+	s.Change = math.Round(slope*duration*10) / 10
+}
@@ -0,0 +1,93 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeriesCalc(t *testing.T) {
+	start := time.Date(2023, 3, 1, 20, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	tests := []struct {
+		name       string
+		times      []time.Time
+		values     []float64
+		wantMean   float64
+		wantChange float64
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "single value",
+			times:    []time.Time{at(0)},
+			values:   []float64{42},
+			wantMean: 42,
+		},
+		{
+			name:       "rising",
+			times:      []time.Time{at(0), at(1), at(2)},
+			values:     []float64{10, 20, 30},
+			wantMean:   20,
+			wantChange: 20,
+		},
+		{
+			name:       "falling",
+			times:      []time.Time{at(0), at(1), at(2)},
+			values:     []float64{30, 20, 10},
+			wantMean:   20,
+			wantChange: -20,
+		},
+		{
+			name:       "unsorted",
+			times:      []time.Time{at(2), at(0), at(1)},
+			values:     []float64{30, 10, 20},
+			wantMean:   20,
+			wantChange: 20,
+		},
+		{
+			// the least squares slope is 6 per minute, whereas the first and last values differ by 30
+			name:       "outliers",
+			times:      []time.Time{at(0), at(1), at(2), at(3)},
+			values:     []float64{0, 40, 10, 30},
+			wantMean:   20,
+			wantChange: 18,
+		},
+		{
+			name:       "uneven intervals",
+			times:      []time.Time{at(0), at(1), at(10)},
+			values:     []float64{0, 10, 100},
+			wantMean:   37,
+			wantChange: 100,
+		},
+		{
+			name:     "same time",
+			times:    []time.Time{at(0), at(0)},
+			values:   []float64{10, 30},
+			wantMean: 20,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var s Series
+			for i, v := range test.values {
+				s.Push(string(rune('a'+i)), test.times[i], v)
+			}
+			s.Calc(nil)
+
+			if s.Mean != test.wantMean || s.Change != test.wantChange {
+				t.Errorf("got mean %v and change %v, want %v and %v", s.Mean, s.Change, test.wantMean,
+					test.wantChange)
+			}
+			for i := 1; i < len(s.Points); i++ {
+				if s.Points[i].Time.Before(s.Points[i-1].Time) {
+					t.Errorf("got point %d at %s before point %d at %s, want time order", i, s.Points[i].Time,
+						i-1, s.Points[i-1].Time)
+				}
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package stats
 import (
 	"math"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,26 +28,91 @@ func (d *Detail) Set(name, image, spotifyURL string) {
 	d.SpotifyURL = spotifyURL
 }
 
+// setTrack sets the track metadata for the Detail's track from the given lookup.
+func (d *Detail) setTrack(lookup map[string]spotify.TrackDetails) {
+	track := lookup[d.id]
+	d.Set(track.GetTrackString(), track.Album.Images.First(), track.ExternalURLs.Spotify)
+}
+
 // DateYear determines the year from the date value.
 func (d *Detail) DateYear() int {
 	return time.Unix(int64(d.value), 0).Year()
 }
 
-// Group is used to calculate the min, max and average values for a dataset.
+// Group is used to calculate summary statistics for a dataset: the min, max, mean and median values, the standard
+// deviation, the interquartile range and any requested percentiles. The zero value retains every value; use NewGroup
+// to bound the values retained.
 type Group struct {
-	Min   Detail `json:"min"`
-	Max   Detail `json:"max"`
-	sum   float64
-	count float64
-	Mean  Detail `json:"avg"`
+	Min        Detail `json:"min"`
+	Max        Detail `json:"max"`
+	sum        float64
+	sumSquares float64
+	count      float64
+	Mean       Detail `json:"avg"`
+	// Median carries the track whose value is nearest to the median, as do Percentiles.
+	Median Detail `json:"median"`
+	// StdDev is the population standard deviation and IQR is the interquartile range. They describe the spread of the
+	// values rather than any single track, so have no track metadata.
+	StdDev      Detail       `json:"std_dev"`
+	IQR         Detail       `json:"iqr"`
+	Percentiles []Percentile `json:"percentiles,omitempty"`
+	values      []Detail
+	sample      reservoir
+}
+
+// GroupOpt defines a NewGroup option.
+type GroupOpt func(*Group)
+
+// WithSampleSize bounds the number of values retained by the Group to a uniform random sample of size values, so
+// that its memory usage doesn't grow with the number of values pushed. The median, IQR and percentiles are then
+// estimated from the sample, while the min, max, mean and standard deviation remain exact. A size of 0 retains every
+// value.
+func WithSampleSize(size int) GroupOpt {
+	return func(g *Group) {
+		g.sample.size = size
+	}
+}
+
+// NewGroup returns a Group configured by the given options.
+func NewGroup(opts ...GroupOpt) Group {
+	var g Group
+	for _, opt := range opts {
+		opt(&g)
+	}
+	return g
+}
+
+// CollectIDs adds the IDs of the tracks which Calc may look up to ids: the min and max tracks, and the tracks which
+// may be nearest to the median or a percentile. The details of any other track pushed aren't required by Calc.
+func (g *Group) CollectIDs(ids map[string]struct{}) {
+	if g.count == 0 {
+		return
+	}
+	ids[g.Min.id], ids[g.Max.id] = struct{}{}, struct{}{}
+	for _, d := range g.values {
+		ids[d.id] = struct{}{}
+	}
+}
+
+// Percentile is the value at a percentile of a Group, along with the track whose value is nearest.
+type Percentile struct {
+	Percentile float64 `json:"percentile"`
+	Detail
 }
 
 // Push pushes a value and its key into the Group. Call Calc to finalise the Group statistics.
 func (g *Group) Push(id string, val float64) {
 	g.sum += val
+	g.sumSquares += val * val
 	g.count++
 
 	d := Detail{id: id, value: val}
+	switch i := g.sample.slot(int(g.count)); {
+	case i == len(g.values):
+		g.values = append(g.values, d)
+	case i >= 0:
+		g.values[i] = d
+	}
 	switch {
 	case g.Min.id == "":
 		g.Min, g.Max = d, d
@@ -57,26 +123,38 @@ func (g *Group) Push(id string, val float64) {
 	}
 }
 
-// GroupCalcOpt defines a Calc option.
-type GroupCalcOpt func(*Group)
+// groupCalc configures how Calc processes the Group output values.
+type groupCalc struct {
+	multiplier float64
+	// format formats values, and formatSpread formats the spread of values, i.e. StdDev and IQR. Values are rounded
+	// if not set.
+	format, formatSpread func(float64) any
+	percentiles          []float64
+}
+
+// GroupCalcOpt defines a Calc option. Options apply to every output value.
+type GroupCalcOpt func(*groupCalc)
 
 // WithMultiplier multiplies the Group output values, e.g. can be used to convert decimal values to percentages.
 func WithMultiplier(multiplier float64) GroupCalcOpt {
-	return func(group *Group) {
-		group.Min.value *= multiplier
-		group.Max.value *= multiplier
-		group.Mean.value *= multiplier
+	return func(c *groupCalc) {
+		c.multiplier *= multiplier
 	}
 }
 
-// ToDateString sets the output value to the float value processed into a date string.
+// WithPercentiles additionally calculates the given percentiles, each from 0 to 100, e.g. 90 for the 90th percentile.
+func WithPercentiles(percentiles ...float64) GroupCalcOpt {
+	return func(c *groupCalc) {
+		c.percentiles = append(c.percentiles, percentiles...)
+	}
+}
+
+// ToDateString sets the output value to the float value processed into a date string. The spread of values is
+// processed into a number of years.
 func ToDateString() GroupCalcOpt {
-	return func(group *Group) {
-		group.Min.ValueOut = unixToDate(group.Min.value)
-		group.Max.ValueOut = unixToDate(group.Max.value)
-		if group.count > 0 {
-			group.Mean.ValueOut = unixToDate(group.Mean.value)
-		}
+	return func(c *groupCalc) {
+		c.format = func(val float64) any { return unixToDate(val) }
+		c.formatSpread = func(val float64) any { return secondsToYears(val) }
 	}
 }
 
@@ -84,14 +162,34 @@ func unixToDate(unixDate float64) string {
 	return time.Unix(int64(unixDate), 0).Format("02/01/2006")
 }
 
+const secondsPerYear = 365.25 * 24 * 60 * 60
+
+func secondsToYears(seconds float64) string {
+	return strconv.FormatFloat(math.Round(seconds/secondsPerYear*10)/10, 'f', 1, 64) + " years"
+}
+
+// ToDecibelString sets the output value to the float value processed into a decibel string, e.g. "-6.3 dB".
+func ToDecibelString() GroupCalcOpt {
+	return func(c *groupCalc) {
+		c.format = func(val float64) any { return toDecibels(val) }
+		c.formatSpread = c.format
+	}
+}
+
+func toDecibels(val float64) string {
+	rounded := math.Round(val*10) / 10
+	if rounded == 0 {
+		// avoid formatting negative zero as "-0.0"
+		rounded = 0
+	}
+	return strconv.FormatFloat(rounded, 'f', 1, 64) + " dB"
+}
+
 // ToDurationString sets the output value to the float value processed into a duration string.
 func ToDurationString() GroupCalcOpt {
-	return func(group *Group) {
-		group.Min.ValueOut = secondsToDuration(group.Min.value)
-		group.Max.ValueOut = secondsToDuration(group.Max.value)
-		if group.count > 0 {
-			group.Mean.ValueOut = secondsToDuration(group.Mean.value)
-		}
+	return func(c *groupCalc) {
+		c.format = func(val float64) any { return secondsToDuration(val) }
+		c.formatSpread = c.format
 	}
 }
 
@@ -102,7 +200,11 @@ var durationReplacer = strings.NewReplacer(
 )
 
 func secondsToDuration(seconds float64) string {
-	dur := time.Duration(seconds) * time.Millisecond
+	return FormatDuration(time.Duration(seconds) * time.Millisecond)
+}
+
+// FormatDuration formats a duration to the nearest second, e.g. "1h 5m 3s".
+func FormatDuration(dur time.Duration) string {
 	// Duration.String() doesn't provide spaces - add them in
 	dur = dur.Round(time.Second)
 	repl := durationReplacer.Replace(dur.String())
@@ -111,23 +213,102 @@ func secondsToDuration(seconds float64) string {
 
 // Calc calculates the final statistics for the Group; to be called once all values have bene Pushed.
 func (g *Group) Calc(lookup map[string]spotify.TrackDetails, opts ...GroupCalcOpt) {
-	minTrack, maxTrack := lookup[g.Min.id], lookup[g.Max.id]
-	g.Min.Set(minTrack.GetTrackString(), minTrack.Album.Images.First(), minTrack.ExternalURLs.Spotify)
-	g.Max.Set(maxTrack.GetTrackString(), maxTrack.Album.Images.First(), maxTrack.ExternalURLs.Spotify)
+	c := groupCalc{multiplier: 1}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	g.Min.setTrack(lookup)
+	g.Max.setTrack(lookup)
+	g.Percentiles = nil
 	if g.count > 0 {
 		g.Mean.value = g.sum / g.count
+		g.calcDistribution(lookup, c.percentiles)
 	}
 
-	g.Min.ValueOut = nil
-	for _, opt := range opts {
-		opt(g)
+	// apply the multiplier to every output value, including the spread of values
+	outputs := []*Detail{&g.Min, &g.Max, &g.Mean, &g.Median}
+	for i := range g.Percentiles {
+		outputs = append(outputs, &g.Percentiles[i].Detail)
+	}
+	spreads := []*Detail{&g.StdDev, &g.IQR}
+	for _, d := range append(outputs, spreads...) {
+		d.value *= c.multiplier
+	}
+
+	// if not set by an opt, the output value is the rounded float value
+	format, formatSpread := c.format, c.formatSpread
+	if format == nil {
+		format = func(val float64) any { return math.Round(val) }
+	}
+	if formatSpread == nil {
+		formatSpread = format
+	}
+	g.Min.ValueOut = format(g.Min.value)
+	g.Max.ValueOut = format(g.Max.value)
+	if g.count == 0 && c.format != nil {
+		// there is no meaningful value to format
+		g.Mean.ValueOut, g.Median.ValueOut, g.StdDev.ValueOut, g.IQR.ValueOut = nil, nil, nil, nil
+		return
+	}
+	for _, d := range outputs[2:] {
+		d.ValueOut = format(d.value)
+	}
+	for _, d := range spreads {
+		d.ValueOut = formatSpread(d.value)
+	}
+}
+
+// calcDistribution calculates the median, standard deviation, interquartile range and the given percentiles. The
+// mean must already be calculated. If the values were sampled, the median, IQR and percentiles are estimated from the
+// sample.
+func (g *Group) calcDistribution(lookup map[string]spotify.TrackDetails, percentiles []float64) {
+	sorted := make([]Detail, len(g.values))
+	copy(sorted, g.values)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].value < sorted[j].value
+	})
+
+	g.Median = percentile(sorted, 50)
+	g.Median.setTrack(lookup)
+	g.IQR = Detail{value: percentile(sorted, 75).value - percentile(sorted, 25).value}
+
+	if len(sorted) == int(g.count) {
+		var squaredDiffs float64
+		for _, d := range sorted {
+			squaredDiffs += (d.value - g.Mean.value) * (d.value - g.Mean.value)
+		}
+		g.StdDev = Detail{value: math.Sqrt(squaredDiffs / g.count)}
+	} else {
+		// only a sample of the values was retained, so use the running sums, guarding against rounding errors
+		variance := g.sumSquares/g.count - g.Mean.value*g.Mean.value
+		g.StdDev = Detail{value: math.Sqrt(math.Max(variance, 0))}
 	}
 
-	// some opts set ValueOut, some don't. If not set by an opt, set to the base float value.
-	if g.Min.ValueOut == nil {
-		g.Min.ValueOut = math.Round(g.Min.value)
-		g.Max.ValueOut = math.Round(g.Max.value)
-		g.Mean.ValueOut = math.Round(g.Mean.value)
+	g.Percentiles = make([]Percentile, 0, len(percentiles))
+	for _, p := range percentiles {
+		d := percentile(sorted, p)
+		d.setTrack(lookup)
+		g.Percentiles = append(g.Percentiles, Percentile{Percentile: p, Detail: d})
+	}
+}
+
+// percentile linearly interpolates the value at percentile p of the sorted values, which must not be empty. The
+// track of the value nearest to the percentile is used.
+func percentile(sorted []Detail, p float64) Detail {
+	if p < 0 {
+		p = 0
+	} else if p > 100 {
+		p = 100
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower, upper := int(math.Floor(rank)), int(math.Ceil(rank))
+	frac := rank - float64(lower)
+
+	nearest := sorted[int(math.Round(rank))]
+	return Detail{
+		id:    nearest.id,
+		value: sorted[lower].value + (sorted[upper].value-sorted[lower].value)*frac,
 	}
 }
 
@@ -148,6 +329,19 @@ func (m Mapping) Push(key string) {
 	m[key] = m[key] + 1
 }
 
+// Top returns the key with the highest count and its count. Ties are broken by key order. An empty key is returned if
+// the Mapping has no counts.
+func (m Mapping) Top() (string, int) {
+	var topKey string
+	var topCount int
+	for k, v := range m {
+		if v > topCount || (v == topCount && v > 0 && k < topKey) {
+			topKey, topCount = k, v
+		}
+	}
+	return topKey, topCount
+}
+
 // MappingOpt defines operations to be performed during Mapping.OrderedLabelsAndValues calls.
 type MappingOpt func(*OrderedKVPair)
 
@@ -157,7 +351,8 @@ type SortBy int
 const (
 	// SortKey sorts the OrderedKVPair by key.
 	SortKey SortBy = iota
-	// SortPitchKey sorts by key, but using the musical pitch key notation order.
+	// SortPitchKey sorts by key, but using the musical pitch key notation order. Keys with a mode, e.g. "A minor", are
+	// ordered by pitch then by mode.
 	SortPitchKey
 	// SortValue sorts the OrderedKVPair by value.
 	SortValue
@@ -232,7 +427,7 @@ func (p *OrderedKVPair) Less(i int, j int) bool {
 
 	if p.sortBy == SortPitchKey {
 		// drive the comparison by converting the standard pitch notation back to Spotify's ordered integer key values
-		return pitchKeyToIntMappings[p.Keys[i]] < pitchKeyToIntMappings[p.Keys[j]]
+		return pitchKeyOrder(p.Keys[i]) < pitchKeyOrder(p.Keys[j])
 	}
 
 	// sort by value (default fallback)
@@ -281,3 +476,38 @@ func init() {
 func SpotifyKeyToPitchKey(i int) string {
 	return intToPitchKeyMappings[i]
 }
+
+// Modes are the names of the musical modes. Spotify returns them as integers, where 1 is major and 0 is minor.
+const (
+	ModeMajor = "major"
+	ModeMinor = "minor"
+)
+
+// SpotifyModeToString maps Spotify's integer mode values to the mode names.
+func SpotifyModeToString(mode int) string {
+	if mode == 1 {
+		return ModeMajor
+	}
+	return ModeMinor
+}
+
+// SpotifyKeyModeToString maps Spotify's integer pitch key and mode values to a key signature name, e.g. "A minor".
+func SpotifyKeyModeToString(key, mode int) string {
+	return SpotifyKeyToPitchKey(key) + " " + SpotifyModeToString(mode)
+}
+
+// SpotifyTimeSignatureToString maps Spotify's time signature values, i.e. beats per bar, to time signature notation,
+// e.g. "3/4".
+func SpotifyTimeSignatureToString(timeSignature int) string {
+	return strconv.Itoa(timeSignature) + "/4"
+}
+
+// pitchKeyOrder determines the sort order of a pitch key, optionally followed by a mode, e.g. "A" or "A minor".
+func pitchKeyOrder(key string) int {
+	pitch, mode, _ := strings.Cut(key, " ")
+	order := pitchKeyToIntMappings[pitch] * 2
+	if mode == ModeMinor {
+		order++
+	}
+	return order
+}
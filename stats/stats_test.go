@@ -0,0 +1,165 @@
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/jemgunay/spotify-unwrapped/spotify"
+)
+
+// newTestGroup returns a Group of the given values, where the ID of each value's track is its index, along with a
+// lookup of the tracks.
+func newTestGroup(values ...float64) (*Group, map[string]spotify.TrackDetails) {
+	g := &Group{}
+	lookup := make(map[string]spotify.TrackDetails, len(values))
+	for i, v := range values {
+		id := strconv.Itoa(i)
+		g.Push(id, v)
+		lookup[id] = spotify.TrackDetails{ID: id, Name: "Track " + id, Artists: []spotify.Artist{{Name: "Artist"}}}
+	}
+	return g, lookup
+}
+
+// wantDetail is the expected output value of a Detail and the index of its track, or -1 if it has no track.
+type wantDetail struct {
+	value any
+	track int
+}
+
+func checkDetail(t *testing.T, name string, got Detail, want wantDetail) {
+	t.Helper()
+	wantName := ""
+	if want.track >= 0 {
+		wantName = "Artist - Track " + strconv.Itoa(want.track)
+	}
+	if !reflect.DeepEqual(got.ValueOut, want.value) || got.Name != wantName {
+		t.Errorf("got %s %v (%T) of track %q, want %v (%T) of track %q", name, got.ValueOut, got.ValueOut, got.Name,
+			want.value, want.value, wantName)
+	}
+}
+
+func TestGroupCalc(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		opts   []GroupCalcOpt
+		// the spread of values has no track
+		min, max, mean, median, stdDev, iqr wantDetail
+		percentiles                         []wantDetail
+	}{
+		{
+			name:   "odd count",
+			values: []float64{5, 1, 4, 2, 3},
+			min:    wantDetail{1.0, 1}, max: wantDetail{5.0, 0}, mean: wantDetail{3.0, -1},
+			median: wantDetail{3.0, 4}, stdDev: wantDetail{1.0, -1}, iqr: wantDetail{2.0, -1},
+		},
+		{
+			// the median is interpolated between the middle values, and the track nearest to it rounds up
+			name:   "even count",
+			values: []float64{40, 10, 30, 20},
+			min:    wantDetail{10.0, 1}, max: wantDetail{40.0, 0}, mean: wantDetail{25.0, -1},
+			median: wantDetail{25.0, 2}, stdDev: wantDetail{11.0, -1}, iqr: wantDetail{15.0, -1},
+		},
+		{
+			name:   "single value",
+			values: []float64{7},
+			opts:   []GroupCalcOpt{WithPercentiles(10, 90)},
+			min:    wantDetail{7.0, 0}, max: wantDetail{7.0, 0}, mean: wantDetail{7.0, -1},
+			median: wantDetail{7.0, 0}, stdDev: wantDetail{0.0, -1}, iqr: wantDetail{0.0, -1},
+			percentiles: []wantDetail{{7.0, 0}, {7.0, 0}},
+		},
+		{
+			// 0 to 100 in steps of 10, so the 25th percentile is interpolated at 25 between the tracks of 20 and 30
+			name:   "percentiles of the nearest tracks",
+			values: []float64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100},
+			opts:   []GroupCalcOpt{WithPercentiles(0, 10, 24, 25, 90, 100)},
+			min:    wantDetail{0.0, 0}, max: wantDetail{100.0, 10}, mean: wantDetail{50.0, -1},
+			median: wantDetail{50.0, 5}, stdDev: wantDetail{32.0, -1}, iqr: wantDetail{50.0, -1},
+			percentiles: []wantDetail{{0.0, 0}, {10.0, 1}, {24.0, 2}, {25.0, 3}, {90.0, 9}, {100.0, 10}},
+		},
+		{
+			name:   "multiplier",
+			values: []float64{0.1, 0.2, 0.3, 0.4},
+			opts:   []GroupCalcOpt{WithMultiplier(100), WithPercentiles(90)},
+			min:    wantDetail{10.0, 0}, max: wantDetail{40.0, 3}, mean: wantDetail{25.0, -1},
+			median: wantDetail{25.0, 2}, stdDev: wantDetail{11.0, -1}, iqr: wantDetail{15.0, -1},
+			percentiles: []wantDetail{{37.0, 3}},
+		},
+		{
+			name:   "decibels",
+			values: []float64{-12, -6, -3},
+			opts:   []GroupCalcOpt{ToDecibelString(), WithPercentiles(50)},
+			min:    wantDetail{"-12.0 dB", 0}, max: wantDetail{"-3.0 dB", 2}, mean: wantDetail{"-7.0 dB", -1},
+			median: wantDetail{"-6.0 dB", 1}, stdDev: wantDetail{"3.7 dB", -1}, iqr: wantDetail{"4.5 dB", -1},
+			percentiles: []wantDetail{{"-6.0 dB", 1}},
+		},
+		{
+			name:   "durations",
+			values: []float64{120000, 180000, 240000},
+			opts:   []GroupCalcOpt{ToDurationString(), WithPercentiles(90)},
+			min:    wantDetail{"2m 0s", 0}, max: wantDetail{"4m 0s", 2}, mean: wantDetail{"3m 0s", -1},
+			median: wantDetail{"3m 0s", 1}, stdDev: wantDetail{"49s", -1}, iqr: wantDetail{"1m 0s", -1},
+			percentiles: []wantDetail{{"3m 48s", 2}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, lookup := newTestGroup(test.values...)
+			g.Calc(lookup, test.opts...)
+
+			checkDetail(t, "min", g.Min, test.min)
+			checkDetail(t, "max", g.Max, test.max)
+			checkDetail(t, "mean", g.Mean, test.mean)
+			checkDetail(t, "median", g.Median, test.median)
+			checkDetail(t, "std dev", g.StdDev, test.stdDev)
+			checkDetail(t, "IQR", g.IQR, test.iqr)
+			if len(g.Percentiles) != len(test.percentiles) {
+				t.Fatalf("got %d percentiles, want %d", len(g.Percentiles), len(test.percentiles))
+			}
+			for i, want := range test.percentiles {
+				checkDetail(t, "percentile "+strconv.FormatFloat(g.Percentiles[i].Percentile, 'f', -1, 64),
+					g.Percentiles[i].Detail, want)
+			}
+		})
+	}
+}
+
+func TestGroupCalcEmpty(t *testing.T) {
+	var g Group
+	g.Calc(nil, ToDateString(), WithPercentiles(50))
+	if g.Mean.ValueOut != nil || g.Median.ValueOut != nil || g.StdDev.ValueOut != nil || len(g.Percentiles) != 0 {
+		t.Errorf("got mean %v, median %v, std dev %v and %d percentiles, want no values to format", g.Mean.ValueOut,
+			g.Median.ValueOut, g.StdDev.ValueOut, len(g.Percentiles))
+	}
+}
+
+func TestGroupWithSampleSize(t *testing.T) {
+	const n = 1000
+	g := NewGroup(WithSampleSize(10))
+	for _, v := range rand.New(rand.NewSource(1)).Perm(n) {
+		g.Push(strconv.Itoa(v), float64(v))
+	}
+	if got := len(g.values); got != 10 {
+		t.Errorf("retained %d values, want a sample of 10", got)
+	}
+	ids := make(map[string]struct{})
+	g.CollectIDs(ids)
+	if got := len(ids); got > 12 {
+		t.Errorf("collected %d IDs, want at most the 10 sampled and the min and max", got)
+	}
+
+	g.Calc(nil)
+	// the min, max, mean and standard deviation are exact regardless of the sample
+	wantStdDev := math.Sqrt((n*n - 1) / 12.0)
+	if g.Min.value != 0 || g.Max.value != n-1 || g.Mean.value != (n-1)/2.0 ||
+		math.Abs(g.StdDev.value-wantStdDev) > 1e-6 {
+		t.Errorf("got min %v, max %v, mean %v and std dev %v, want 0, %d, %v and %v", g.Min.value, g.Max.value,
+			g.Mean.value, g.StdDev.value, n-1, (n-1)/2.0, wantStdDev)
+	}
+	if _, ok := ids[g.Median.id]; !ok {
+		t.Errorf("got median track %q, want a sampled track", g.Median.id)
+	}
+}